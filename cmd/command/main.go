@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
 	"github.com/bwmarrin/discordgo"
 	"github.com/joho/godotenv"
 )
@@ -40,7 +41,7 @@ func BulkCommand() {
 		panic(err)
 	}
 
-	_, err = discord.ApplicationCommandCreate(appID, "", &discordgo.ApplicationCommand{
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
 		Name:        "auth",
 		Description: "認証処理",
 		Options: []*discordgo.ApplicationCommandOption{
@@ -83,12 +84,12 @@ func BulkCommand() {
 				Options:     []*discordgo.ApplicationCommandOption{},
 			},
 		},
-	})
+	}))
 	if err != nil {
 		panic(err)
 	}
 
-	_, err = discord.ApplicationCommandCreate(appID, "", &discordgo.ApplicationCommand{
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
 		Name:        "join",
 		Description: "JOIN通知対象のユーザ処理",
 		Options: []*discordgo.ApplicationCommandOption{
@@ -99,14 +100,465 @@ func BulkCommand() {
 				Options: []*discordgo.ApplicationCommandOption{
 					{
 						Name:        "url",
-						Description: "ユーザー情報のURL",
+						Description: "ユーザー情報のURL、ユーザID、または表示名",
 						Type:        discordgo.ApplicationCommandOptionString,
 						Required:    true,
+						// 入力中の表示名からフレンドを補完する
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Name:        "unregister",
+				Description: "JOIN通知対象のユーザの登録を解除",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:         "user",
+						Description:  "通知対象のフレンド",
+						Type:         discordgo.ApplicationCommandOptionString,
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Name:        "list",
+				Description: "JOIN通知対象のユーザの一覧",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     []*discordgo.ApplicationCommandOption{},
+			},
+			{
+				Name:        "gathering",
+				Description: "通知対象のフレンドが同じインスタンスに集まったときの通知",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "min",
+						Description: "何人以上集まったら通知するか（0で通知しない）",
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Required:    true,
+					},
+				},
+			},
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	minWeeks := float64(1)
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:        "stats",
+		Description: "通知対象のフレンドのオンライン状況の統計",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "summary",
+				Description: "オンライン時間・よく訪れるワールド・よくオンラインになる時間帯",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "weeks",
+						Description: "集計する週数（デフォルト: 4）",
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						MinValue:    &minWeeks,
+						MaxValue:    12,
+						Required:    false,
+					},
+					{
+						Name:         "user",
+						Description:  "通知対象のフレンド（デフォルト: 最初に登録したフレンド）",
+						Type:         discordgo.ApplicationCommandOptionString,
+						Required:     false,
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Name:        "heatmap",
+				Description: "曜日・時間帯ごとのオンライン率のヒートマップ画像",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "weeks",
+						Description: "集計する週数（デフォルト: 4）",
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						MinValue:    &minWeeks,
+						MaxValue:    12,
+						Required:    false,
+					},
+					{
+						Name:         "user",
+						Description:  "通知対象のフレンド（デフォルト: 最初に登録したフレンド）",
+						Type:         discordgo.ApplicationCommandOptionString,
+						Required:     false,
+						Autocomplete: true,
+					},
+				},
+			},
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:        "export",
+		Description: "データの出力",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "calendar",
+				Description: "通知対象のフレンドのオンライン履歴をカレンダー（.ics）形式で出力",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "regenerate",
+						Description: "購読用のURLを発行し直す（以前のURLは無効になります）",
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Required:    false,
+					},
+				},
+			},
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:        "digest",
+		Description: "1日1回のまとめ通知（ダイジェスト）",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "enable",
+				Description: "ダイジェストを受け取る",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "time",
+						Description: "送信する時刻（例: 21:00）",
+						Type:        discordgo.ApplicationCommandOptionString,
+						Required:    true,
+					},
+					{
+						Name:        "timezone",
+						Description: "タイムゾーン（デフォルト: Asia/Tokyo）",
+						Type:        discordgo.ApplicationCommandOptionString,
+						Required:    false,
+					},
+					{
+						Name:        "instant",
+						Description: "オンライン時の通知も受け取る（デフォルト: true）",
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Required:    false,
+					},
+				},
+			},
+			{
+				Name:        "disable",
+				Description: "ダイジェストの送信を停止",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     []*discordgo.ApplicationCommandOption{},
+			},
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	// 通知先チャンネルの設定に必要な「チャンネルの管理」権限はハンドラ側で確認する
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:        "notify",
+		Description: "通知先の設定",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "sink",
+				Description: "通知の送信先",
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "set",
+						Description: "通知の送信先を設定",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "type",
+								Description: "送信先の種類",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    true,
+								Choices: []*discordgo.ApplicationCommandOptionChoice{
+									{Name: "Discord", Value: "discord"},
+									{Name: "Slack", Value: "slack"},
+									{Name: "Webhook", Value: "webhook"},
+									{Name: "メール", Value: "email"},
+								},
+							},
+							{
+								Name:        "target",
+								Description: "SlackのIncoming Webhook URL、WebhookのURL、またはメールアドレス",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    false,
+							},
+						},
+					},
+					{
+						Name:        "verify",
+						Description: "メールアドレスに届いた確認コードを入力",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "code",
+								Description: "確認コード",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    true,
+							},
+						},
+					},
+					{
+						Name:        "reset",
+						Description: "通知の送信先をDiscordに戻す",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options:     []*discordgo.ApplicationCommandOption{},
+					},
+				},
+			},
+			{
+				Name:        "channel",
+				Description: "通知先チャンネル",
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "set",
+						Description: "通知先をサーバーのテキストチャンネルに設定",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:         "channel",
+								Description:  "通知先のチャンネル",
+								Type:         discordgo.ApplicationCommandOptionChannel,
+								ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+								Required:     true,
+							},
+							{
+								Name:        "role",
+								Description: "通知時にメンションするロール",
+								Type:        discordgo.ApplicationCommandOptionRole,
+								Required:    false,
+							},
+						},
+					},
+					{
+						Name:        "clear",
+						Description: "通知先をDMに戻す",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options:     []*discordgo.ApplicationCommandOption{},
+					},
+				},
+			},
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	// テンプレートの構文は message パッケージのドキュメントを参照
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:        "settings",
+		Description: "設定",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "template",
+				Description: "通知文のテンプレート",
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "set",
+						Description: "通知文のテンプレートを設定",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "template",
+								Description: "テンプレート（例: {{.DisplayName}} さんが {{.World}} にいます）",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    true,
+								MaxLength:   1000,
+							},
+						},
+					},
+					{
+						Name:        "reset",
+						Description: "通知文を既定に戻す",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options:     []*discordgo.ApplicationCommandOption{},
+					},
+					{
+						Name:        "preview",
+						Description: "サンプルのデータで通知文を確認",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "template",
+								Description: "確認するテンプレート（デフォルト: 設定中のテンプレート）",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    false,
+								MaxLength:   1000,
+							},
+						},
+					},
+				},
+			},
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	// 削除は確認のボタンを押したときに行う
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:        "account",
+		Description: "アカウント",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "export",
+				Description: "保存しているデータをJSONファイルでDMに送信",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     []*discordgo.ApplicationCommandOption{},
+			},
+			{
+				Name:        "delete",
+				Description: "ログアウトし、保存しているデータを全て削除",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     []*discordgo.ApplicationCommandOption{},
+			},
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	// 操作履歴（監査ログ）は本人の分のみ表示する
+	historyMinLimit := float64(1)
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:        "history",
+		Description: "操作履歴",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "limit",
+				Description: "件数（デフォルト: 10）",
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Required:    false,
+				MinValue:    &historyMinLimit,
+				MaxValue:    25,
+			},
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	// 実行できるユーザは設定ファイルの discord.owner_ids でハンドラ側が確認する
+	// サーバー内では管理者以外に表示しないよう、既定の権限も管理者にしておく
+	adminPermission := int64(discordgo.PermissionAdministrator)
+	_, err = discord.ApplicationCommandCreate(appID, "", i18n.LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:                     "admin",
+		Description:              "ボットの管理",
+		DefaultMemberPermissions: &adminPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "stats",
+				Description: "ユーザ数と状態ごとの内訳",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     []*discordgo.ApplicationCommandOption{},
+			},
+			{
+				Name:        "user",
+				Description: "ユーザの状態を確認",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "user",
+						Description: "ユーザ",
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Required:    true,
+					},
+				},
+			},
+			{
+				Name:        "poll",
+				Description: "ユーザのポーリングを今すぐ実行",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "user",
+						Description: "ユーザ",
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Required:    true,
+					},
+				},
+			},
+			{
+				Name:        "history",
+				Description: "ユーザの操作履歴を確認",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "user",
+						Description: "ユーザ",
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Required:    true,
+					},
+					{
+						Name:        "limit",
+						Description: "件数（デフォルト: 10）",
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Required:    false,
+						MinValue:    &historyMinLimit,
+						MaxValue:    25,
+					},
+				},
+			},
+			{
+				Name:        "broadcast",
+				Description: "全てのユーザにお知らせをDMで送信",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "message",
+						Description: "お知らせの本文",
+						Type:        discordgo.ApplicationCommandOptionString,
+						Required:    true,
+						MaxLength:   2000,
+					},
+				},
+			},
+			{
+				Name:        "disable",
+				Description: "ユーザの利用を停止",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "user",
+						Description: "ユーザ",
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Required:    true,
+					},
+				},
+			},
+			{
+				Name:        "enable",
+				Description: "ユーザの利用を再開",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "user",
+						Description: "ユーザ",
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Required:    true,
 					},
 				},
 			},
 		},
-	})
+	}))
 	if err != nil {
 		panic(err)
 	}
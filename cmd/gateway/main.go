@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/app"
+	"github.com/aopontann/vrc-join-notify/internal/handler"
+	"github.com/aopontann/vrc-join-notify/internal/metrics"
+	godotenv "github.com/joho/godotenv"
+)
+
+const (
+	// defaultPollInterval は設定で通知処理の間隔が指定されていない場合の間隔
+	defaultPollInterval = time.Minute
+	// digestInterval はダイジェストの送信時刻を確認する間隔
+	digestInterval = 15 * time.Minute
+)
+
+// DiscordのGatewayに接続してBotを動かすエントリポイント
+// インタラクションをWebSocketで受け取るため、公開されたHTTPSのエンドポイントが不要で、NAT内の自宅サーバーなどでも動かせる。
+// スケジューラの代わりに、通知処理とダイジェストの送信も定期的に実行する。
+func main() {
+	if os.Getenv("ENV") != "prod" {
+		if err := godotenv.Load(".env.dev"); err != nil {
+			slog.Warn("failed to load env variables: " + err.Error())
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a, err := app.New(ctx)
+	if err != nil {
+		slog.Error("failed to initialize app: " + err.Error())
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := a.Close(ctx); err != nil {
+			slog.Error("failed to close resources: " + err.Error())
+		}
+	}()
+
+	session := a.Discord.Session
+	session.AddHandler(handler.GatewayInteractionHandler(a.DB, a.Discord, a.VRC, a.Config.Settings(), a.Config.Discord.OwnerIDs))
+	// インタラクションの受信に特権インテントは不要
+	session.Identify.Intents = 0
+	if err := session.Open(); err != nil {
+		slog.Error("failed to connect to discord gateway: " + err.Error())
+		return
+	}
+	defer session.Close()
+	slog.Info("Connected to discord gateway")
+
+	if addr := a.Config.Metrics.Addr; addr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, addr); err != nil {
+				slog.Error("failed to serve metrics: " + err.Error())
+			}
+		}()
+	}
+
+	interval := a.Config.Poll.Interval.Duration
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+	go every(ctx, interval, func(ctx context.Context) error {
+		return handler.Poll(ctx, a.DB, session, a.VRC, a.Config.Settings(), handler.PollOptions{LockTTL: a.Config.Poll.LockTTL.Duration, Shard: a.Config.Poll.Shard})
+	})
+	go every(ctx, digestInterval, func(ctx context.Context) error {
+		return handler.SendDigests(ctx, a.DB, session, a.VRC)
+	})
+
+	<-ctx.Done()
+	slog.Info("Shutting down")
+}
+
+// every は ctx がキャンセルされるまで interval ごとに f を実行する。
+func every(ctx context.Context, interval time.Duration, f func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f(ctx); err != nil {
+				slog.ErrorContext(ctx, err.Error())
+			}
+		}
+	}
+}
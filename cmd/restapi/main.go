@@ -1,37 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/app"
 	"github.com/aopontann/vrc-join-notify/internal/handler"
+	"github.com/aopontann/vrc-join-notify/internal/metrics"
 	godotenv "github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // DiscordWebhook をローカルで動作確認するためのエンドポイント
 func main() {
-	// Cloud Logging用のログ設定
-	ops := slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelDebug,
-		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
-			if a.Key == slog.LevelKey {
-				a.Key = "severity"
-				level := a.Value.Any().(slog.Level)
-				if level == slog.LevelWarn {
-					a.Value = slog.StringValue("WARNING")
-				}
-			}
-
-			return a
-		},
-	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &ops))
-	slog.SetDefault(logger)
-
 	if os.Getenv("ENV") != "prod" {
 		slog.Debug("Loading environmental variables...")
 		if err := godotenv.Load(".env.dev"); err != nil {
@@ -40,23 +28,89 @@ func main() {
 		}
 	}
 
-	db, err := firestore.NewDB()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a, err := app.New(ctx)
 	if err != nil {
-		slog.Error("failed to connect to firestore: " + err.Error())
+		slog.Error("failed to initialize app: " + err.Error())
+		return
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := a.Close(ctx); err != nil {
+			slog.Error("failed to close resources: " + err.Error())
+		}
+	}()
+
+	if err := a.Config.ValidateInteractionEndpoint(); err != nil {
+		slog.Error(err.Error())
 		return
 	}
 
-	http.HandleFunc("/bot", handler.DiscordBotHandler(db))
-	http.HandleFunc("/notify", handler.NotifyHandler(db))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bot", handler.DiscordBotHandler(a.DB, a.Discord, a.VRC, a.Config.Settings(), a.Config.Discord.OwnerIDs))
+	mux.HandleFunc("/notify", handler.NotifyHandler(a.DB, a.Discord.Session, a.VRC, a.Config.Settings(), pollOptions(a)))
+	mux.HandleFunc("/digest", handler.DigestHandler(a.DB, a.Discord.Session, a.VRC))
+	mux.HandleFunc("GET /calendar/{token}", handler.CalendarHandler(a.DB))
+
+	// リクエストヘッダのトレースコンテキストを引き継ぐ
+	srv := &http.Server{
+		Addr: ":" + a.Config.Port,
+		Handler: otelhttp.NewHandler(mux, "restapi", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		})),
+	}
+
+	// メトリクスは公開しているポートとは別のアドレスで待ち受ける
+	if addr := a.Config.Metrics.Addr; addr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, addr); err != nil {
+				slog.Error("failed to serve metrics: " + err.Error())
+			}
+		}()
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// スケジューラを使わずにローカルで動かす場合は、一定間隔で通知処理を実行する
+	if interval := a.Config.Poll.Interval.Duration; interval > 0 {
+		go poll(ctx, a, interval)
 	}
 
-	slog.Debug(fmt.Sprintf("Listening on port %s", port))
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	// シグナルを受け取ったら処理中のリクエストを待ってから終了する
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("failed to shutdown server: " + err.Error())
+		}
+	}()
+
+	slog.Debug(fmt.Sprintf("Listening on port %s", a.Config.Port))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("something went terribly wrong: " + err.Error())
 		return
 	}
 }
+
+// poll は ctx がキャンセルされるまで interval ごとに通知処理を実行する。
+func poll(ctx context.Context, a *app.App, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := handler.Poll(ctx, a.DB, a.Discord.Session, a.VRC, a.Config.Settings(), pollOptions(a)); err != nil {
+				slog.Error("failed to poll: " + err.Error())
+			}
+		}
+	}
+}
+
+// pollOptions は設定ファイルの通知処理のロックとシャードの設定を返す。
+func pollOptions(a *app.App) handler.PollOptions {
+	return handler.PollOptions{LockTTL: a.Config.Poll.LockTTL.Duration, Shard: a.Config.Poll.Shard}
+}
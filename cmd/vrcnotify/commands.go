@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+)
+
+// login はVRChatにログインし、必要に応じて2段階認証を行ってからセッションを保存する。
+func (c *cli) login(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	username := fs.String("username", "", "ユーザ名またはメールアドレス")
+	fs.Parse(args)
+
+	if *username == "" {
+		u, err := readLine("ユーザ名: ")
+		if err != nil {
+			return err
+		}
+		*username = u
+	}
+	password, err := readSecret("パスワード: ")
+	if err != nil {
+		return err
+	}
+
+	auth, err := c.vrc.Login(ctx, *username, string(password))
+	if errors.Is(err, vrc2.ErrLoginFailed) {
+		return errors.New("ログインに失敗しました。ユーザ名とパスワードを確認してください")
+	}
+	if err != nil {
+		return err
+	}
+
+	methods, err := c.vrc.RequiredTwoFactorAuth(ctx, auth)
+	if err != nil {
+		return err
+	}
+
+	var twoFactorAuth string
+	switch {
+	case slices.Contains(methods, "emailOtp"):
+		code, err := readLine("メールに届いた認証コード: ")
+		if err != nil {
+			return err
+		}
+		twoFactorAuth, err = c.vrc.Verify2FA(ctx, code, auth)
+		if err != nil {
+			return err
+		}
+	case slices.Contains(methods, "totp"):
+		code, err := readLine("認証アプリのコード: ")
+		if err != nil {
+			return err
+		}
+		twoFactorAuth, err = c.vrc.VerifyTOTP(ctx, code, auth)
+		if err != nil {
+			return err
+		}
+	case len(methods) > 0:
+		return fmt.Errorf("未対応の2段階認証の方法です: %v", methods)
+	}
+
+	if err := c.saveSession(session{Auth: auth, TwoFactorAuth: twoFactorAuth}); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "ログインしました。セッションを "+c.sessionPath+" に保存しました。")
+	return nil
+}
+
+// friends はオンライン・オフラインを含む全てのフレンドを表示する。
+func (c *cli) friends(ctx context.Context, args []string) error {
+	s, err := c.loadSession()
+	if err != nil {
+		return err
+	}
+	friends, err := c.vrc.GetFriends(ctx, s.Auth, s.TwoFactorAuth)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range friends {
+		p := presenceFromFriend(f)
+		if err := c.out.print(p, fmt.Sprintf("%s（%s） %s", p.DisplayName, p.ID, p.summary())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// whois はユーザの情報を表示する。
+func (c *cli) whois(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("ユーザを1人指定してください")
+	}
+	s, err := c.loadSession()
+	if err != nil {
+		return err
+	}
+	ids, err := c.resolveUsers(ctx, s, args)
+	if err != nil {
+		return err
+	}
+
+	u, err := c.getUser(ctx, s, ids[0])
+	if err != nil {
+		return err
+	}
+	p := presenceFromUser(u)
+	text := fmt.Sprintf("表示名: %s\nユーザID: %s\n状態: %s\nステータス: %s %s\n場所: %s\nプラットフォーム: %s\n自己紹介: %s",
+		u.DisplayName, u.ID, u.State, u.Status, u.StatusDescription, u.Location, u.Platform, u.Bio)
+	return c.out.print(struct {
+		presence
+		Bio string `json:"bio,omitempty"`
+	}{p, u.Bio}, text)
+}
+
+// watch は interval ごとにフレンドのプレゼンスを確認し、変化があれば表示する。
+// Ctrl+C で終了する。
+func (c *cli) watch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Minute, "プレゼンスを確認する間隔")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("ユーザを1人以上指定してください")
+	}
+	if *interval < 10*time.Second {
+		return errors.New("間隔は10秒以上で指定してください")
+	}
+
+	s, err := c.loadSession()
+	if err != nil {
+		return err
+	}
+	ids, err := c.resolveUsers(ctx, s, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	last := make(map[string]presence)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		for _, id := range ids {
+			u, err := c.getUser(ctx, s, id)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				fmt.Fprintln(os.Stderr, "vrcnotify:", err)
+				continue
+			}
+
+			p := presenceFromUser(u)
+			e := presenceEvent{Time: time.Now(), presence: p}
+			if prev, ok := last[id]; ok {
+				e.Changes = p.changes(prev)
+				if len(e.Changes) == 0 {
+					continue
+				}
+				e.Previous = &prev
+			}
+			last[id] = p
+
+			if err := c.out.print(e, e.text()); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// resolveUsers はURL・ユーザID・表示名で指定されたユーザをユーザIDに変換する。
+// 表示名で指定された場合のみフレンド一覧から探す。
+func (c *cli) resolveUsers(ctx context.Context, s session, inputs []string) ([]string, error) {
+	var friends []vrc2.Friend
+	ids := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		ref, err := vrc2.ParseUserRef(input)
+		if err != nil {
+			return nil, fmt.Errorf("%s: ユーザを特定できません", input)
+		}
+		if ref.ID != "" {
+			ids = append(ids, ref.ID)
+			continue
+		}
+
+		if friends == nil {
+			friends, err = c.vrc.GetFriends(ctx, s.Auth, s.TwoFactorAuth)
+			if err != nil {
+				return nil, err
+			}
+		}
+		f, err := vrc2.FindFriend(friends, ref)
+		if errors.Is(err, vrc2.ErrAmbiguousDisplayName) {
+			return nil, fmt.Errorf("%s: 同じ表示名のフレンドが複数います。ユーザIDを指定してください", input)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: フレンド一覧に見つかりません", input)
+		}
+		ids = append(ids, f.ID)
+	}
+	return ids, nil
+}
+
+// getUser はユーザの情報を取得する。
+func (c *cli) getUser(ctx context.Context, s session, id string) (vrc2.UserInfo, error) {
+	u, err := c.vrc.GetUserInfo(ctx, id, s.Auth, s.TwoFactorAuth)
+	if err != nil {
+		return vrc2.UserInfo{}, err
+	}
+	// セッションが無効な場合やユーザが存在しない場合は、エラーの内容が返されIDが空になる
+	if u.ID == "" {
+		return vrc2.UserInfo{}, fmt.Errorf("%s: ユーザ情報を取得できませんでした。セッションが無効な場合は vrcnotify login を実行してください", id)
+	}
+	return u, nil
+}
@@ -0,0 +1,122 @@
+// vrcnotify はDiscordを使わずにターミナルでフレンドのプレゼンスを確認するためのCLI
+//
+//	vrcnotify [-session path] [-format text|json] <command> [arguments]
+//
+// コマンド
+//
+//	login              VRChatにログインし、セッションを暗号化して保存する
+//	friends            フレンドの一覧を表示する
+//	whois <user>       ユーザの情報を表示する
+//	watch <user...>    フレンドのプレゼンスの変化を表示し続ける
+//
+// <user> にはユーザページのURL、ユーザID、またはフレンドの表示名を指定する。
+// セッションファイルのパスフレーズは環境変数 VRCNOTIFY_PASSPHRASE で指定でき、指定しない場合は入力を求める。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+	"golang.org/x/time/rate"
+)
+
+// defaultUserAgent はVRChat APIに送信するUser-Agent（環境変数 USER_AGENT で上書きできる）
+const defaultUserAgent = "vrcnotify-cli/1.0 (+https://github.com/aopontann/vrc-join-notify)"
+
+const usage = `使い方: vrcnotify [-session path] [-format text|json] <command> [arguments]
+
+コマンド:
+  login              VRChatにログインし、セッションを暗号化して保存する
+  friends            フレンドの一覧を表示する
+  whois <user>       ユーザの情報を表示する
+  watch <user...>    フレンドのプレゼンスの変化を表示し続ける
+
+<user> にはユーザページのURL、ユーザID、またはフレンドの表示名を指定します。
+
+オプション:
+`
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "vrcnotify:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	sessionPath := flag.String("session", defaultSessionPath(), "セッションを保存するファイル")
+	format := flag.String("format", formatText, "出力形式（text または json）")
+	flag.Parse()
+
+	if *format != formatText && *format != formatJSON {
+		return fmt.Errorf("未対応の出力形式です: %s", *format)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return errors.New("コマンドを指定してください")
+	}
+
+	// 標準出力は結果の出力に使うため、ログは警告以上を標準エラー出力に出す
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := &cli{
+		vrc:         newVRC(),
+		sessionPath: *sessionPath,
+		out:         newPrinter(os.Stdout, *format),
+	}
+
+	args := flag.Args()
+	switch args[0] {
+	case "login":
+		return c.login(ctx, args[1:])
+	case "friends":
+		return c.friends(ctx, args[1:])
+	case "whois":
+		return c.whois(ctx, args[1:])
+	case "watch":
+		return c.watch(ctx, args[1:])
+	}
+	flag.Usage()
+	return fmt.Errorf("未対応のコマンドです: %s", args[0])
+}
+
+// cli はサブコマンドで共有する状態
+type cli struct {
+	vrc         *vrc2.VRC
+	sessionPath string
+	out         *printer
+}
+
+func newVRC() *vrc2.VRC {
+	ua := os.Getenv("USER_AGENT")
+	if ua == "" {
+		ua = defaultUserAgent
+	}
+	v := vrc2.NewVRC(ua)
+	// VRChat APIの利用規約に従い、短時間に大量のリクエストを送らない
+	v.Limiter = rate.NewLimiter(1, 5)
+	return v
+}
+
+func defaultSessionPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "vrcnotify-session.enc"
+	}
+	return filepath.Join(dir, "vrcnotify", "session.enc")
+}
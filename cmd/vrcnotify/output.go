@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+)
+
+// 出力形式
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// printer は結果をテキスト、またはJSON Lines（1行に1つのJSON）で出力する。
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func newPrinter(w io.Writer, format string) *printer {
+	return &printer{w: w, json: format == formatJSON}
+}
+
+// print はJSONの場合は v を、テキストの場合は text を出力する。
+func (p *printer) print(v any, text string) error {
+	if p.json {
+		return json.NewEncoder(p.w).Encode(v)
+	}
+	_, err := fmt.Fprintln(p.w, text)
+	return err
+}
+
+// presence はフレンドのプレゼンス
+type presence struct {
+	ID                string `json:"id"`
+	DisplayName       string `json:"display_name"`
+	State             string `json:"state,omitempty"`
+	Status            string `json:"status"`
+	StatusDescription string `json:"status_description,omitempty"`
+	Location          string `json:"location,omitempty"`
+	Platform          string `json:"platform,omitempty"`
+}
+
+func presenceFromUser(u vrc2.UserInfo) presence {
+	return presence{
+		ID:                u.ID,
+		DisplayName:       u.DisplayName,
+		State:             u.State,
+		Status:            u.Status,
+		StatusDescription: u.StatusDescription,
+		Location:          u.Location,
+		Platform:          u.Platform,
+	}
+}
+
+func presenceFromFriend(f vrc2.Friend) presence {
+	return presence{
+		ID:                f.ID,
+		DisplayName:       f.DisplayName,
+		Status:            f.Status,
+		StatusDescription: f.StatusDescription,
+		Location:          f.Location,
+		Platform:          f.Platform,
+	}
+}
+
+// summary は状態・ステータス・場所を1行にまとめる。
+func (p presence) summary() string {
+	parts := []string{}
+	for _, s := range []string{p.State, p.Status, p.Location} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if p.StatusDescription != "" {
+		parts = append(parts, "「"+p.StatusDescription+"」")
+	}
+	return strings.Join(parts, " ")
+}
+
+// changes は変化した項目の名前を返す。
+func (p presence) changes(prev presence) []string {
+	var c []string
+	if p.DisplayName != prev.DisplayName {
+		c = append(c, "display_name")
+	}
+	if p.State != prev.State {
+		c = append(c, "state")
+	}
+	if p.Status != prev.Status {
+		c = append(c, "status")
+	}
+	if p.StatusDescription != prev.StatusDescription {
+		c = append(c, "status_description")
+	}
+	if p.Location != prev.Location {
+		c = append(c, "location")
+	}
+	if p.Platform != prev.Platform {
+		c = append(c, "platform")
+	}
+	return c
+}
+
+// presenceEvent は watch で出力するプレゼンスの変化
+type presenceEvent struct {
+	Time time.Time `json:"time"`
+	presence
+	// 変化した項目（初回の観測の場合は空）
+	Changes  []string  `json:"changes,omitempty"`
+	Previous *presence `json:"previous,omitempty"`
+}
+
+func (e presenceEvent) text() string {
+	s := e.Time.Format("2006-01-02 15:04:05") + " " + e.DisplayName + ": " + e.summary()
+	if e.Previous != nil {
+		s += "（変化前: " + e.Previous.summary() + "）"
+	}
+	return s
+}
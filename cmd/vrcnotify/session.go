@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aopontann/vrc-join-notify/internal/sessionfile"
+	"golang.org/x/term"
+)
+
+// session はローカルに保存するVRChatのセッション
+type session struct {
+	Auth          string `json:"auth"`
+	TwoFactorAuth string `json:"two_factor_auth"`
+}
+
+// errNotLoggedIn はセッションが保存されていない場合のエラー
+var errNotLoggedIn = errors.New("ログインしていません。vrcnotify login を実行してください")
+
+func (c *cli) loadSession() (session, error) {
+	if _, err := os.Stat(c.sessionPath); errors.Is(err, os.ErrNotExist) {
+		return session{}, errNotLoggedIn
+	}
+
+	passphrase, err := readPassphrase("セッションファイルのパスフレーズ: ")
+	if err != nil {
+		return session{}, err
+	}
+	var s session
+	if err := sessionfile.Load(c.sessionPath, passphrase, &s); err != nil {
+		return session{}, err
+	}
+	return s, nil
+}
+
+func (c *cli) saveSession(s session) error {
+	passphrase, err := readPassphrase("セッションファイルのパスフレーズ（新規）: ")
+	if err != nil {
+		return err
+	}
+	if len(passphrase) == 0 {
+		return errors.New("パスフレーズを入力してください")
+	}
+	return sessionfile.Save(c.sessionPath, passphrase, s)
+}
+
+// readPassphrase は環境変数 VRCNOTIFY_PASSPHRASE、設定されていなければ端末からパスフレーズを読み込む。
+func readPassphrase(prompt string) ([]byte, error) {
+	if p, ok := os.LookupEnv("VRCNOTIFY_PASSPHRASE"); ok {
+		return []byte(p), nil
+	}
+	return readSecret(prompt)
+}
+
+// readSecret は入力内容を表示せずに端末から1行読み込む。
+func readSecret(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		// パイプなどから入力する場合
+		line, err := readLine("")
+		return []byte(line), err
+	}
+	return term.ReadPassword(fd)
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// readLine はプロンプトを表示して標準入力から1行読み込む。
+func readLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,103 @@
+// Package app はエントリポイント（Cloud Functions、cmd/restapi）で共有する依存関係を組み立てる。
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	disc "github.com/aopontann/vrc-join-notify/internal/discord"
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/tracing"
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+	"golang.org/x/time/rate"
+)
+
+// shutdownTimeout はシグナルを受け取ってからリソースの解放を待つ時間
+const shutdownTimeout = 10 * time.Second
+
+// App はリクエストをまたいで使い回すクライアントを保持する。
+type App struct {
+	Config  Config
+	Logger  *slog.Logger
+	DB      *firestore.DB
+	VRC     *vrc2.VRC
+	Discord *disc.Discord
+
+	closers []func(context.Context) error
+}
+
+// New は設定を読み込み、ロガー・Firestore・VRChat・Discordのクライアントを作成する。
+// 設定ファイルのパスは環境変数 CONFIG_FILE で指定する（指定しない場合は環境変数のみを使う）。
+// 作成したロガーはデフォルトのロガーにも設定される。
+// 使い終わったら Close を呼び出す。
+func New(ctx context.Context) (*App, error) {
+	config, err := LoadConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	a := &App{Config: config}
+
+	a.Logger = NewLogger(os.Stdout, a.Config.ProjectID)
+	slog.SetDefault(a.Logger)
+
+	// tracing.exporter = "stdout" でスパンを標準出力に出力できる
+	shutdownTracing, err := tracing.Setup(ctx, a.Config.Tracing.Exporter)
+	if err != nil {
+		return nil, err
+	}
+	a.closers = append(a.closers, shutdownTracing)
+
+	a.DB, err = firestore.NewDB(ctx, a.Config.ProjectID)
+	if err != nil {
+		a.Close(ctx)
+		return nil, err
+	}
+	a.closers = append(a.closers, func(context.Context) error {
+		a.DB.Close()
+		return nil
+	})
+
+	a.Discord, err = disc.New(a.Config.Discord.Token, a.Config.Discord.PublicKey)
+	if err != nil {
+		a.Close(ctx)
+		return nil, err
+	}
+
+	a.VRC = vrc2.NewVRC(a.Config.UserAgent)
+	if rl := a.Config.RateLimit; rl.VRCRequestsPerSecond > 0 {
+		a.VRC.Limiter = rate.NewLimiter(rate.Limit(rl.VRCRequestsPerSecond), rl.VRCBurst)
+	}
+
+	return a, nil
+}
+
+// Close は作成した順とは逆順にリソースを解放する。
+func (a *App) Close(ctx context.Context) error {
+	var errs []error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		errs = append(errs, a.closers[i](ctx))
+	}
+	a.closers = nil
+	return errors.Join(errs...)
+}
+
+// CloseOnSignal は SIGTERM・SIGINT を受け取ったときにリソースを解放してプロセスを終了する。
+// Cloud Functionsのように終了処理を書く場所がないエントリポイントで使う。
+func (a *App) CloseOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-ch
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := a.Close(ctx); err != nil {
+			slog.Error("failed to close resources: " + err.Error())
+		}
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,373 @@
+package app
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/aopontann/vrc-join-notify/internal/notify"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/shard"
+	"github.com/aopontann/vrc-join-notify/internal/tracing"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// StorageFirestore は保存先にFirestoreを使う（現在対応している唯一の保存先）
+const StorageFirestore = "firestore"
+
+// Config はアプリケーションの設定
+// 設定ファイル（TOML）の値を環境変数で上書きできる。
+type Config struct {
+	// HTTPサーバーのポート番号（cmd/restapi のみ）
+	Port string `toml:"port"`
+	// Google CloudのプロジェクトID（Firestoreのデータベース名も兼ねる）
+	ProjectID string `toml:"project_id"`
+	// VRChat APIに送信するUser-Agent
+	UserAgent string `toml:"user_agent"`
+	// 公開しているURL（https://example.com など）カレンダーの購読URLに使う
+	// 空の場合は購読URLを案内しない
+	PublicBaseURL string `toml:"public_base_url"`
+
+	Discord   DiscordConfig   `toml:"discord"`
+	Poll      PollConfig      `toml:"poll"`
+	RateLimit RateLimitConfig `toml:"rate_limit"`
+	Storage   StorageConfig   `toml:"storage"`
+	Rules     RulesConfig     `toml:"rules"`
+	SMTP      SMTPConfig      `toml:"smtp"`
+	Tracing   TracingConfig   `toml:"tracing"`
+	Metrics   MetricsConfig   `toml:"metrics"`
+}
+
+type DiscordConfig struct {
+	// DiscordのBotトークン
+	Token string `toml:"token"`
+	// Discordのインタラクションの署名を検証するための公開鍵
+	// HTTPのインタラクションエンドポイントを使う場合のみ必要（Gatewayでは不要）
+	PublicKey string `toml:"public_key"`
+	// 管理コマンド（/admin）を実行できるボットの所有者のDiscordユーザID
+	OwnerIDs []string `toml:"owner_ids"`
+}
+
+type PollConfig struct {
+	// 通知処理を実行する間隔（cmd/restapi のみ）
+	// 0の場合は実行せず、スケジューラから /notify を呼び出す
+	Interval Duration `toml:"interval"`
+	// 通知処理のロックの有効期限（0の場合はロックしない）
+	// 前回の実行が終わる前に次の実行が始まっても、同じ通知を重複して送信しないようにする
+	LockTTL Duration `toml:"lock_ttl"`
+	// このインスタンスが処理するユーザのシャード（"1/4" など、空の場合は全てのユーザ）
+	// 複数のインスタンスで分担する場合に指定する
+	Shard shard.Shard `toml:"shard"`
+}
+
+type RateLimitConfig struct {
+	// VRChat APIの1秒あたりの呼び出し回数の上限（0の場合は制限しない）
+	VRCRequestsPerSecond float64 `toml:"vrc_requests_per_second"`
+	// 上限を超えて一度に呼び出せる回数
+	VRCBurst int `toml:"vrc_burst"`
+}
+
+type StorageConfig struct {
+	// 保存先（firestore のみ）
+	Backend string `toml:"backend"`
+}
+
+type RulesConfig struct {
+	// 通知対象に登録できるフレンドの最大人数
+	MaxWatchTargets int `toml:"max_watch_targets"`
+	// ダイジェストでタイムゾーンが指定されなかった場合に使うタイムゾーン
+	DefaultTimezone string `toml:"default_timezone"`
+	// 送信に失敗した通知を再送する期間
+	DeliveryRetryWindow Duration `toml:"delivery_retry_window"`
+}
+
+type SMTPConfig struct {
+	// メールの通知に使うSMTPサーバー（空の場合はメールの通知を使えない）
+	Host string `toml:"host"`
+	Port string `toml:"port"`
+	// 認証に使うユーザ名とパスワード（ユーザ名が空の場合は認証しない）
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// 送信元のメールアドレス
+	From string `toml:"from"`
+}
+
+type TracingConfig struct {
+	// トレースの出力先（空の場合は出力しない、stdout、otlp）
+	// otlp の送信先は OTEL_EXPORTER_OTLP_ENDPOINT などの標準の環境変数で指定する
+	Exporter string `toml:"exporter"`
+}
+
+type MetricsConfig struct {
+	// /metrics を公開するアドレス（"127.0.0.1:9090" など、空の場合は公開しない）
+	// 公開しているポートとは別に待ち受け、外部からメトリクスを参照できないようにする
+	Addr string `toml:"addr"`
+}
+
+// Settings はハンドラに渡す、通知ルールの既定値と通知の送信に使う設定を返す。
+func (c Config) Settings() rule.Settings {
+	s := c.Rules.Settings()
+	s.PublicBaseURL = strings.TrimSuffix(c.PublicBaseURL, "/")
+	s.SMTP = notify.SMTPServer{
+		Host:     c.SMTP.Host,
+		Port:     c.SMTP.Port,
+		Username: c.SMTP.Username,
+		Password: c.SMTP.Password,
+		From:     c.SMTP.From,
+	}
+	return s
+}
+
+// Settings は通知ルールの既定値を返す。
+func (c RulesConfig) Settings() rule.Settings {
+	return rule.Settings{
+		MaxWatchTargets:     c.MaxWatchTargets,
+		DefaultTimezone:     c.DefaultTimezone,
+		DeliveryRetryWindow: c.DeliveryRetryWindow.Duration,
+	}
+}
+
+// Duration は "1m30s" のような文字列で指定する時間
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// DefaultConfig は設定ファイルや環境変数で指定されなかった場合の既定値を返す。
+func DefaultConfig() Config {
+	settings := rule.DefaultSettings()
+	return Config{
+		Port: "8080",
+		Poll: PollConfig{
+			LockTTL: Duration{5 * time.Minute},
+		},
+		RateLimit: RateLimitConfig{
+			VRCRequestsPerSecond: 1,
+			VRCBurst:             5,
+		},
+		Storage: StorageConfig{
+			Backend: StorageFirestore,
+		},
+		SMTP: SMTPConfig{
+			Port: "587",
+		},
+		Rules: RulesConfig{
+			MaxWatchTargets:     settings.MaxWatchTargets,
+			DefaultTimezone:     settings.DefaultTimezone,
+			DeliveryRetryWindow: Duration{settings.DeliveryRetryWindow},
+		},
+	}
+}
+
+// LoadConfig は既定値に設定ファイル（path が空の場合は読み込まない）と環境変数の値を順に上書きし、検証する。
+func LoadConfig(path string) (Config, error) {
+	c := DefaultConfig()
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("config: %w", err)
+		}
+		if err := toml.Unmarshal(b, &c); err != nil {
+			return Config{}, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+
+	if err := c.overlayEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// overlayEnv は設定されている環境変数の値で設定を上書きする。
+func (c *Config) overlayEnv() error {
+	strs := map[string]*string{
+		"PORT":               &c.Port,
+		"PROJECT_ID":         &c.ProjectID,
+		"USER_AGENT":         &c.UserAgent,
+		"DISCORD_TOKEN":      &c.Discord.Token,
+		"DISCORD_PUBLIC_KEY": &c.Discord.PublicKey,
+		"STORAGE_BACKEND":    &c.Storage.Backend,
+		"DEFAULT_TIMEZONE":   &c.Rules.DefaultTimezone,
+		"PUBLIC_BASE_URL":    &c.PublicBaseURL,
+		"SMTP_HOST":          &c.SMTP.Host,
+		"SMTP_PORT":          &c.SMTP.Port,
+		"SMTP_USERNAME":      &c.SMTP.Username,
+		"SMTP_PASSWORD":      &c.SMTP.Password,
+		"SMTP_FROM":          &c.SMTP.From,
+		"TRACE_EXPORTER":     &c.Tracing.Exporter,
+		"METRICS_ADDR":       &c.Metrics.Addr,
+	}
+	for key, p := range strs {
+		if v, ok := os.LookupEnv(key); ok {
+			*p = v
+		}
+	}
+
+	var errs []error
+	if v, ok := os.LookupEnv("POLL_INTERVAL"); ok {
+		if err := c.Poll.Interval.UnmarshalText([]byte(v)); err != nil {
+			errs = append(errs, fmt.Errorf("config: POLL_INTERVAL: %w", err))
+		}
+	}
+	if v, ok := os.LookupEnv("POLL_LOCK_TTL"); ok {
+		if err := c.Poll.LockTTL.UnmarshalText([]byte(v)); err != nil {
+			errs = append(errs, fmt.Errorf("config: POLL_LOCK_TTL: %w", err))
+		}
+	}
+	if v, ok := os.LookupEnv("POLL_SHARD"); ok {
+		if err := c.Poll.Shard.UnmarshalText([]byte(v)); err != nil {
+			errs = append(errs, fmt.Errorf("config: POLL_SHARD: %w", err))
+		}
+	}
+	if v, ok := os.LookupEnv("DELIVERY_RETRY_WINDOW"); ok {
+		if err := c.Rules.DeliveryRetryWindow.UnmarshalText([]byte(v)); err != nil {
+			errs = append(errs, fmt.Errorf("config: DELIVERY_RETRY_WINDOW: %w", err))
+		}
+	}
+	if v, ok := os.LookupEnv("VRC_RATE_LIMIT"); ok {
+		if f, err := strconv.ParseFloat(v, 64); err != nil {
+			errs = append(errs, fmt.Errorf("config: VRC_RATE_LIMIT: %w", err))
+		} else {
+			c.RateLimit.VRCRequestsPerSecond = f
+		}
+	}
+	if v, ok := os.LookupEnv("VRC_RATE_BURST"); ok {
+		if n, err := strconv.Atoi(v); err != nil {
+			errs = append(errs, fmt.Errorf("config: VRC_RATE_BURST: %w", err))
+		} else {
+			c.RateLimit.VRCBurst = n
+		}
+	}
+	if v, ok := os.LookupEnv("DISCORD_OWNER_IDS"); ok {
+		// カンマ区切りで複数指定できる
+		c.Discord.OwnerIDs = nil
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				c.Discord.OwnerIDs = append(c.Discord.OwnerIDs, id)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("MAX_WATCH_TARGETS"); ok {
+		if n, err := strconv.Atoi(v); err != nil {
+			errs = append(errs, fmt.Errorf("config: MAX_WATCH_TARGETS: %w", err))
+		} else {
+			c.Rules.MaxWatchTargets = n
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate は必須の設定が指定されているか、値が正しい範囲にあるかを確認する。
+// 問題が複数ある場合は全てまとめて返す。
+func (c Config) Validate() error {
+	var errs []error
+	required := []struct {
+		value string
+		name  string
+		env   string
+	}{
+		{c.ProjectID, "project_id", "PROJECT_ID"},
+		{c.UserAgent, "user_agent", "USER_AGENT"},
+		{c.Discord.Token, "discord.token", "DISCORD_TOKEN"},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			errs = append(errs, fmt.Errorf("config: %s (%s) is required", r.name, r.env))
+		}
+	}
+
+	for _, id := range c.Discord.OwnerIDs {
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			errs = append(errs, fmt.Errorf("config: discord.owner_ids %q is not a Discord user ID", id))
+		}
+	}
+	if c.Storage.Backend != StorageFirestore {
+		errs = append(errs, fmt.Errorf("config: storage.backend %q is not supported (supported: %s)", c.Storage.Backend, StorageFirestore))
+	}
+	if c.Poll.Interval.Duration < 0 {
+		errs = append(errs, errors.New("config: poll.interval must not be negative"))
+	}
+	// ロックの延長は有効期限の 1/3 ごとに行うため、短すぎる値は受け付けない
+	if ttl := c.Poll.LockTTL.Duration; ttl != 0 && ttl < 10*time.Second {
+		errs = append(errs, errors.New("config: poll.lock_ttl must be 0 or at least 10s"))
+	}
+	if err := c.Poll.Shard.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("config: poll.shard: %w", err))
+	}
+	if c.RateLimit.VRCRequestsPerSecond < 0 {
+		errs = append(errs, errors.New("config: rate_limit.vrc_requests_per_second must not be negative"))
+	}
+	if c.RateLimit.VRCRequestsPerSecond > 0 && c.RateLimit.VRCBurst < 1 {
+		errs = append(errs, errors.New("config: rate_limit.vrc_burst must be at least 1"))
+	}
+	if c.Rules.MaxWatchTargets < 1 {
+		errs = append(errs, errors.New("config: rules.max_watch_targets must be at least 1"))
+	}
+	if c.Rules.DeliveryRetryWindow.Duration <= 0 {
+		errs = append(errs, errors.New("config: rules.delivery_retry_window must be positive"))
+	}
+	if _, err := time.LoadLocation(c.Rules.DefaultTimezone); err != nil || c.Rules.DefaultTimezone == "" {
+		errs = append(errs, fmt.Errorf("config: rules.default_timezone %q is not a valid timezone", c.Rules.DefaultTimezone))
+	}
+	if c.PublicBaseURL != "" {
+		u, err := url.Parse(c.PublicBaseURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("config: public_base_url %q must be an http(s) URL", c.PublicBaseURL))
+		}
+	}
+	// SMTPサーバーを設定する場合は、ポート番号と送信元が正しいことを確認する
+	if c.SMTP.Host != "" {
+		if port, err := strconv.ParseUint(c.SMTP.Port, 10, 16); err != nil || port == 0 {
+			errs = append(errs, fmt.Errorf("config: smtp.port %q is not a valid port number", c.SMTP.Port))
+		}
+		if addr, err := mail.ParseAddress(c.SMTP.From); err != nil || addr.Address != c.SMTP.From {
+			errs = append(errs, fmt.Errorf("config: smtp.from %q is not a valid email address", c.SMTP.From))
+		}
+	}
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("config: tracing.exporter %q is not supported (supported: %s, %s)", c.Tracing.Exporter, tracing.ExporterStdout, tracing.ExporterOTLP))
+	}
+	if c.Metrics.Addr != "" {
+		if _, port, err := net.SplitHostPort(c.Metrics.Addr); err != nil || port == "" {
+			errs = append(errs, fmt.Errorf("config: metrics.addr %q must be host:port", c.Metrics.Addr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateInteractionEndpoint はHTTPのインタラクションエンドポイントに必要な設定が指定されているかを確認する。
+func (c Config) ValidateInteractionEndpoint() error {
+	if c.Discord.PublicKey == "" {
+		return errors.New("config: discord.public_key (DISCORD_PUBLIC_KEY) is required for the interactions endpoint")
+	}
+	if _, err := hex.DecodeString(c.Discord.PublicKey); err != nil {
+		return fmt.Errorf("config: discord.public_key must be hex encoded: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configEnvs は設定を上書きする環境変数
+var configEnvs = []string{
+	"PORT", "PROJECT_ID", "USER_AGENT", "DISCORD_TOKEN", "DISCORD_PUBLIC_KEY",
+	"STORAGE_BACKEND", "DEFAULT_TIMEZONE", "POLL_INTERVAL", "VRC_RATE_LIMIT", "VRC_RATE_BURST", "MAX_WATCH_TARGETS",
+	"DISCORD_OWNER_IDS", "POLL_LOCK_TTL", "POLL_SHARD",
+	"DELIVERY_RETRY_WINDOW", "PUBLIC_BASE_URL", "TRACE_EXPORTER", "METRICS_ADDR",
+	"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "SMTP_FROM",
+}
+
+// clearConfigEnv はテストの実行環境の環境変数が設定に影響しないようにする。
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range configEnvs {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const validConfig = `
+project_id = "my-project"
+user_agent = "test/1.0"
+public_base_url = "https://example.com/"
+
+[discord]
+token = "file-token"
+public_key = "abcd"
+owner_ids = ["123456789012345678"]
+
+[poll]
+interval = "1m30s"
+shard = "1/4"
+
+[rate_limit]
+vrc_requests_per_second = 2.5
+vrc_burst = 3
+
+[rules]
+max_watch_targets = 5
+delivery_retry_window = "6h"
+
+[smtp]
+host = "smtp.example.com"
+username = "bot"
+password = "secret"
+from = "bot@example.com"
+
+[tracing]
+exporter = "stdout"
+`
+
+func TestLoadConfig(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("DISCORD_TOKEN", "env-token")
+	t.Setenv("PORT", "9090")
+
+	c, err := LoadConfig(writeConfig(t, validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ProjectID != "my-project" {
+		t.Errorf("ProjectID = %q, want my-project", c.ProjectID)
+	}
+	// 環境変数の値が優先される
+	if c.Discord.Token != "env-token" {
+		t.Errorf("Discord.Token = %q, want env-token", c.Discord.Token)
+	}
+	if c.Port != "9090" {
+		t.Errorf("Port = %q, want 9090", c.Port)
+	}
+	if c.Poll.Interval.Duration != 90*time.Second {
+		t.Errorf("Poll.Interval = %v, want 1m30s", c.Poll.Interval)
+	}
+	if c.Poll.Shard.Index != 1 || c.Poll.Shard.Count != 4 {
+		t.Errorf("Poll.Shard = %+v, want 1/4", c.Poll.Shard)
+	}
+	if c.RateLimit.VRCRequestsPerSecond != 2.5 || c.RateLimit.VRCBurst != 3 {
+		t.Errorf("RateLimit = %+v", c.RateLimit)
+	}
+	if len(c.Discord.OwnerIDs) != 1 || c.Discord.OwnerIDs[0] != "123456789012345678" {
+		t.Errorf("Discord.OwnerIDs = %v", c.Discord.OwnerIDs)
+	}
+	if c.Rules.MaxWatchTargets != 5 {
+		t.Errorf("Rules.MaxWatchTargets = %d, want 5", c.Rules.MaxWatchTargets)
+	}
+	settings := c.Settings()
+	if settings.DeliveryRetryWindow != 6*time.Hour {
+		t.Errorf("Settings().DeliveryRetryWindow = %v, want 6h", settings.DeliveryRetryWindow)
+	}
+	if settings.PublicBaseURL != "https://example.com" {
+		t.Errorf("Settings().PublicBaseURL = %q, want https://example.com", settings.PublicBaseURL)
+	}
+	if !settings.SMTP.Enabled() || settings.SMTP.Host != "smtp.example.com" || settings.SMTP.From != "bot@example.com" {
+		t.Errorf("Settings().SMTP = %+v", settings.SMTP)
+	}
+	if c.Tracing.Exporter != "stdout" {
+		t.Errorf("Tracing.Exporter = %q, want stdout", c.Tracing.Exporter)
+	}
+	// ファイルで指定しなかった値は既定値になる
+	if c.Storage.Backend != StorageFirestore {
+		t.Errorf("Storage.Backend = %q, want %s", c.Storage.Backend, StorageFirestore)
+	}
+	if c.Rules.DefaultTimezone != "Asia/Tokyo" {
+		t.Errorf("Rules.DefaultTimezone = %q, want Asia/Tokyo", c.Rules.DefaultTimezone)
+	}
+	if c.Poll.LockTTL.Duration != 5*time.Minute {
+		t.Errorf("Poll.LockTTL = %v, want 5m", c.Poll.LockTTL)
+	}
+	if c.SMTP.Port != "587" {
+		t.Errorf("SMTP.Port = %q, want 587", c.SMTP.Port)
+	}
+}
+
+func TestLoadConfigEnvOnly(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("PROJECT_ID", "p")
+	t.Setenv("USER_AGENT", "ua")
+	t.Setenv("DISCORD_TOKEN", "t")
+	t.Setenv("DISCORD_PUBLIC_KEY", "k")
+	t.Setenv("POLL_INTERVAL", "30s")
+	t.Setenv("DISCORD_OWNER_IDS", "111, 222,")
+	t.Setenv("POLL_LOCK_TTL", "0s")
+	t.Setenv("POLL_SHARD", "0/2")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", "2525")
+	t.Setenv("SMTP_FROM", "bot@example.com")
+	t.Setenv("TRACE_EXPORTER", "otlp")
+	t.Setenv("METRICS_ADDR", "127.0.0.1:9090")
+
+	c, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SMTP.Host != "smtp.example.com" || c.SMTP.Port != "2525" || c.SMTP.From != "bot@example.com" {
+		t.Errorf("SMTP = %+v", c.SMTP)
+	}
+	if c.Tracing.Exporter != "otlp" {
+		t.Errorf("Tracing.Exporter = %q, want otlp", c.Tracing.Exporter)
+	}
+	if c.Metrics.Addr != "127.0.0.1:9090" {
+		t.Errorf("Metrics.Addr = %q, want 127.0.0.1:9090", c.Metrics.Addr)
+	}
+	if c.Settings().PublicBaseURL != "" {
+		t.Errorf("Settings().PublicBaseURL = %q, want empty", c.Settings().PublicBaseURL)
+	}
+	if strings.Join(c.Discord.OwnerIDs, ",") != "111,222" {
+		t.Errorf("Discord.OwnerIDs = %v, want [111 222]", c.Discord.OwnerIDs)
+	}
+	if c.Port != "8080" {
+		t.Errorf("Port = %q, want 8080", c.Port)
+	}
+	if c.Poll.Interval.Duration != 30*time.Second {
+		t.Errorf("Poll.Interval = %v, want 30s", c.Poll.Interval)
+	}
+	if c.Poll.LockTTL.Duration != 0 {
+		t.Errorf("Poll.LockTTL = %v, want 0", c.Poll.LockTTL)
+	}
+	if c.Poll.Shard.String() != "0/2" {
+		t.Errorf("Poll.Shard = %q, want 0/2", c.Poll.Shard)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		want    []string
+	}{
+		{
+			name:    "missing required",
+			content: `project_id = "p"`,
+			want:    []string{"user_agent (USER_AGENT) is required", "discord.token (DISCORD_TOKEN) is required"},
+		},
+		{
+			name:    "unsupported storage",
+			content: validConfig + "\n[storage]\nbackend = \"postgres\"\n",
+			want:    []string{`storage.backend "postgres" is not supported`},
+		},
+		{
+			name:    "invalid timezone",
+			content: validConfig,
+			env:     map[string]string{"DEFAULT_TIMEZONE": "Mars/Olympus"},
+			want:    []string{`rules.default_timezone "Mars/Olympus"`},
+		},
+		{
+			name:    "invalid owner id",
+			content: validConfig,
+			env:     map[string]string{"DISCORD_OWNER_IDS": "owner"},
+			want:    []string{`discord.owner_ids "owner"`},
+		},
+		{
+			name:    "short lock ttl",
+			content: validConfig,
+			env:     map[string]string{"POLL_LOCK_TTL": "1s"},
+			want:    []string{"poll.lock_ttl"},
+		},
+		{
+			name:    "invalid shard",
+			content: validConfig,
+			env:     map[string]string{"POLL_SHARD": "4/4"},
+			want:    []string{"POLL_SHARD"},
+		},
+		{
+			name:    "non-positive retry window",
+			content: validConfig,
+			env:     map[string]string{"DELIVERY_RETRY_WINDOW": "0s"},
+			want:    []string{"rules.delivery_retry_window"},
+		},
+		{
+			name:    "invalid env number",
+			content: validConfig,
+			env:     map[string]string{"VRC_RATE_BURST": "many"},
+			want:    []string{"VRC_RATE_BURST"},
+		},
+		{
+			name:    "invalid public base url",
+			content: validConfig,
+			env:     map[string]string{"PUBLIC_BASE_URL": "example.com"},
+			want:    []string{"public_base_url"},
+		},
+		{
+			name:    "invalid smtp",
+			content: validConfig,
+			env:     map[string]string{"SMTP_PORT": "smtp", "SMTP_FROM": "Bot <bot@example.com>"},
+			want:    []string{"smtp.port", "smtp.from"},
+		},
+		{
+			name:    "unsupported trace exporter",
+			content: validConfig,
+			env:     map[string]string{"TRACE_EXPORTER": "jaeger"},
+			want:    []string{`tracing.exporter "jaeger"`},
+		},
+		{
+			name:    "metrics address without port",
+			content: validConfig,
+			env:     map[string]string{"METRICS_ADDR": "localhost"},
+			want:    []string{`metrics.addr "localhost"`},
+		},
+		{
+			name:    "invalid duration",
+			content: `[poll]` + "\n" + `interval = "soon"`,
+			want:    []string{"config.toml"},
+		},
+		{
+			name:    "invalid toml",
+			content: `project_id = `,
+			want:    []string{"config.toml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := LoadConfig(writeConfig(t, tt.content))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOverlayEnvInvalidNumber(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("VRC_RATE_LIMIT", "fast")
+	t.Setenv("VRC_RATE_BURST", "many")
+	t.Setenv("MAX_WATCH_TARGETS", "ten")
+
+	c := DefaultConfig()
+	err := c.overlayEnv()
+	for _, want := range []string{"VRC_RATE_LIMIT", "VRC_RATE_BURST", "MAX_WATCH_TARGETS"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not contain %q", err, want)
+		}
+	}
+	// 解析できなかった値で既定値を上書きしない
+	if c.RateLimit != DefaultConfig().RateLimit || c.Rules.MaxWatchTargets != DefaultConfig().Rules.MaxWatchTargets {
+		t.Errorf("config was overwritten: %+v %+v", c.RateLimit, c.Rules)
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	clearConfigEnv(t)
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestValidateInteractionEndpoint(t *testing.T) {
+	tests := []struct {
+		publicKey string
+		wantErr   bool
+	}{
+		{"abcd", false},
+		{"", true},
+		{"not-hex", true},
+	}
+	for _, tt := range tests {
+		c := DefaultConfig()
+		c.Discord.PublicKey = tt.publicKey
+		if err := c.ValidateInteractionEndpoint(); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateInteractionEndpoint(%q) error = %v, wantErr %v", tt.publicKey, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/aopontann/vrc-join-notify/internal/tracing"
+)
+
+// NewLogger はCloud Loggingの構造化ログの形式でJSONを出力するロガーを作成する。
+// ログにはトレースIDが付与され、Cloud Loggingでトレースと関連付けられる。
+func NewLogger(w io.Writer, projectID string) *slog.Logger {
+	ops := slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey {
+				a.Key = "severity"
+				level := a.Value.Any().(slog.Level)
+				if level == slog.LevelWarn {
+					a.Value = slog.StringValue("WARNING")
+				}
+			}
+
+			return a
+		},
+	}
+	return slog.New(tracing.NewLogHandler(slog.NewJSONHandler(w, &ops), projectID))
+}
@@ -0,0 +1,39 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(*slog.Logger)
+		want string
+	}{
+		{"debug", func(l *slog.Logger) { l.Debug("m") }, "DEBUG"},
+		{"info", func(l *slog.Logger) { l.Info("m") }, "INFO"},
+		{"warn", func(l *slog.Logger) { l.Warn("m") }, "WARNING"},
+		{"error", func(l *slog.Logger) { l.Error("m") }, "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(NewLogger(&buf, "my-project"))
+
+			var got map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got["severity"] != tt.want {
+				t.Errorf("severity = %v, want %s", got["severity"], tt.want)
+			}
+			if got["level"] != nil {
+				t.Errorf("level should be renamed to severity, got %v", got["level"])
+			}
+		})
+	}
+}
@@ -1,11 +1,12 @@
 package discord
 
 import (
+	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
-	"os"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -15,23 +16,28 @@ type Discord struct {
 	publicKey string
 }
 
-func New() (*Discord, error) {
-	discord, err := discordgo.New("Bot " + os.Getenv("DISCORD_TOKEN"))
+// New はBotトークンとインタラクションの署名を検証するための公開鍵からクライアントを作成する。
+func New(token string, publicKey string) (*Discord, error) {
+	discord, err := discordgo.New("Bot " + token)
 	if err != nil {
 		return nil, err
 	}
 	return &Discord{
 		Session:   discord,
-		publicKey: os.Getenv("DISCORD_PUBLIC_KEY"),
+		publicKey: publicKey,
 	}, nil
 }
 
 func (d *Discord) VerifyInteraction(r *http.Request) (bool, error) {
 	publicKeyBytes, err := hex.DecodeString(d.publicKey)
 	if err != nil {
-		slog.Error("Error decoding hex string: " + err.Error())
+		slog.ErrorContext(r.Context(), "Error decoding hex string: "+err.Error())
 		return false, err
 	}
+	// 鍵の長さが異なると検証時にパニックするため、先に確認する
+	if len(publicKeyBytes) != ed25519.PublicKeySize {
+		return false, errors.New("invalid discord public key size")
+	}
 
 	return discordgo.VerifyInteraction(r, publicKeyBytes), nil
 }
@@ -51,30 +57,35 @@ func (d *Discord) GetEventInfo(b []byte) (int, string, string, *InteractionData,
 	}
 
 	if eventBody.Type == 1 && eventBody.Event.Type != "" {
-		// アプリをインストールしたユーザのID
+		// イベントの対象となったユーザのID
 		uid := eventBody.Event.Data.User.ID
-		return ApplicationInstall, uid, "", nil, nil
-	}
 
-	if eventBody.Type == 2 {
-		uid := eventBody.Event.Data.User.ID
+		switch eventBody.Event.Type {
+		case EventApplicationAuthorized:
+			// インストール先が含まれない場合は、どちらの案内を送ればよいか分からないため未対応のイベントとして扱う
+			it := eventBody.Event.Data.IntegrationType
+			switch {
+			case it == nil:
+				return UnsupportedEvent, uid, "", nil, nil
+			case *it == IntegrationGuildInstall:
+				return GuildInstall, uid, "", nil, nil
+			case *it == IntegrationUserInstall:
+				return ApplicationInstall, uid, "", nil, nil
+			}
+			return UnsupportedEvent, uid, "", nil, nil
+		case EventApplicationDeauthorized:
+			return ApplicationUninstall, uid, "", nil, nil
+		default:
+			return UnsupportedEvent, uid, "", nil, nil
+		}
+	}
 
+	if eventBody.Type == 2 || eventBody.Type == 3 || eventBody.Type == 4 {
 		var interaction discordgo.Interaction
 		if err := json.Unmarshal(b, &interaction); err != nil {
 			return InternalError, "", "", nil, err
 		}
-		var data InteractionData
-		// discordgo.Interaction.Data に Name などのフィールドがないため、[]byteに変換して自作の構造体にマッピングする
-		jsonData, err := json.Marshal(interaction.Data)
-		if err != nil {
-			return InternalError, "", "", nil, err
-		}
-		if err := json.Unmarshal(jsonData, &data); err != nil {
-			return InternalError, "", "", nil, err
-		}
-
-		cid := interaction.ChannelID
-		return SlashCommand, uid, cid, &data, nil
+		return ParseInteraction(&interaction)
 	}
 
 	// このリターンにたどり着くことはないが、エラーが表示されるため実装
@@ -90,3 +101,40 @@ func (d *Discord) ChannelMessageSend(cid string, content string) (*discordgo.Mes
 	m, err := d.Session.ChannelMessageSend(cid, content)
 	return m, err
 }
+
+// ParseInteraction はスラッシュコマンド・オートコンプリート・ボタンのインタラクションから、
+// イベントタイプ、実行したユーザのID、チャンネルID、コマンドの内容を取り出す。
+// Gatewayで受け取ったインタラクションにも使う。
+func ParseInteraction(i *discordgo.Interaction) (int, string, string, *InteractionData, error) {
+	// DMではUser、サーバー内ではMemberにコマンドを実行したユーザの情報が入る
+	var uid string
+	if i.User != nil {
+		uid = i.User.ID
+	} else if i.Member != nil && i.Member.User != nil {
+		uid = i.Member.User.ID
+	}
+	var data InteractionData
+	// discordgo.Interaction.Data に Name などのフィールドがないため、[]byteに変換して自作の構造体にマッピングする
+	jsonData, err := json.Marshal(i.Data)
+	if err != nil {
+		return InternalError, "", "", nil, err
+	}
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return InternalError, "", "", nil, err
+	}
+
+	data.GuildID = i.GuildID
+	data.Locale = string(i.Locale)
+	if i.Member != nil {
+		data.MemberPermissions = i.Member.Permissions
+	}
+
+	cid := i.ChannelID
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		return Autocomplete, uid, cid, &data, nil
+	}
+	if i.Type == discordgo.InteractionMessageComponent {
+		return MessageComponent, uid, cid, &data, nil
+	}
+	return SlashCommand, uid, cid, &data, nil
+}
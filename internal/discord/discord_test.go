@@ -1,20 +1,31 @@
 package discord
 
 import (
+	"os"
 	"testing"
 
 	"github.com/joho/godotenv"
 )
 
+// live は .env.dev を読み込めた場合に true になり、Discord API を呼び出すテストを実行する
+var live bool
+
 func TestMain(m *testing.M) {
-	if err := godotenv.Load("../../.env.dev"); err != nil {
-		panic(err)
-	}
+	live = godotenv.Load("../../.env.dev") == nil
 	m.Run()
 }
 
+// requireLive は .env.dev がない場合（CIなど）に Discord API を呼び出すテストをスキップする。
+func requireLive(t *testing.T) {
+	t.Helper()
+	if !live {
+		t.Skip("../../.env.dev not found")
+	}
+}
+
 func TestChannelMessageSend(t *testing.T) {
-	discord, err := New()
+	requireLive(t)
+	discord, err := New(os.Getenv("DISCORD_TOKEN"), os.Getenv("DISCORD_PUBLIC_KEY"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -28,3 +39,86 @@ func TestChannelMessageSend(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestGetEventInfo(t *testing.T) {
+	webhook := func(eventType string, data string) string {
+		return `{"version":1,"application_id":"1","type":1,"event":{"type":"` + eventType + `","timestamp":"2025-01-01T00:00:00Z","data":` + data + `}}`
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		eventType int
+		userID    string
+		wantErr   bool
+	}{
+		{name: "webhook ping", body: `{"version":1,"application_id":"1","type":0}`, eventType: WebhooksResist},
+		{name: "interaction ping", body: `{"type":1}`, eventType: InteractionsEndpointResist},
+		{name: "user install", body: webhook(EventApplicationAuthorized, `{"integration_type":1,"user":{"id":"100"}}`), eventType: ApplicationInstall, userID: "100"},
+		{name: "guild install", body: webhook(EventApplicationAuthorized, `{"integration_type":0,"user":{"id":"100"}}`), eventType: GuildInstall, userID: "100"},
+		{name: "missing integration type", body: webhook(EventApplicationAuthorized, `{"user":{"id":"100"}}`), eventType: UnsupportedEvent, userID: "100"},
+		{name: "unknown integration type", body: webhook(EventApplicationAuthorized, `{"integration_type":2,"user":{"id":"100"}}`), eventType: UnsupportedEvent, userID: "100"},
+		{name: "deauthorized", body: webhook(EventApplicationDeauthorized, `{"user":{"id":"100"}}`), eventType: ApplicationUninstall, userID: "100"},
+		{name: "unsupported event", body: webhook(EventEntitlementCreate, `{}`), eventType: UnsupportedEvent},
+		{name: "invalid json", body: `{`, eventType: InternalError, wantErr: true},
+	}
+
+	d := &Discord{}
+	for _, tt := range tests {
+		eventType, userID, _, _, err := d.GetEventInfo([]byte(tt.body))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if eventType != tt.eventType || userID != tt.userID {
+			t.Errorf("%s: got (%d, %q), want (%d, %q)", tt.name, eventType, userID, tt.eventType, tt.userID)
+		}
+	}
+}
+
+func TestGetEventInfoInteraction(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		eventType int
+		userID    string
+		channelID string
+		command   string
+	}{
+		{
+			name:      "slash command in DM",
+			body:      `{"type":2,"channel_id":"200","user":{"id":"100"},"locale":"ja","data":{"id":"1","name":"join","type":1}}`,
+			eventType: SlashCommand, userID: "100", channelID: "200", command: "join",
+		},
+		{
+			name:      "slash command in guild",
+			body:      `{"type":2,"channel_id":"200","guild_id":"300","member":{"user":{"id":"100"},"permissions":"8"},"data":{"id":"1","name":"settings","type":1}}`,
+			eventType: SlashCommand, userID: "100", channelID: "200", command: "settings",
+		},
+		{
+			name:      "autocomplete",
+			body:      `{"type":4,"channel_id":"200","user":{"id":"100"},"data":{"id":"1","name":"join","type":1}}`,
+			eventType: Autocomplete, userID: "100", channelID: "200", command: "join",
+		},
+		{
+			name:      "button",
+			body:      `{"type":3,"channel_id":"200","user":{"id":"100"},"data":{"custom_id":"account.delete.cancel:100","component_type":2}}`,
+			eventType: MessageComponent, userID: "100", channelID: "200",
+		},
+	}
+
+	d := &Discord{}
+	for _, tt := range tests {
+		eventType, userID, channelID, data, err := d.GetEventInfo([]byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if eventType != tt.eventType || userID != tt.userID || channelID != tt.channelID {
+			t.Errorf("%s: got (%d, %q, %q), want (%d, %q, %q)", tt.name, eventType, userID, channelID, tt.eventType, tt.userID, tt.channelID)
+		}
+		if data == nil || data.Name != tt.command {
+			t.Errorf("%s: data = %+v, want command %q", tt.name, data, tt.command)
+		}
+	}
+}
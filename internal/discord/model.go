@@ -1,27 +1,92 @@
 package discord
 
+import "encoding/json"
+
 const (
 	WebhooksResist             = 0 // Webhooks登録時のイベント
 	InteractionsEndpointResist = 1 // Interactions Endpoint URL登録時のイベント
 	ApplicationInstall         = 2 // アプリをインストールしたときのイベント
 	SlashCommand               = 3 // スラッシュコマンドの実行時のイベント
 	InternalError              = 4
+	ApplicationUninstall       = 5 // アプリをアンインストール（認可を取り消し）したときのイベント
+	UnsupportedEvent           = 6 // 未対応のWebhookイベント
+	Autocomplete               = 7 // スラッシュコマンドのオプション入力中の補完イベント
+	GuildInstall               = 8 // アプリをサーバーにインストールしたときのイベント
+	MessageComponent           = 9 // メッセージのボタンを押したときのイベント
+)
+
+// アプリのインストール先
+// https://discord.com/developers/docs/resources/application#application-object-application-integration-types
+const (
+	IntegrationGuildInstall = 0
+	IntegrationUserInstall  = 1
+)
+
+// Webhookイベントの種類
+// https://discord.com/developers/docs/events/webhook-events#event-types
+const (
+	EventApplicationAuthorized   = "APPLICATION_AUTHORIZED"
+	EventApplicationDeauthorized = "APPLICATION_DEAUTHORIZED"
+	EventEntitlementCreate       = "ENTITLEMENT_CREATE"
+	EventQuestUserEnrollment     = "QUEST_USER_ENROLLMENT"
 )
 
 type InteractionData struct {
-	GuildID string `json:"guild_id"`
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Options []struct {
-		Name    string `json:"name"`
-		Options []struct {
-			Name  string `json:"name"`
-			Type  int    `json:"type"`
-			Value string `json:"value"`
-		} `json:"options"`
-		Type int `json:"type"`
-	} `json:"options"`
-	Type int `json:"type"`
+	GuildID string              `json:"guild_id"`
+	ID      string              `json:"id"`
+	Name    string              `json:"name"`
+	Options []InteractionOption `json:"options"`
+	Type    int                 `json:"type"`
+	// 押したボタンのID（MessageComponent の場合のみ）
+	CustomID string `json:"custom_id"`
+
+	// 以下はインタラクション本体から補完する情報
+	// サーバー内で実行されたときのメンバーの権限（DMでは0）
+	MemberPermissions int64 `json:"-"`
+	// コマンドを実行したユーザのDiscordの言語設定（ja、en-US など）
+	Locale string `json:"-"`
+}
+
+// InteractionOption はサブコマンドグループ・サブコマンド・オプションを表す
+// サブコマンドグループの場合は Options にサブコマンドが、サブコマンドの場合は Options にオプションが入る
+type InteractionOption struct {
+	Name    string              `json:"name"`
+	Type    int                 `json:"type"`
+	Value   string              `json:"value"`
+	Focused bool                `json:"focused"`
+	Options []InteractionOption `json:"options"`
+}
+
+// UnmarshalJSON は文字列以外（整数・真偽値）のオプションの値も文字列として読み込む。
+func (o *InteractionOption) UnmarshalJSON(b []byte) error {
+	type option InteractionOption
+	var raw struct {
+		option
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*o = InteractionOption(raw.option)
+
+	if len(raw.Value) == 0 {
+		return nil
+	}
+	if raw.Value[0] == '"' {
+		return json.Unmarshal(raw.Value, &o.Value)
+	}
+	o.Value = string(raw.Value)
+	return nil
+}
+
+// Option は指定した名前のオプションの値を返す。指定されていない場合は空文字を返す。
+func (o InteractionOption) Option(name string) string {
+	for _, opt := range o.Options {
+		if opt.Name == name {
+			return opt.Value
+		}
+	}
+	return ""
 }
 
 type EventPayloads struct {
@@ -32,7 +97,7 @@ type EventPayloads struct {
 		Type      string `json:"type"`
 		Timestamp string `json:"timestamp"`
 		Data      struct {
-			IntegrationType int      `json:"integration_type"`
+			IntegrationType *int     `json:"integration_type"` // 0: サーバーへのインストール, 1: ユーザへのインストール（省略される場合がある）
 			Scopes          []string `json:"scopes"`
 			User            struct {
 				Avatar               string `json:"avatar"`
@@ -2,22 +2,27 @@ package firestore
 
 import (
 	"context"
-	"log"
-	"os"
+	"errors"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type DB struct {
 	Client *firestore.Client
 }
 
-func NewDB() (*DB, error) {
-	projectID := os.Getenv("PROJECT_ID")
-	ctx := context.Background()
+// NewDB はプロジェクトと同名のデータベースに接続する。
+func NewDB(ctx context.Context, projectID string) (*DB, error) {
 	client, err := firestore.NewClientWithDatabase(ctx, projectID, projectID)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 	return &DB{Client: client}, nil
 }
@@ -29,15 +34,22 @@ func (db *DB) Close() {
 	}
 }
 
-func (db *DB) SaveUserInfo(discordID string, channelID string) error {
-	_, err := db.Client.Collection("users").Doc(discordID).Set(context.Background(), map[string]interface{}{
+func (db *DB) SaveUserInfo(ctx context.Context, discordID string, channelID string) error {
+	ctx, span := startSpan(ctx, "SaveUserInfo")
+	defer span.End()
+
+	// ユーザとサーバーの両方にインストールされることがあるため、既存の情報は残す
+	_, err := db.Client.Collection("users").Doc(discordID).Set(ctx, map[string]interface{}{
 		"channel_id": channelID,
-	})
+	}, firestore.MergeAll)
 	return err
 }
 
-func (db *DB) SaveUserToken(discordID string, token string) error {
-	_, err := db.Client.Collection("users").Doc(discordID).Update(context.Background(), []firestore.Update{
+func (db *DB) SaveUserToken(ctx context.Context, discordID string, token string) error {
+	ctx, span := startSpan(ctx, "SaveUserToken")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
 		{
 			Path:  "token",
 			Value: token,
@@ -46,8 +58,11 @@ func (db *DB) SaveUserToken(discordID string, token string) error {
 	return err
 }
 
-func (db *DB) SaveUserTwoFactorAuthToken(discordID string, token string) error {
-	_, err := db.Client.Collection("users").Doc(discordID).Update(context.Background(), []firestore.Update{
+func (db *DB) SaveUserTwoFactorAuthToken(ctx context.Context, discordID string, token string) error {
+	ctx, span := startSpan(ctx, "SaveUserTwoFactorAuthToken")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
 		{
 			Path:  "two_factor_auth_token",
 			Value: token,
@@ -56,8 +71,14 @@ func (db *DB) SaveUserTwoFactorAuthToken(discordID string, token string) error {
 	return err
 }
 
-func (db *DB) SaveTargetUser(discordID string, targetID string) error {
-	_, err := db.Client.Collection("users").Doc(discordID).Update(context.Background(), []firestore.Update{
+// SaveTargetUser は通知対象のフレンドを1人だけ登録する。
+//
+// Deprecated: 複数のフレンドを登録できる AddWatchTarget を使う。
+func (db *DB) SaveTargetUser(ctx context.Context, discordID string, targetID string) error {
+	ctx, span := startSpan(ctx, "SaveTargetUser")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
 		{
 			Path:  "target_vrc_user_id",
 			Value: targetID,
@@ -66,8 +87,14 @@ func (db *DB) SaveTargetUser(discordID string, targetID string) error {
 	return err
 }
 
-func (db *DB) GetUserInfo(discordID string) (UserInfo, error) {
-	doc, err := db.Client.Collection("users").Doc(discordID).Get(context.Background())
+func (db *DB) GetUserInfo(ctx context.Context, discordID string) (UserInfo, error) {
+	ctx, span := startSpan(ctx, "GetUserInfo")
+	defer span.End()
+
+	doc, err := db.Client.Collection("users").Doc(discordID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return UserInfo{}, ErrUserNotFound
+	}
 	if err != nil {
 		return UserInfo{}, err
 	}
@@ -81,9 +108,12 @@ func (db *DB) GetUserInfo(discordID string) (UserInfo, error) {
 	return u, nil
 }
 
-func (db *DB) GetAllUserInfo() (map[string]UserInfo, error) {
+func (db *DB) GetAllUserInfo(ctx context.Context) (map[string]UserInfo, error) {
+	ctx, span := startSpan(ctx, "GetAllUserInfo")
+	defer span.End()
+
 	users := make(map[string]UserInfo)
-	iter := db.Client.Collection("users").Documents(context.Background())
+	iter := db.Client.Collection("users").Documents(ctx)
 	for {
 		doc, err := iter.Next()
 		if err != nil {
@@ -99,8 +129,11 @@ func (db *DB) GetAllUserInfo() (map[string]UserInfo, error) {
 	return users, nil
 }
 
-func (db *DB) ChangeNotificationed(discordID string, flag bool) error {
-	_, err := db.Client.Collection("users").Doc(discordID).Update(context.Background(), []firestore.Update{
+func (db *DB) ChangeNotificationed(ctx context.Context, discordID string, flag bool) error {
+	ctx, span := startSpan(ctx, "ChangeNotificationed")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
 		{
 			Path:  "notificationed",
 			Value: flag,
@@ -108,3 +141,826 @@ func (db *DB) ChangeNotificationed(discordID string, flag bool) error {
 	})
 	return err
 }
+
+// DeleteUser はユーザ情報、プレゼンスの履歴、通知の意図を削除する。
+// 監査ログやダイジェストの送信記録は残す（全て削除する場合は DeleteAccount を使う）
+func (db *DB) DeleteUser(ctx context.Context, discordID string) error {
+	ctx, span := startSpan(ctx, "DeleteUser")
+	defer span.End()
+
+	// サブコレクションはドキュメントを削除しても残るため、先に削除する
+	user := db.Client.Collection("users").Doc(discordID)
+	if err := db.deleteAll(ctx, user.Collection("presence_history").Query); err != nil {
+		return err
+	}
+	// 未送信の通知の意図が残っていると、削除したユーザに再送しようとするため削除する
+	if err := db.deleteAll(ctx, db.Client.Collection("notification_intents").Where("discord_id", "==", discordID)); err != nil {
+		return err
+	}
+
+	_, err := user.Delete(ctx)
+	return err
+}
+
+// DeleteAccount はユーザに関連する全てのドキュメント（ユーザ情報、プレゼンスの履歴、通知の意図、
+// ダイジェストの送信記録、監査ログ）を削除する。
+func (db *DB) DeleteAccount(ctx context.Context, discordID string) error {
+	ctx, span := startSpan(ctx, "DeleteAccount")
+	defer span.End()
+
+	for _, col := range []string{"digests", "audit_events"} {
+		if err := db.deleteAll(ctx, db.Client.Collection(col).Where("discord_id", "==", discordID)); err != nil {
+			return err
+		}
+	}
+	return db.DeleteUser(ctx, discordID)
+}
+
+// GetUserData はユーザに関連する全てのドキュメントの内容を返す（個人データのエクスポート用）
+// トークンなどの秘密の情報もそのまま含むため、呼び出し側で伏せること
+func (db *DB) GetUserData(ctx context.Context, discordID string) (UserData, error) {
+	ctx, span := startSpan(ctx, "GetUserData")
+	defer span.End()
+
+	user := db.Client.Collection("users").Doc(discordID)
+	doc, err := user.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return UserData{}, ErrUserNotFound
+	}
+	if err != nil {
+		return UserData{}, err
+	}
+
+	data := UserData{User: doc.Data()}
+	queries := []struct {
+		q   firestore.Query
+		dst *[]map[string]interface{}
+	}{
+		{user.Collection("presence_history").OrderBy("observed_at", firestore.Asc), &data.PresenceHistory},
+		{db.Client.Collection("digests").Where("discord_id", "==", discordID), &data.Digests},
+		{db.Client.Collection("audit_events").Where("discord_id", "==", discordID), &data.AuditEvents},
+		{db.Client.Collection("notification_intents").Where("discord_id", "==", discordID), &data.NotificationIntents},
+	}
+	for _, q := range queries {
+		docs, err := q.q.Documents(ctx).GetAll()
+		if err != nil {
+			return UserData{}, err
+		}
+		*q.dst = make([]map[string]interface{}, 0, len(docs))
+		for _, d := range docs {
+			*q.dst = append(*q.dst, d.Data())
+		}
+	}
+	return data, nil
+}
+
+func (db *DB) SaveNotifyChannel(ctx context.Context, discordID string, channelID string, roleID string) error {
+	ctx, span := startSpan(ctx, "SaveNotifyChannel")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Set(ctx, map[string]interface{}{
+		"notify_channel_id": channelID,
+		"mention_role_id":   roleID,
+	}, firestore.MergeAll)
+	return err
+}
+
+func (db *DB) ClearNotifyChannel(ctx context.Context, discordID string) error {
+	ctx, span := startSpan(ctx, "ClearNotifyChannel")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "notify_channel_id",
+			Value: firestore.Delete,
+		},
+		{
+			Path:  "mention_role_id",
+			Value: firestore.Delete,
+		},
+	})
+	return err
+}
+
+func (db *DB) SaveNotifier(ctx context.Context, discordID string, kind string, target string, secret string) error {
+	ctx, span := startSpan(ctx, "SaveNotifier")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Set(ctx, map[string]interface{}{
+		"notifier":        kind,
+		"notifier_target": target,
+		"notifier_secret": secret,
+	}, firestore.MergeAll)
+	return err
+}
+
+// SaveEmailVerification は確認中のメールアドレスを保存する。v が nil の場合は削除する。
+func (db *DB) SaveEmailVerification(ctx context.Context, discordID string, v *EmailVerification) error {
+	ctx, span := startSpan(ctx, "SaveEmailVerification")
+	defer span.End()
+
+	var value interface{} = firestore.Delete
+	if v != nil {
+		value = *v
+	}
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "email_verification",
+			Value: value,
+		},
+	})
+	return err
+}
+
+// ConfirmEmailNotifier は確認が済んだメールアドレスを通知先に設定し、確認中のメールアドレスを削除する。
+func (db *DB) ConfirmEmailNotifier(ctx context.Context, discordID string, address string) error {
+	ctx, span := startSpan(ctx, "ConfirmEmailNotifier")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{Path: "notifier", Value: "email"},
+		{Path: "notifier_target", Value: address},
+		{Path: "notifier_secret", Value: ""},
+		{Path: "email_verification", Value: firestore.Delete},
+	})
+	return err
+}
+
+// SavePresence はプレゼンスの変化を履歴に追加し、最後に観測したプレゼンスを更新する。
+func (db *DB) SavePresence(ctx context.Context, discordID string, p Presence) error {
+	ctx, span := startSpan(ctx, "SavePresence")
+	defer span.End()
+
+	user := db.Client.Collection("users").Doc(discordID)
+
+	return db.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(user.Collection("presence_history").NewDoc(), p); err != nil {
+			return err
+		}
+		return tx.Update(user, []firestore.Update{
+			{
+				FieldPath: firestore.FieldPath{"last_presences", p.TargetVRCUserID},
+				Value:     p,
+			},
+		})
+	})
+}
+
+// GetPresenceHistory は since 以降のプレゼンスの履歴を観測時刻の昇順で返す。
+func (db *DB) GetPresenceHistory(ctx context.Context, discordID string, since time.Time) ([]Presence, error) {
+	ctx, span := startSpan(ctx, "GetPresenceHistory")
+	defer span.End()
+
+	iter := db.Client.Collection("users").Doc(discordID).Collection("presence_history").
+		Where("observed_at", ">=", since).
+		OrderBy("observed_at", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var history []Presence
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var p Presence
+		if err := doc.DataTo(&p); err != nil {
+			return nil, err
+		}
+		history = append(history, p)
+	}
+	return history, nil
+}
+
+// GetLastPresenceBefore は before より前に観測した、指定したフレンドの最後のプレゼンスを返す。
+// 履歴がない場合は false を返す。
+// target_vrc_user_id と observed_at（降順）の複合インデックスが必要
+func (db *DB) GetLastPresenceBefore(ctx context.Context, discordID string, targetID string, before time.Time) (Presence, bool, error) {
+	ctx, span := startSpan(ctx, "GetLastPresenceBefore")
+	defer span.End()
+
+	iter := db.Client.Collection("users").Doc(discordID).Collection("presence_history").
+		Where("target_vrc_user_id", "==", targetID).
+		Where("observed_at", "<", before).
+		OrderBy("observed_at", firestore.Desc).
+		Limit(1).
+		Documents(ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return Presence{}, false, nil
+	}
+	if err != nil {
+		return Presence{}, false, err
+	}
+	var p Presence
+	if err := doc.DataTo(&p); err != nil {
+		return Presence{}, false, err
+	}
+	return p, true, nil
+}
+
+// DeletePresenceHistoryBefore は before より前に観測したプレゼンスの履歴を削除する。
+func (db *DB) DeletePresenceHistoryBefore(ctx context.Context, discordID string, before time.Time) error {
+	ctx, span := startSpan(ctx, "DeletePresenceHistoryBefore")
+	defer span.End()
+
+	col := db.Client.Collection("users").Doc(discordID).Collection("presence_history")
+	return db.deleteAll(ctx, col.Where("observed_at", "<", before))
+}
+
+// deleteAll はクエリに一致するドキュメントを一定の件数ずつ全て削除する。
+func (db *DB) deleteAll(ctx context.Context, q firestore.Query) error {
+	const batchSize = 400
+
+	for {
+		docs, err := q.Limit(batchSize).Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		bw := db.Client.BulkWriter(ctx)
+		jobs := make([]*firestore.BulkWriterJob, 0, len(docs))
+		for _, doc := range docs {
+			job, err := bw.Delete(doc.Ref)
+			if err != nil {
+				bw.End()
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		bw.End()
+
+		for _, job := range jobs {
+			if _, err := job.Results(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// AddAuditEvent は監査ログを追加する。
+func (db *DB) AddAuditEvent(ctx context.Context, e AuditEvent) error {
+	ctx, span := startSpan(ctx, "AddAuditEvent")
+	defer span.End()
+
+	_, _, err := db.Client.Collection("audit_events").Add(ctx, e)
+	return err
+}
+
+// GetAuditEvents は指定したユーザの監査ログを新しい順に最大 limit 件返す。limit が0以下の場合は全件返す。
+// discord_id と created_at（降順）の複合インデックスが必要
+func (db *DB) GetAuditEvents(ctx context.Context, discordID string, limit int) ([]AuditEvent, error) {
+	ctx, span := startSpan(ctx, "GetAuditEvents")
+	defer span.End()
+
+	q := db.Client.Collection("audit_events").
+		Where("discord_id", "==", discordID).
+		OrderBy("created_at", firestore.Desc)
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]AuditEvent, 0, len(docs))
+	for _, doc := range docs {
+		var e AuditEvent
+		if err := doc.DataTo(&e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// AcquireLease は名前付きのロックを ttl の間取得する。
+// 他の所有者が期限内のロックを持っている場合は false を返す。同じ所有者が呼び出した場合は期限を延長する。
+// group を指定すると、group と同じ名前のロックはグループ全体のロックになり、グループに属するロックと同時には取得できない。
+// 期限の判定には各インスタンスの時刻を使うため、ttl はインスタンス間の時刻のずれより十分長くすること
+func (db *DB) AcquireLease(ctx context.Context, name string, group string, owner string, ttl time.Duration) (bool, error) {
+	ctx, span := startSpan(ctx, "AcquireLease")
+	defer span.End()
+
+	locks := db.Client.Collection("locks")
+	ref := locks.Doc(name)
+	var acquired bool
+	err := db.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		acquired = false
+		now := time.Now()
+
+		// 他の所有者の期限内のロックがあれば取得しない
+		held := func(doc *firestore.DocumentSnapshot) (bool, error) {
+			var l Lease
+			if err := doc.DataTo(&l); err != nil {
+				return false, err
+			}
+			return l.Owner != owner && l.ExpiresAt.After(now), nil
+		}
+
+		refs := []*firestore.DocumentRef{ref}
+		if group != "" && group != name {
+			refs = append(refs, locks.Doc(group))
+		}
+		docs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		if group != "" && group == name {
+			members, err := tx.Documents(locks.Where("group", "==", group)).GetAll()
+			if err != nil {
+				return err
+			}
+			docs = append(docs, members...)
+		}
+		for _, doc := range docs {
+			if !doc.Exists() {
+				continue
+			}
+			ok, err := held(doc)
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
+		}
+
+		acquired = true
+		l := Lease{Owner: owner, ExpiresAt: now.Add(ttl)}
+		if group != name {
+			l.Group = group
+		}
+		return tx.Set(ref, l)
+	})
+	if err != nil {
+		return false, err
+	}
+	return acquired, nil
+}
+
+// ReleaseLease は取得したロックを解放する。期限切れで他の所有者に移っている場合は何もしない。
+func (db *DB) ReleaseLease(ctx context.Context, name string, owner string) error {
+	ctx, span := startSpan(ctx, "ReleaseLease")
+	defer span.End()
+
+	ref := db.Client.Collection("locks").Doc(name)
+	return db.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var l Lease
+		if err := doc.DataTo(&l); err != nil {
+			return err
+		}
+		if l.Owner != owner {
+			return nil
+		}
+		return tx.Delete(ref)
+	})
+}
+
+// ErrUserNotFound は条件に一致するユーザが存在しない場合のエラー
+var ErrUserNotFound = errors.New("user not found")
+
+func (db *DB) SaveCalendarToken(ctx context.Context, discordID string, token string) error {
+	ctx, span := startSpan(ctx, "SaveCalendarToken")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "calendar_token",
+			Value: token,
+		},
+	})
+	return err
+}
+
+// GetUserInfoByCalendarToken はカレンダーのトークンに一致するユーザのDiscordIDとユーザ情報を返す。
+func (db *DB) GetUserInfoByCalendarToken(ctx context.Context, token string) (string, UserInfo, error) {
+	ctx, span := startSpan(ctx, "GetUserInfoByCalendarToken")
+	defer span.End()
+
+	docs, err := db.Client.Collection("users").Where("calendar_token", "==", token).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return "", UserInfo{}, err
+	}
+	if len(docs) == 0 {
+		return "", UserInfo{}, ErrUserNotFound
+	}
+
+	var u UserInfo
+	if err := docs[0].DataTo(&u); err != nil {
+		return "", UserInfo{}, err
+	}
+	return docs[0].Ref.ID, u, nil
+}
+
+func (db *DB) SaveDigestSettings(ctx context.Context, discordID string, enabled bool, digestTime string, timezone string, digestOnly bool) error {
+	ctx, span := startSpan(ctx, "SaveDigestSettings")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "digest_enabled",
+			Value: enabled,
+		},
+		{
+			Path:  "digest_time",
+			Value: digestTime,
+		},
+		{
+			Path:  "digest_timezone",
+			Value: timezone,
+		},
+		{
+			Path:  "digest_only",
+			Value: digestOnly,
+		},
+	})
+	return err
+}
+
+// SaveNotifyTemplate はオンライン時の通知文のテンプレートを保存する。
+// 空文字を指定すると既定の通知文に戻る。
+func (db *DB) SaveNotifyTemplate(ctx context.Context, discordID string, tmpl string) error {
+	ctx, span := startSpan(ctx, "SaveNotifyTemplate")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "notify_template",
+			Value: tmpl,
+		},
+	})
+	return err
+}
+
+// SaveLocale はメッセージの言語を保存する。
+func (db *DB) SaveLocale(ctx context.Context, discordID string, locale string) error {
+	ctx, span := startSpan(ctx, "SaveLocale")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "locale",
+			Value: locale,
+		},
+	})
+	return err
+}
+
+// SaveUserDisabled はユーザの利用を停止、または再開する。
+func (db *DB) SaveUserDisabled(ctx context.Context, discordID string, disabled bool) error {
+	ctx, span := startSpan(ctx, "SaveUserDisabled")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "disabled",
+			Value: disabled,
+		},
+	})
+	return err
+}
+
+// SaveUnreachable は通知先のDiscordのチャンネルに送信できなくなったかどうかを保存する。
+func (db *DB) SaveUnreachable(ctx context.Context, discordID string, unreachable bool) error {
+	ctx, span := startSpan(ctx, "SaveUnreachable")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "unreachable",
+			Value: unreachable,
+		},
+	})
+	return err
+}
+
+// ClaimDigest は指定した日付のダイジェストの送信権を取得する。
+// 既に同じ日付のダイジェストを送信済み（または送信中）の場合は false を返す。
+func (db *DB) ClaimDigest(ctx context.Context, discordID string, date string) (bool, error) {
+	ctx, span := startSpan(ctx, "ClaimDigest")
+	defer span.End()
+
+	_, err := db.Client.Collection("digests").Doc(discordID+"_"+date).Create(ctx, map[string]interface{}{
+		"discord_id": discordID,
+		"date":       date,
+		"created_at": firestore.ServerTimestamp,
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseDigest はダイジェストの送信に失敗した場合に、次回の実行で再送できるよう送信権を解放する。
+func (db *DB) ReleaseDigest(ctx context.Context, discordID string, date string) error {
+	ctx, span := startSpan(ctx, "ReleaseDigest")
+	defer span.End()
+
+	_, err := db.Client.Collection("digests").Doc(discordID + "_" + date).Delete(ctx)
+	return err
+}
+
+// AddWatchTarget は通知対象のフレンドを追加する。
+// 以前の形式（target_vrc_user_id）で登録されているフレンドも通知対象の一覧に移す。
+func (db *DB) AddWatchTarget(ctx context.Context, discordID string, targetID string) error {
+	ctx, span := startSpan(ctx, "AddWatchTarget")
+	defer span.End()
+
+	user := db.Client.Collection("users").Doc(discordID)
+	return db.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(user)
+		if err != nil {
+			return err
+		}
+		var u UserInfo
+		if err := doc.DataTo(&u); err != nil {
+			return err
+		}
+
+		ids := []interface{}{targetID}
+		if u.TargetVRCUserID != "" {
+			ids = append([]interface{}{u.TargetVRCUserID}, ids...)
+		}
+		return tx.Update(user, []firestore.Update{
+			{
+				Path:  "watch_vrc_user_ids",
+				Value: firestore.ArrayUnion(ids...),
+			},
+			{
+				Path:  "target_vrc_user_id",
+				Value: firestore.Delete,
+			},
+		})
+	})
+}
+
+// RemoveWatchTarget は通知対象のフレンドを削除する。
+func (db *DB) RemoveWatchTarget(ctx context.Context, discordID string, targetID string) error {
+	ctx, span := startSpan(ctx, "RemoveWatchTarget")
+	defer span.End()
+
+	user := db.Client.Collection("users").Doc(discordID)
+	return db.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(user)
+		if err != nil {
+			return err
+		}
+		var u UserInfo
+		if err := doc.DataTo(&u); err != nil {
+			return err
+		}
+
+		updates := []firestore.Update{
+			{
+				Path:  "watch_vrc_user_ids",
+				Value: firestore.ArrayRemove(targetID),
+			},
+			{
+				FieldPath: firestore.FieldPath{"notified", targetID},
+				Value:     firestore.Delete,
+			},
+		}
+		if u.TargetVRCUserID == targetID {
+			updates = append(updates, firestore.Update{Path: "target_vrc_user_id", Value: firestore.Delete})
+		}
+		return tx.Update(user, updates)
+	})
+}
+
+// EndJoinEpisode はフレンドがオフラインになったときに、オンライン時の通知の送信済みフラグを戻し、
+// 「だれでもおいで」の回数を増やす。次にオンラインになったときは別の冪等キーで通知する。
+func (db *DB) EndJoinEpisode(ctx context.Context, discordID string, targetID string) error {
+	ctx, span := startSpan(ctx, "EndJoinEpisode")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			FieldPath: firestore.FieldPath{"notified", targetID},
+			Value:     false,
+		},
+		{
+			FieldPath: firestore.FieldPath{"join_episodes", targetID},
+			Value:     firestore.Increment(1),
+		},
+	})
+	return err
+}
+
+// CreateNotificationIntent は通知の意図を記録し、意図の種類に応じてユーザ情報の通知済みのフラグを更新する。
+// 呼び出した実行が claimTTL の間、送信を占有する。記録した状態と時刻は intent に設定する。
+// 同じ冪等キーの意図が既に記録されている場合（別の実行が送信した場合など）は false を返す。
+func (db *DB) CreateNotificationIntent(ctx context.Context, intent *NotificationIntent, claimTTL time.Duration) (bool, error) {
+	ctx, span := startSpan(ctx, "CreateNotificationIntent")
+	defer span.End()
+
+	ref := db.Client.Collection("notification_intents").Doc(intent.Key)
+	user := db.Client.Collection("users").Doc(intent.DiscordID)
+	var created bool
+	err := db.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		created = false
+		_, err := tx.Get(ref)
+		if err == nil {
+			return nil
+		}
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		now := time.Now()
+		intent.Status = IntentPending
+		intent.Attempts = 1
+		intent.ClaimedUntil = now.Add(claimTTL)
+		intent.CreatedAt = now
+		if err := tx.Create(ref, *intent); err != nil {
+			return err
+		}
+		created = true
+		return tx.Update(user, intentUserUpdates(*intent))
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// intentUserUpdates は通知の意図を記録するときに、同じ通知を再び送らないよう更新するユーザ情報のフィールドを返す。
+func intentUserUpdates(intent NotificationIntent) []firestore.Update {
+	switch intent.Kind {
+	case IntentGathering:
+		// 次の集まりは別の冪等キーになるよう、回数を増やす
+		return []firestore.Update{
+			{Path: "gathering_location", Value: intent.Location},
+			{Path: "gathering_episodes", Value: firestore.Increment(1)},
+		}
+	case IntentReauth:
+		return []firestore.Update{{Path: "notificationed", Value: true}}
+	}
+	return []firestore.Update{{
+		FieldPath: firestore.FieldPath{"notified", intent.TargetVRCUserID},
+		Value:     true,
+	}}
+}
+
+// MarkIntentDelivered は通知の意図を送信済みにする。
+func (db *DB) MarkIntentDelivered(ctx context.Context, key string) error {
+	ctx, span := startSpan(ctx, "MarkIntentDelivered")
+	defer span.End()
+
+	_, err := db.Client.Collection("notification_intents").Doc(key).Update(ctx, []firestore.Update{
+		{Path: "status", Value: IntentDelivered},
+		{Path: "finished_at", Value: time.Now()},
+	})
+	return err
+}
+
+// RetryIntentAt は送信に失敗した通知の意図の占有を解除し、next 以降の実行で再送できるようにする。
+func (db *DB) RetryIntentAt(ctx context.Context, key string, lastError string, next time.Time) error {
+	ctx, span := startSpan(ctx, "RetryIntentAt")
+	defer span.End()
+
+	_, err := db.Client.Collection("notification_intents").Doc(key).Update(ctx, []firestore.Update{
+		{Path: "last_error", Value: lastError},
+		{Path: "claimed_until", Value: next},
+	})
+	return err
+}
+
+// GiveUpIntent は通知の再送を諦め、以降は再送しないようにする。
+func (db *DB) GiveUpIntent(ctx context.Context, key string, lastError string) error {
+	ctx, span := startSpan(ctx, "GiveUpIntent")
+	defer span.End()
+
+	_, err := db.Client.Collection("notification_intents").Doc(key).Update(ctx, []firestore.Update{
+		{Path: "status", Value: IntentFailed},
+		{Path: "last_error", Value: lastError},
+		{Path: "finished_at", Value: time.Now()},
+	})
+	return err
+}
+
+// GetStuckIntents は占有の期限（再送する時刻）を過ぎても送信済みになっていない通知の意図を返す。
+// status と claimed_until の複合インデックスが必要
+func (db *DB) GetStuckIntents(ctx context.Context) ([]NotificationIntent, error) {
+	ctx, span := startSpan(ctx, "GetStuckIntents")
+	defer span.End()
+
+	docs, err := db.Client.Collection("notification_intents").
+		Where("status", "==", IntentPending).
+		Where("claimed_until", "<=", time.Now()).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	intents := make([]NotificationIntent, 0, len(docs))
+	for _, doc := range docs {
+		var intent NotificationIntent
+		if err := doc.DataTo(&intent); err != nil {
+			return nil, err
+		}
+		intent.Key = doc.Ref.ID
+		intents = append(intents, intent)
+	}
+	return intents, nil
+}
+
+// ClaimIntent は再送するために通知の意図を claimTTL の間占有する。
+// 送信済みの場合や、他の実行が占有している場合は false を返す。
+func (db *DB) ClaimIntent(ctx context.Context, key string, claimTTL time.Duration) (bool, error) {
+	ctx, span := startSpan(ctx, "ClaimIntent")
+	defer span.End()
+
+	ref := db.Client.Collection("notification_intents").Doc(key)
+	var claimed bool
+	err := db.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var intent NotificationIntent
+		if err := doc.DataTo(&intent); err != nil {
+			return err
+		}
+		now := time.Now()
+		if intent.Status != IntentPending || intent.ClaimedUntil.After(now) {
+			return nil
+		}
+
+		claimed = true
+		return tx.Update(ref, []firestore.Update{
+			{Path: "claimed_until", Value: now.Add(claimTTL)},
+			{Path: "attempts", Value: firestore.Increment(1)},
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, nil
+}
+
+// DeleteFinishedIntentsBefore は before より前に送信済みになった、または諦めた通知の意図を削除する。
+// フレンドがオフラインになれば冪等キーが変わるため、送信済みの意図を長く残す必要はない
+// status と finished_at の複合インデックスが必要
+func (db *DB) DeleteFinishedIntentsBefore(ctx context.Context, before time.Time) error {
+	ctx, span := startSpan(ctx, "DeleteFinishedIntentsBefore")
+	defer span.End()
+
+	return db.deleteAll(ctx, db.Client.Collection("notification_intents").
+		Where("status", "in", []string{IntentDelivered, IntentFailed}).
+		Where("finished_at", "<", before))
+}
+
+func (db *DB) SaveGatheringMin(ctx context.Context, discordID string, min int) error {
+	ctx, span := startSpan(ctx, "SaveGatheringMin")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "gathering_min",
+			Value: min,
+		},
+	})
+	return err
+}
+
+func (db *DB) SaveGatheringLocation(ctx context.Context, discordID string, location string) error {
+	ctx, span := startSpan(ctx, "SaveGatheringLocation")
+	defer span.End()
+
+	_, err := db.Client.Collection("users").Doc(discordID).Update(ctx, []firestore.Update{
+		{
+			Path:  "gathering_location",
+			Value: location,
+		},
+	})
+	return err
+}
+
+// startSpan はFirestoreへのアクセスごとのスパンを開始する。
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "firestore."+method, attribute.String("db.system", "firestore"))
+}
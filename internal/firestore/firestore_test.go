@@ -1,7 +1,9 @@
 package firestore
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/joho/godotenv"
@@ -15,7 +17,7 @@ func TestMain(m *testing.M) {
 }
 
 func TestNewDB(t *testing.T) {
-	client, err := NewDB()
+	client, err := NewDB(context.Background(), os.Getenv("PROJECT_ID"))
 	if err != nil {
 		t.Fatalf("Failed to create Firestore client: %v", err)
 	}
@@ -26,14 +28,14 @@ func TestNewDB(t *testing.T) {
 }
 
 func TestSaveUserInfo(t *testing.T) {
-	client, err := NewDB()
+	client, err := NewDB(context.Background(), os.Getenv("PROJECT_ID"))
 	if err != nil {
 		t.Fatalf("Failed to create Firestore client: %v", err)
 	}
 
 	discordID := "test_discord_id"
 	channelID := "test_channel_id"
-	err = client.SaveUserInfo(discordID, channelID)
+	err = client.SaveUserInfo(context.Background(), discordID, channelID)
 	if err != nil {
 		t.Fatalf("Failed to save user info: %v", err)
 	}
@@ -41,14 +43,14 @@ func TestSaveUserInfo(t *testing.T) {
 }
 
 func TestSaveUserToken(t *testing.T) {
-	client, err := NewDB()
+	client, err := NewDB(context.Background(), os.Getenv("PROJECT_ID"))
 	if err != nil {
 		t.Fatalf("Failed to create Firestore client: %v", err)
 	}
 
 	discordID := "test_discord_id"
 	token := "test_token"
-	err = client.SaveUserToken(discordID, token)
+	err = client.SaveUserToken(context.Background(), discordID, token)
 	if err != nil {
 		t.Fatalf("Failed to save user info: %v", err)
 	}
@@ -56,14 +58,14 @@ func TestSaveUserToken(t *testing.T) {
 }
 
 func TestSaveTargetUser(t *testing.T) {
-	client, err := NewDB()
+	client, err := NewDB(context.Background(), os.Getenv("PROJECT_ID"))
 	if err != nil {
 		t.Fatalf("Failed to create Firestore client: %v", err)
 	}
 
 	discordID := "test_discord_id"
 	targetID := "target_vrc_user_id"
-	err = client.SaveTargetUser(discordID, targetID)
+	err = client.SaveTargetUser(context.Background(), discordID, targetID)
 	if err != nil {
 		t.Fatalf("Failed to save user info: %v", err)
 	}
@@ -71,13 +73,13 @@ func TestSaveTargetUser(t *testing.T) {
 }
 
 func TestGetUserInfo(t *testing.T) {
-	client, err := NewDB()
+	client, err := NewDB(context.Background(), os.Getenv("PROJECT_ID"))
 	if err != nil {
 		t.Fatalf("Failed to create Firestore client: %v", err)
 	}
 
 	discordID := "test_discord_id"
-	userInfo, err := client.GetUserInfo(discordID)
+	userInfo, err := client.GetUserInfo(context.Background(), discordID)
 	if err != nil {
 		t.Fatalf("Failed to save user info: %v", err)
 	}
@@ -86,12 +88,12 @@ func TestGetUserInfo(t *testing.T) {
 }
 
 func TestGetAllUserInfo(t *testing.T) {
-	client, err := NewDB()
+	client, err := NewDB(context.Background(), os.Getenv("PROJECT_ID"))
 	if err != nil {
 		t.Fatalf("Failed to create Firestore client: %v", err)
 	}
 
-	users, err := client.GetAllUserInfo()
+	users, err := client.GetAllUserInfo(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to get all user info: %v", err)
 	}
@@ -1,9 +1,180 @@
 package firestore
 
+import "time"
+
 type UserInfo struct {
-	ChannelID          string `firestore:"channel_id,omitempty"`
+	ChannelID string `firestore:"channel_id,omitempty"`
+	// 通知対象のフレンドを1人だけ登録できたときのフィールド（WatchVRCUserIDs に移行する）
 	TargetVRCUserID    string `firestore:"target_vrc_user_id,omitempty"`
 	Token              string `firestore:"token,omitempty"`
 	TwoFactorAuthToken string `firestore:"two_factor_auth_token,omitempty"`
-	Notificationed     bool   `firestore:"notificationed,omitempty"`
+	// 再ログインを促す通知を送信済みかどうか
+	Notificationed bool `firestore:"notificationed,omitempty"`
+	// 通知対象のフレンド（登録順）
+	WatchVRCUserIDs []string `firestore:"watch_vrc_user_ids,omitempty"`
+	// フレンドごとのオンライン時の通知を送信済みかどうか（キーはVRChatのユーザID）
+	Notified map[string]bool `firestore:"notified,omitempty"`
+	// 通知先のサーバーのテキストチャンネル（未設定の場合は ChannelID のDMに通知する）
+	NotifyChannelID string `firestore:"notify_channel_id,omitempty"`
+	// 通知時にメンションするロール
+	MentionRoleID string `firestore:"mention_role_id,omitempty"`
+	// 通知先の種類（discord, slack, webhook, email）未設定の場合は discord
+	Notifier string `firestore:"notifier,omitempty"`
+	// 通知先の宛先（Slack・WebhookのURL、メールアドレス）
+	NotifierTarget string `firestore:"notifier_target,omitempty"`
+	// Webhookの署名に使う秘密鍵
+	NotifierSecret string `firestore:"notifier_secret,omitempty"`
+	// 通知先に設定する前に確認中のメールアドレス（確認が済むまで通知先は変わらない）
+	EmailVerification *EmailVerification `firestore:"email_verification,omitempty"`
+	// フレンドごとに最後に観測したプレゼンス（キーはVRChatのユーザID）
+	LastPresences map[string]Presence `firestore:"last_presences,omitempty"`
+	// カレンダー（iCalendar）の購読URLに含めるトークン
+	CalendarToken string `firestore:"calendar_token,omitempty"`
+	// 1日1回のまとめ通知（ダイジェスト）を受け取るかどうか
+	DigestEnabled bool `firestore:"digest_enabled,omitempty"`
+	// ダイジェストを送信する時刻（HH:MM）とタイムゾーン（Asia/Tokyo など）
+	DigestTime     string `firestore:"digest_time,omitempty"`
+	DigestTimezone string `firestore:"digest_timezone,omitempty"`
+	// ダイジェストのみを受け取り、オンライン時の通知は送らない
+	DigestOnly bool `firestore:"digest_only,omitempty"`
+	// 通知対象のフレンドが何人以上同じインスタンスに集まったら通知するか（0の場合は通知しない）
+	GatheringMin int `firestore:"gathering_min,omitempty"`
+	// 最後に通知した集まりのインスタンス（同じ集まりを繰り返し通知しないため）
+	GatheringLocation string `firestore:"gathering_location,omitempty"`
+	// 集まりを通知した回数（通知の意図の冪等キーに使う）
+	GatheringEpisodes int `firestore:"gathering_episodes,omitempty"`
+	// オンライン時の通知文のテンプレート（text/template の構文、未設定の場合は既定の通知文）
+	NotifyTemplate string `firestore:"notify_template,omitempty"`
+	// メッセージの言語（ja、en）最後にコマンドを実行したときのDiscordの言語設定から決める
+	Locale string `firestore:"locale,omitempty"`
+	// 管理者が利用を停止したかどうか（停止中は通知せず、コマンドも受け付けない）
+	Disabled bool `firestore:"disabled,omitempty"`
+	// フレンドごとの「だれでもおいで」の回数（キーはVRChatのユーザID）
+	// フレンドがオフラインになるたびに増やし、同じ回の通知を重複して送らないための識別子に使う
+	JoinEpisodes map[string]int `firestore:"join_episodes,omitempty"`
+	// 通知先のDiscordのチャンネルに恒久的に送信できなくなったかどうか（Botをブロックした場合など）
+	// 送信できない間は通知処理の対象から外し、次にコマンドを実行したときに戻す
+	Unreachable bool `firestore:"unreachable,omitempty"`
+}
+
+// EmailVerification はメールアドレスの確認の状態
+// 第三者のメールアドレスに通知を送れないよう、確認コードを入力してから通知先に設定する
+type EmailVerification struct {
+	Address string `firestore:"address"`
+	// 確認コードのSHA-256ハッシュ（16進数）
+	CodeHash string `firestore:"code_hash"`
+	// 確認コードの入力に失敗した回数
+	Attempts  int       `firestore:"attempts"`
+	SentAt    time.Time `firestore:"sent_at"`
+	ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+// WatchTargets は通知対象のフレンドのユーザIDを登録順に返す。
+func (u UserInfo) WatchTargets() []string {
+	targets := make([]string, 0, len(u.WatchVRCUserIDs)+1)
+	if u.TargetVRCUserID != "" {
+		targets = append(targets, u.TargetVRCUserID)
+	}
+	for _, id := range u.WatchVRCUserIDs {
+		if id != u.TargetVRCUserID {
+			targets = append(targets, id)
+		}
+	}
+	return targets
+}
+
+// Presence はある時点で観測したフレンドのプレゼンス
+type Presence struct {
+	TargetVRCUserID string    `firestore:"target_vrc_user_id"`
+	DisplayName     string    `firestore:"display_name"`
+	State           string    `firestore:"state"`    // online, active, offline
+	Status          string    `firestore:"status"`   // join me, active, ask me, busy, offline
+	WorldID         string    `firestore:"world_id"` // インスタンスにいない場合は空
+	Location        string    `firestore:"location"` // wrld_xxx:12345~private(usr_xxx) など
+	Platform        string    `firestore:"platform"`
+	ObservedAt      time.Time `firestore:"observed_at"`
+}
+
+// Changed はプレゼンスの内容（観測時刻以外）が異なるかどうかを返す。
+func (p Presence) Changed(other Presence) bool {
+	return p.DisplayName != other.DisplayName ||
+		p.State != other.State ||
+		p.Status != other.Status ||
+		p.Location != other.Location ||
+		p.Platform != other.Platform
+}
+
+// AuditEvent はコマンドの実行や状態の変化を記録した監査ログ
+// パスワード・トークン・認証コード・通知先のURLなどの秘密の情報は含めない
+type AuditEvent struct {
+	// 対象のユーザ
+	DiscordID string `firestore:"discord_id"`
+	// 操作の種類（command, auth.login, join.register, notify.delivered など）
+	Action string `firestore:"action"`
+	// 結果（ok, failed）
+	Outcome string `firestore:"outcome"`
+	// 操作の詳細（コマンド名、フレンドのユーザID、通知先の種類、操作した管理者など）
+	Detail    map[string]string `firestore:"detail,omitempty"`
+	CreatedAt time.Time         `firestore:"created_at"`
+}
+
+// UserData はユーザに関連する全てのドキュメントの内容（個人データのエクスポート用）
+// 値はFirestoreのフィールド名をキーにしたドキュメントの内容
+type UserData struct {
+	User                map[string]interface{}   `json:"user"`
+	PresenceHistory     []map[string]interface{} `json:"presence_history"`
+	Digests             []map[string]interface{} `json:"digests"`
+	AuditEvents         []map[string]interface{} `json:"audit_events"`
+	NotificationIntents []map[string]interface{} `json:"notification_intents"`
+}
+
+// Lease は複数のインスタンスで同じ処理を同時に実行しないための期限付きのロック
+// 期限内に解放されなかった場合（インスタンスの停止など）は、期限が過ぎれば他の所有者が取得できる
+type Lease struct {
+	// ロックを取得した実行のID
+	Owner     string    `firestore:"owner"`
+	ExpiresAt time.Time `firestore:"expires_at"`
+	// ロックが属するグループ（AcquireLease を参照）
+	Group string `firestore:"group,omitempty"`
+}
+
+// 通知の意図の状態
+const (
+	IntentPending   = "pending"   // 未送信（送信中、または送信に失敗して再送を待っている）
+	IntentDelivered = "delivered" // 送信済み
+	IntentFailed    = "failed"    // 再送する期間を過ぎた、または恒久的に送信できないため諦めた
+)
+
+// 通知の意図の種類。意図を記録するときに、同じ通知を再び送らないためのユーザ情報も更新する
+const (
+	IntentJoinMe    = "join_me"         // フレンドのオンライン時の通知（notified を更新する）
+	IntentGathering = "gathering"       // 集まりの通知（gathering_location と gathering_episodes を更新する）
+	IntentReauth    = "reauth_required" // 再ログインの依頼（notificationed を更新する）
+)
+
+// NotificationIntent は通知を送信する前に記録する通知の意図
+// ドキュメントIDを冪等キーにし、同じ通知を2回以上送信しないようにする
+// 送信に失敗した通知は未送信のまま残し、間隔を空けて再送する（送信待ちのキューを兼ねる）
+type NotificationIntent struct {
+	// 冪等キー（ドキュメントID）
+	Key             string `firestore:"-"`
+	DiscordID       string `firestore:"discord_id"`
+	TargetVRCUserID string `firestore:"target_vrc_user_id"`
+	// フレンドの「だれでもおいで」の回数（UserInfo.JoinEpisodes）、集まりの通知の場合は UserInfo.GatheringEpisodes
+	Episode int `firestore:"episode"`
+	// 通知の意図の種類（空の場合は IntentJoinMe）と、集まりの通知の場合は集まっているインスタンス
+	Kind     string `firestore:"kind,omitempty"`
+	Location string `firestore:"location,omitempty"`
+	// 送信する通知の内容（notify.Event のJSON）再送時も同じ内容を送信する
+	Event  string `firestore:"event"`
+	Status string `firestore:"status"`
+	// 送信を試みた回数と、最後に失敗したときのエラー
+	Attempts  int    `firestore:"attempts"`
+	LastError string `firestore:"last_error,omitempty"`
+	// 送信中の実行が占有している期限（期限を過ぎても未送信であれば再送する）
+	// 送信に失敗した場合は、次に再送する時刻
+	ClaimedUntil time.Time `firestore:"claimed_until"`
+	CreatedAt    time.Time `firestore:"created_at"`
+	// 送信済みになった、または諦めた時刻
+	FinishedAt time.Time `firestore:"finished_at,omitempty"`
 }
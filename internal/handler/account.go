@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+	"github.com/bwmarrin/discordgo"
+)
+
+// アカウント削除の確認ボタンのID（: の後にコマンドを実行したユーザのIDが続く）
+const (
+	accountDeleteConfirmID = "account.delete.confirm"
+	accountDeleteCancelID  = "account.delete.cancel"
+)
+
+// redactedFields はエクスポートするユーザ情報のうち、値を伏せるフィールド
+var redactedFields = []string{"token", "two_factor_auth_token", "notifier_secret", "calendar_token", "email_verification"}
+
+// accountExport はエクスポートするJSONファイルの内容
+type accountExport struct {
+	DiscordID  string    `json:"discord_id"`
+	ExportedAt time.Time `json:"exported_at"`
+	firestore.UserData
+}
+
+// exportAccount はユーザに関連する全てのデータをJSONファイルにし、送信先のDMチャンネルとメッセージを返す。
+// トークンなどの秘密の情報は伏せる。
+func exportAccount(ctx context.Context, db *firestore.DB, discordID string) (string, *discordgo.MessageSend, string) {
+	data, err := db.GetUserData(ctx, discordID)
+	if errors.Is(err, firestore.ErrUserNotFound) {
+		return "", nil, i18n.T(ctx, "account.not_found")
+	}
+	if err != nil {
+		return "", nil, reportError(ctx, fail("account.export_failed", err), "Failed to get user data", "discordID", discordID)
+	}
+
+	channelID, _ := data.User["channel_id"].(string)
+	if channelID == "" {
+		return "", nil, i18n.T(ctx, "account.not_found")
+	}
+	redactUserData(data)
+
+	b, err := json.MarshalIndent(accountExport{DiscordID: discordID, ExportedAt: time.Now(), UserData: data}, "", "  ")
+	if err != nil {
+		return "", nil, reportError(ctx, fail("account.export_failed", err), "Failed to marshal user data", "discordID", discordID)
+	}
+
+	return channelID, &discordgo.MessageSend{
+		Content: i18n.T(ctx, "account.exported"),
+		Files: []*discordgo.File{
+			{
+				Name:        "vrc-join-notify-" + discordID + ".json",
+				ContentType: "application/json",
+				Reader:      bytes.NewReader(b),
+			},
+		},
+	}, ""
+}
+
+// redactUserData はエクスポートするデータのうち、秘密の情報を伏せる。
+func redactUserData(data firestore.UserData) {
+	for _, f := range redactedFields {
+		if v, ok := data.User[f]; ok && v != "" {
+			data.User[f] = "[redacted]"
+		}
+	}
+	if v, ok := data.User["notifier_target"].(string); ok {
+		data.User["notifier_target"] = maskNotifierTarget(v)
+	}
+	// 以前の通知の意図には、通知先のURLを含む送信のエラーをそのまま記録していた
+	for _, intent := range data.NotificationIntents {
+		if v, ok := intent["last_error"]; ok && v != "" {
+			intent["last_error"] = "[redacted]"
+		}
+	}
+}
+
+// maskNotifierTarget は通知先のURLをホスト以外伏せて返す。
+// Slack や Webhook のURLはそれ自体が送信の権限になるため、エクスポートに含めない。
+// URLでない通知先（メールアドレス）はそのまま返す
+func maskNotifierTarget(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "[redacted]"
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return target
+	}
+	return u.Scheme + "://" + u.Hostname() + "/[redacted]"
+}
+
+// confirmDeleteAccount はアカウントの削除を確認するボタン付きのメッセージを返す。
+func confirmDeleteAccount(ctx context.Context, discordID string) *discordgo.MessageSend {
+	return &discordgo.MessageSend{
+		Content: i18n.T(ctx, "account.delete_confirm"),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    i18n.T(ctx, "account.delete_button"),
+						Style:    discordgo.DangerButton,
+						CustomID: accountDeleteConfirmID + ":" + discordID,
+					},
+					discordgo.Button{
+						Label:    i18n.T(ctx, "account.cancel_button"),
+						Style:    discordgo.SecondaryButton,
+						CustomID: accountDeleteCancelID + ":" + discordID,
+					},
+				},
+			},
+		},
+	}
+}
+
+// deleteAccount はVRChatのセッションを終了させ、ユーザに関連する全てのデータを削除する。
+func deleteAccount(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, discordID string) string {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if errors.Is(err, firestore.ErrUserNotFound) {
+		return i18n.T(ctx, "account.not_found")
+	}
+	if err != nil {
+		return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+
+	// セッションを終了できなくてもデータは削除する（トークンを削除すれば以降は使われない）
+	if userInfo.Token != "" {
+		if err := vrc.Logout(ctx, userInfo.Token, userInfo.TwoFactorAuthToken); err != nil {
+			slog.ErrorContext(ctx, "Failed to revoke VRChat session", "discordID", discordID, "error", err)
+		}
+	}
+	friendLists.Invalidate(discordID)
+
+	if err := db.DeleteAccount(ctx, discordID); err != nil {
+		return reportError(ctx, fail("account.delete_failed", err), "Failed to delete account", "discordID", discordID)
+	}
+	slog.InfoContext(ctx, "Account deleted", "discordID", discordID)
+	return i18n.T(ctx, "account.deleted")
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	disc "github.com/aopontann/vrc-join-notify/internal/discord"
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+)
+
+// ユーザの状態（/admin stats で集計する）
+const (
+	userStatusActive      = "active"        // ログイン済みで通知対象のフレンドがいる
+	userStatusExpired     = "expired"       // トークンが無効になり、再ログインを待っている
+	userStatusNoTarget    = "no_target"     // ログイン済みだが通知対象のフレンドがいない
+	userStatusNotLoggedIn = "not_logged_in" // ログインしていない（2段階認証の途中を含む）
+	userStatusDisabled    = "disabled"      // 管理者が利用を停止した
+	userStatusUnreachable = "unreachable"   // Botをブロックしたなどの理由で通知を送信できない
+)
+
+// adminPollLockTTL は /admin poll で取得する通知処理のロックの有効期限（実行中は延長する）
+const adminPollLockTTL = time.Minute
+
+var userStatuses = []string{userStatusActive, userStatusExpired, userStatusNoTarget, userStatusNotLoggedIn, userStatusUnreachable, userStatusDisabled}
+
+// userStatus はユーザ情報からユーザの状態を求める。
+func userStatus(u firestore.UserInfo) string {
+	switch {
+	case u.Disabled:
+		return userStatusDisabled
+	case u.Unreachable:
+		return userStatusUnreachable
+	case u.Token == "" || u.TwoFactorAuthToken == "":
+		return userStatusNotLoggedIn
+	case u.Notificationed:
+		return userStatusExpired
+	case len(u.WatchTargets()) == 0:
+		return userStatusNoTarget
+	}
+	return userStatusActive
+}
+
+// runAdmin はボットの所有者向けの管理コマンドを実行する。
+// 所有者は設定ファイルの discord.owner_ids で指定する。戻り値はユーザに返すメッセージ
+func runAdmin(ctx context.Context, db *firestore.DB, discord *disc.Discord, vrc *vrc2.VRC, settings rule.Settings, owners []string, discordID string, subCmd disc.InteractionOption) string {
+	if !slices.Contains(owners, discordID) {
+		slog.WarnContext(ctx, "Admin command rejected", "discordID", discordID, "command", subCmd.Name)
+		return i18n.T(ctx, "admin.forbidden")
+	}
+
+	switch subCmd.Name {
+	case "stats":
+		return adminStats(ctx, db)
+	case "user":
+		return adminUser(ctx, db, subCmd.Option("user"))
+	case "poll":
+		targetID := subCmd.Option("user")
+		userInfo, msg := adminLoadUser(ctx, db, targetID)
+		if msg != "" {
+			return msg
+		}
+		// 定期的な通知処理と同時に実行して重複して通知しないよう、ロックを取ってから処理する
+		ran, err := poll(ctx, db, discord.Session, vrc, settings, PollOptions{LockTTL: adminPollLockTTL, UserID: targetID})
+		if err != nil {
+			return reportError(ctx, fail("admin.poll_failed", err), "Failed to poll user", "discordID", targetID)
+		}
+		if !ran {
+			return i18n.T(ctx, "admin.poll_locked")
+		}
+		return i18n.T(ctx, "admin.polled", "<@"+targetID+">", i18n.T(ctx, "admin.status."+userStatus(userInfo)))
+	case "history":
+		targetID := subCmd.Option("user")
+		if _, msg := adminLoadUser(ctx, db, targetID); msg != "" {
+			return msg
+		}
+		return showHistory(ctx, db, settings, targetID, subCmd.Option("limit"))
+	case "broadcast":
+		return adminBroadcast(ctx, db, discord, subCmd.Option("message"))
+	case "disable", "enable":
+		targetID := subCmd.Option("user")
+		if _, msg := adminLoadUser(ctx, db, targetID); msg != "" {
+			return msg
+		}
+		disabled := subCmd.Name == "disable"
+		if err := db.SaveUserDisabled(ctx, targetID, disabled); err != nil {
+			return reportError(ctx, fail("admin.save_failed", err), "Failed to save user disabled", "discordID", targetID)
+		}
+		slog.InfoContext(ctx, "User disabled changed", "discordID", targetID, "disabled", disabled, "by", discordID)
+		if disabled {
+			audit(ctx, db, targetID, auditDisabled, auditOK, "by", discordID)
+			return i18n.T(ctx, "admin.disabled", "<@"+targetID+">")
+		}
+		audit(ctx, db, targetID, auditEnabled, auditOK, "by", discordID)
+		return i18n.T(ctx, "admin.enabled", "<@"+targetID+">")
+	}
+	return i18n.T(ctx, "unsupported_command")
+}
+
+// adminStats はユーザ数と状態ごとの内訳を返す。
+func adminStats(ctx context.Context, db *firestore.DB) string {
+	userInfos, err := db.GetAllUserInfo(ctx)
+	if err != nil {
+		return reportError(ctx, fail("admin.users_failed", err), "Failed to get all user info")
+	}
+
+	counts := make(map[string]int)
+	for _, u := range userInfos {
+		counts[userStatus(u)]++
+	}
+
+	var b strings.Builder
+	b.WriteString(i18n.T(ctx, "admin.user_count", len(userInfos)) + "\n")
+	for _, s := range userStatuses {
+		fmt.Fprintf(&b, "- %s: %d\n", i18n.T(ctx, "admin.status."+s), counts[s])
+	}
+	return b.String()
+}
+
+// adminUser はユーザの状態を返す。トークンなどの秘密の情報は含めない。
+func adminUser(ctx context.Context, db *firestore.DB, targetID string) string {
+	u, msg := adminLoadUser(ctx, db, targetID)
+	if msg != "" {
+		return msg
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<@%s>（%s）\n", targetID, targetID)
+	b.WriteString("- " + i18n.T(ctx, "admin.field.status", i18n.T(ctx, "admin.status."+userStatus(u))) + "\n")
+	b.WriteString("- " + i18n.T(ctx, "admin.field.locale", i18n.Normalize(u.Locale)) + "\n")
+
+	var names []string
+	for _, id := range u.WatchTargets() {
+		names = append(names, watchTargetName(u, id))
+	}
+	b.WriteString("- " + i18n.T(ctx, "admin.field.targets", len(names), strings.Join(names, ", ")) + "\n")
+
+	notifier := notifierKind(u)
+	if u.NotifyChannelID != "" {
+		notifier += " <#" + u.NotifyChannelID + ">"
+	}
+	b.WriteString("- " + i18n.T(ctx, "admin.field.notifier", notifier) + "\n")
+
+	digest := "-"
+	if u.DigestEnabled {
+		digest = u.DigestTime + " " + u.DigestTimezone
+	}
+	b.WriteString("- " + i18n.T(ctx, "admin.field.digest", digest) + "\n")
+	return b.String()
+}
+
+// adminBroadcast は利用を停止していない全てのユーザにお知らせをDMで送信する。
+// 一部のユーザへの送信に失敗しても、残りのユーザへの送信は続ける。
+func adminBroadcast(ctx context.Context, db *firestore.DB, discord *disc.Discord, message string) string {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return i18n.T(ctx, "admin.empty_message")
+	}
+
+	userInfos, err := db.GetAllUserInfo(ctx)
+	if err != nil {
+		return reportError(ctx, fail("admin.users_failed", err), "Failed to get all user info")
+	}
+
+	var sent, failed int
+	for discordID, u := range userInfos {
+		if u.Disabled || u.ChannelID == "" {
+			continue
+		}
+		if _, err := discord.ChannelMessageSend(u.ChannelID, message); err != nil {
+			slog.WarnContext(ctx, "Failed to send announcement", "discordID", discordID, "error", err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	slog.InfoContext(ctx, "Announcement sent", "sent", sent, "failed", failed)
+	return i18n.T(ctx, "admin.broadcasted", sent, failed)
+}
+
+// adminLoadUser は管理コマンドの対象のユーザ情報を取得する。
+// 取得できなかった場合は、ユーザに返すメッセージを返す。
+func adminLoadUser(ctx context.Context, db *firestore.DB, targetID string) (firestore.UserInfo, string) {
+	u, err := db.GetUserInfo(ctx, targetID)
+	if errors.Is(err, firestore.ErrUserNotFound) {
+		return firestore.UserInfo{}, i18n.T(ctx, "admin.user_not_found")
+	}
+	if err != nil {
+		return firestore.UserInfo{}, reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", targetID)
+	}
+	return u, ""
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	disc "github.com/aopontann/vrc-join-notify/internal/discord"
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+)
+
+// 監査ログの操作の種類
+const (
+	auditCommand        = "command"            // スラッシュコマンドの実行
+	auditLogin          = "auth.login"         // ユーザ名とパスワードによるログイン
+	auditTwoFactor      = "auth.2fa"           // 2段階認証
+	auditSessionExpired = "auth.expired"       // トークンが無効になった
+	auditWatchAdd       = "join.register"      // 通知対象のフレンドの登録
+	auditWatchRemove    = "join.unregister"    // 通知対象のフレンドの登録解除
+	auditDelivery       = "notify.delivered"   // 通知の送信
+	auditAbandoned      = "notify.abandoned"   // 通知の再送を諦めた
+	auditUnreachable    = "notify.unreachable" // 通知先に送信できなくなった
+	auditReachable      = "notify.reachable"   // 通知先に送信できないユーザがコマンドを実行し、通知を再開した
+	auditDisabled       = "admin.disable"      // 管理者による利用停止
+	auditEnabled        = "admin.enable"       // 管理者による利用再開
+)
+
+// 監査ログの結果
+const (
+	auditOK       = "ok"
+	auditFailed   = "failed"
+	auditRejected = "rejected" // 権限がない、利用停止中などの理由で受け付けなかった
+)
+
+// 監査ログの詳細の値の最大文字数（テンプレートやお知らせの本文など、長い値は切り詰める）
+const maxAuditValueLength = 100
+
+// historyLimit は /history で表示する監査ログの件数の既定値と最大値
+const (
+	defaultHistoryLimit = 10
+	maxHistoryLimit     = 25
+)
+
+// redactedOptions は監査ログに値を残さないコマンドのオプション
+var redactedOptions = []string{"password", "code", "target"}
+
+// audit は監査ログを記録する。details は slog と同じくキーと値を交互に指定する。
+// 監査ログの記録に失敗しても元の処理は続ける。
+func audit(ctx context.Context, db *firestore.DB, discordID string, action string, outcome string, details ...string) {
+	e := firestore.AuditEvent{
+		DiscordID: discordID,
+		Action:    action,
+		Outcome:   outcome,
+		CreatedAt: time.Now(),
+	}
+	for i := 0; i+1 < len(details); i += 2 {
+		if e.Detail == nil {
+			e.Detail = make(map[string]string)
+		}
+		e.Detail[details[i]] = truncateRunes(details[i+1], maxAuditValueLength)
+	}
+
+	if err := db.AddAuditEvent(ctx, e); err != nil {
+		slog.WarnContext(ctx, "Failed to add audit event", "discordID", discordID, "action", action, "error", err)
+	}
+}
+
+// auditOutcome はエラーを監査ログの結果に変換する。
+func auditOutcome(err error) string {
+	if err != nil {
+		return auditFailed
+	}
+	return auditOK
+}
+
+// commandDetails はコマンド名とオプションの値を監査ログの詳細に変換する。
+// パスワードなどの秘密の情報を含むオプションは値を伏せる。
+func commandDetails(data *disc.InteractionData) []string {
+	details := []string{"command", commandName(data)}
+
+	opts := data.Options
+	for len(opts) > 0 && (opts[0].Type == int(discordgo.ApplicationCommandOptionSubCommandGroup) || opts[0].Type == int(discordgo.ApplicationCommandOptionSubCommand)) {
+		opts = opts[0].Options
+	}
+	for _, opt := range opts {
+		value := opt.Value
+		if slices.Contains(redactedOptions, opt.Name) {
+			value = "[redacted]"
+		}
+		details = append(details, opt.Name, value)
+	}
+	return details
+}
+
+// showHistory は監査ログを新しい順に表示する。
+// 本人の /history と管理者の /admin history から呼び出される。戻り値はユーザに返すメッセージ
+func showHistory(ctx context.Context, db *firestore.DB, settings rule.Settings, discordID string, limitOption string) string {
+	limit := defaultHistoryLimit
+	if limitOption != "" {
+		n, err := strconv.Atoi(limitOption)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			return i18n.T(ctx, "history.invalid_limit", maxHistoryLimit)
+		}
+		limit = n
+	}
+
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+	events, err := db.GetAuditEvents(ctx, discordID, limit)
+	if err != nil {
+		return reportError(ctx, fail("history.failed", err), "Failed to get audit events", "discordID", discordID)
+	}
+	if len(events) == 0 {
+		return i18n.T(ctx, "history.empty")
+	}
+
+	loc := userLocation(settings, userInfo)
+	var b strings.Builder
+	b.WriteString(i18n.T(ctx, "history.header") + "\n")
+	for _, e := range events {
+		fmt.Fprintf(&b, "- %s %s %s", e.CreatedAt.In(loc).Format("2006-01-02 15:04"), auditActionLabel(ctx, e.Action), i18n.T(ctx, "history.outcome."+e.Outcome))
+		if d := formatAuditDetail(e.Detail); d != "" {
+			b.WriteString(" `" + d + "`")
+		}
+		b.WriteString("\n")
+	}
+	return truncateRunes(b.String(), 2000)
+}
+
+// auditActionLabel は操作の種類を表示名に変換する。未知の種類はそのまま表示する。
+func auditActionLabel(ctx context.Context, action string) string {
+	if _, ok := i18n.Lookup(i18n.FromContext(ctx), "history.action."+action); ok {
+		return i18n.T(ctx, "history.action."+action)
+	}
+	return action
+}
+
+// formatAuditDetail は監査ログの詳細を key=value の形式でキーの順に並べる。
+func formatAuditDetail(detail map[string]string) string {
+	keys := make([]string, 0, len(detail))
+	for k := range detail {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+detail[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// truncateRunes は文字列を最大 n 文字に切り詰める。
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
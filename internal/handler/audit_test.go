@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	disc "github.com/aopontann/vrc-join-notify/internal/discord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCommandDetails(t *testing.T) {
+	subCommand := int(discordgo.ApplicationCommandOptionSubCommand)
+	group := int(discordgo.ApplicationCommandOptionSubCommandGroup)
+	str := int(discordgo.ApplicationCommandOptionString)
+
+	tests := []struct {
+		name string
+		data *disc.InteractionData
+		want []string
+	}{
+		{
+			name: "no options",
+			data: &disc.InteractionData{Name: "history"},
+			want: []string{"command", "history"},
+		},
+		{
+			name: "password",
+			data: &disc.InteractionData{Name: "auth", Options: []disc.InteractionOption{
+				{Name: "login", Type: subCommand, Options: []disc.InteractionOption{
+					{Name: "username", Type: str, Value: "alice"},
+					{Name: "password", Type: str, Value: "hunter2"},
+				}},
+			}},
+			want: []string{"command", "auth login", "username", "alice", "password", "[redacted]"},
+		},
+		{
+			name: "two factor code",
+			data: &disc.InteractionData{Name: "auth", Options: []disc.InteractionOption{
+				{Name: "email-code", Type: subCommand, Options: []disc.InteractionOption{
+					{Name: "code", Type: str, Value: "123456"},
+				}},
+			}},
+			want: []string{"command", "auth email-code", "code", "[redacted]"},
+		},
+		{
+			name: "notifier target in a group",
+			data: &disc.InteractionData{Name: "notify", Options: []disc.InteractionOption{
+				{Name: "sink", Type: group, Options: []disc.InteractionOption{
+					{Name: "set", Type: subCommand, Options: []disc.InteractionOption{
+						{Name: "type", Type: str, Value: "slack"},
+						{Name: "target", Type: str, Value: "https://hooks.slack.com/services/T000/B000/secret"},
+					}},
+				}},
+			}},
+			want: []string{"command", "notify sink set", "type", "slack", "target", "[redacted]"},
+		},
+	}
+	for _, tt := range tests {
+		if got := commandDetails(tt.data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: commandDetails() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
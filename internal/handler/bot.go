@@ -1,22 +1,33 @@
 package handler
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
 	disc "github.com/aopontann/vrc-join-notify/internal/discord"
 	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/metrics"
+	"github.com/aopontann/vrc-join-notify/internal/notify"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/tracing"
 	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
 	"github.com/bwmarrin/discordgo"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func DiscordBotHandler(db *firestore.DB) http.HandlerFunc {
+func DiscordBotHandler(db *firestore.DB, discord *disc.Discord, vrc *vrc2.VRC, settings rule.Settings, owners []string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		discord, _ := disc.New()
-
 		// Discord インタラクションの事前認証
 		ok, err := discord.VerifyInteraction(r)
 		if err != nil {
@@ -33,13 +44,40 @@ func DiscordBotHandler(db *firestore.DB) http.HandlerFunc {
 		// ただ、タイプ種類は必ずデータに含まれているため、タイプ種類を取得する
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			slog.Error("Error reading request body: " + err.Error())
+			slog.ErrorContext(r.Context(), "Error reading request body: "+err.Error())
 			http.Error(w, "Error reading request body", http.StatusInternalServerError)
 			return
 		}
-		fmt.Println("Request body:", string(body))
 
 		eventType, userID, channelID, interactionData, err := discord.GetEventInfo(body)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid event payload", "error", err)
+			http.Error(w, "invalid event payload", http.StatusBadRequest)
+			return
+		}
+		// ボディにはパスワードや確認コードが含まれるため、種類だけを記録する
+		slog.DebugContext(r.Context(), "Received interaction", "eventType", eventType)
+
+		// インタラクションごとにスパンを作成し、DBやVRChat APIへのアクセスを紐付ける
+		ctx, span := tracing.Start(r.Context(), "discord.interaction",
+			attribute.Int("discord.event_type", eventType),
+			attribute.String("discord.command", commandName(interactionData)),
+		)
+		defer span.End()
+
+		// コマンドを実行したユーザの言語でメッセージを返す
+		if interactionData != nil {
+			ctx = i18n.NewContext(ctx, interactionData.Locale)
+		}
+
+		// スラッシュコマンドごとの実行回数と結果を記録する
+		if eventType == disc.SlashCommand {
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			w = rec
+			defer func() {
+				metrics.SlashCommands.WithLabelValues(commandName(interactionData), rec.outcome()).Inc()
+			}()
+		}
 
 		// Webhooks登録時の処理（イベント発生時にリクエストを飛ばすURLを登録する際に必要な処理　初回のみ
 		// Interactions Endpoint URL登録時に必要な処理
@@ -53,11 +91,9 @@ func DiscordBotHandler(db *firestore.DB) http.HandlerFunc {
 			}
 
 			w.Header().Set("Content-Type", "application/json")
-			_, err = w.Write(pongResp)
-			if err != nil {
-				return
+			if _, err := w.Write(pongResp); err != nil {
+				slog.WarnContext(ctx, "Failed to write pong response", "error", err)
 			}
-			w.WriteHeader(http.StatusOK)
 			return
 		}
 
@@ -66,167 +102,777 @@ func DiscordBotHandler(db *firestore.DB) http.HandlerFunc {
 			// DMチャンネルを作成
 			ch, err := discord.UserChannelCreate(userID)
 			if err != nil {
-				http.Error(w, "Error creating user channel", http.StatusInternalServerError)
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
 				return
 			}
 
-			slog.Info("Creating user channel", "channel_id", ch.ID)
+			slog.InfoContext(ctx, "Creating user channel", "channel_id", ch.ID)
 
 			// チャンネルにメッセージを送信
-			c := `
-アプリのインストールが完了しました。
-指定したフレンドが「だれでもおいで」ステータスになったとき通知を受け取れるアプリです。
-操作は基本的にスラッシュコマンドを用います。
-スラッシュコマンドは画面下のゲームパッドボタンから実行できます。
-スラッシュコマンド一覧
-- /auth login		ログイン
-- /auth logout		ログアウト
-- /auth email-code	2段階認証
-- /join register	通知登録
-
-使い方
-1. ユーザ名とパスワードを指定してログインコマンドを実行してください。
-2. 「メールに認証コードが送信されました。」と表示された場合は、メールに届いた番号を指定して2段階認証コマンドを実行してください。
-3. 通知を受け取りたいフレンドのVRChatのWEBページのURLを指定して、通知登録コマンドを実行してください。
-4. 指定したフレンドが「だれでもおいで」ステータスになったとき通知が届きます。
-
-備考
-- 「再ログインしてください。」とメッセージが届いた場合、ログインコマンドを再実行してください。
-- 通知対象のフレンドは1人のみ指定できます。
-- 他のフレンドの通知を受け取りたい場合、通知登録コマンドを再実行してください。
-- フレンドのVRChatのWEBページのURLは次のようなものです。（https://vrchat.com/home/user/XXXXXX）
-`
+			// インストール時のイベントにはユーザの言語設定が含まれないため、既定の言語で送信する
+			c := i18n.T(ctx, "onboarding.user", settings.MaxWatchTargets)
 
 			if _, err := discord.ChannelMessageSend(ch.ID, c); err != nil {
-				http.Error(w, "Error sending message", http.StatusInternalServerError)
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
 				return
 			}
-			slog.Info("Received interaction type 1, sending response")
+			slog.InfoContext(ctx, "Received interaction type 1, sending response")
 
 			// チャンネルIDとユーザIDを保存する処理を追加
-			err = db.SaveUserInfo(userID, ch.ID)
+			err = db.SaveUserInfo(ctx, userID, ch.ID)
+			if err != nil {
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// アプリをサーバーにインストールしたときのイベント処理
+		if eventType == disc.GuildInstall {
+			// インストールしたユーザにDMで案内を送る
+			ch, err := discord.UserChannelCreate(userID)
+			if err != nil {
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+				return
+			}
+
+			c := i18n.T(ctx, "onboarding.guild")
+			if _, err := discord.ChannelMessageSend(ch.ID, c); err != nil {
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+				return
+			}
+
+			if err := db.SaveUserInfo(ctx, userID, ch.ID); err != nil {
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// アプリをアンインストール（認可を取り消し）したときのイベント処理
+		if eventType == disc.ApplicationUninstall {
+			slog.InfoContext(ctx, "Application deauthorized", "discordID", userID)
+
+			// VRChatのセッションを終了させる
+			userInfo, err := db.GetUserInfo(ctx, userID)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to get user info on deauthorization", "discordID", userID, "error", err)
+			} else if userInfo.Token != "" {
+				if err := vrc.Logout(ctx, userInfo.Token, userInfo.TwoFactorAuthToken); err != nil {
+					slog.ErrorContext(ctx, "Failed to revoke VRChat session", "discordID", userID, "error", err)
+				}
+			}
+			friendLists.Invalidate(userID)
+
+			// 監査ログやダイジェストを含め、ユーザに関連する全てのデータを削除する
+			// ユーザ情報がなくなるため、以降の通知処理の対象からも外れる
+			if err := db.DeleteAccount(ctx, userID); err != nil {
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// 未対応のWebhookイベントは受信したことだけ返す
+		if eventType == disc.UnsupportedEvent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// スラッシュコマンドのオプション入力中の補完処理
+		if eventType == disc.Autocomplete {
+			resp, err := json.Marshal(discordgo.InteractionResponse{
+				Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+				Data: &discordgo.InteractionResponseData{
+					Choices: autocompleteChoices(ctx, db, vrc, userID, interactionData),
+				},
+			})
+			if err != nil {
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := w.Write(resp); err != nil {
+				slog.ErrorContext(ctx, "Failed to write autocomplete response", "error", err)
+			}
+			return
+		}
+
+		// メッセージのボタンを押したときの処理
+		// ボタンのメッセージを処理結果で置き換え、ボタンを取り除く
+		if eventType == disc.MessageComponent {
+			msg := runComponent(ctx, db, vrc, settings, userID, interactionData.CustomID)
+			resp, err := json.Marshal(discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseUpdateMessage,
+				Data: &discordgo.InteractionResponseData{
+					Content:    msg,
+					Components: []discordgo.MessageComponent{},
+				},
+			})
 			if err != nil {
-				http.Error(w, "Error unmarshalling request body", http.StatusInternalServerError)
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
 				return
 			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := w.Write(resp); err != nil {
+				slog.ErrorContext(ctx, "Failed to write component response", "error", err)
+			}
+			return
 		}
 
 		// スラッシュコマンドの実行時の処理
 		if eventType == disc.SlashCommand {
-			// 認証関連処理
-			if interactionData.Name == "auth" {
-				vrc := vrc2.NewVRC()
-				subCmdInfo := interactionData.Options[0]
-
-				// ログイン処理（ユーザ名とパスワードを取得）
-				if subCmdInfo.Name == "login" {
-					username := subCmdInfo.Options[0].Value
-					password := subCmdInfo.Options[1].Value
-					token, err := vrc.Login(username, password)
-					if err != nil {
-						if _, err := discord.ChannelMessageSend(channelID, err.Error()); err != nil {
-							http.Error(w, "Error sending message", http.StatusInternalServerError)
-							return
-						}
-					}
-
-					err = db.SaveUserToken(userID, token)
-					if err != nil {
-						if _, err := discord.ChannelMessageSend(channelID, err.Error()); err != nil {
-							http.Error(w, "Error sending message", http.StatusInternalServerError)
-							return
-						}
-					}
-
-					// トークンが有効かされたかチェック　メール認証が必要な場合は無効になる
-					ok, err := vrc.VerifyAuthToken(token)
-					if err != nil {
-						ErrorHandler(w, err, http.StatusInternalServerError)
-					}
-
-					if !ok {
-						if _, err := discord.ChannelMessageSend(channelID, "メールに認証コードが送信されました。"); err != nil {
-							ErrorHandler(w, err, http.StatusInternalServerError)
-						}
-					} else {
-						if err := db.ChangeNotificationed(userID, false); err != nil {
-							ErrorHandler(w, err, http.StatusInternalServerError)
-						}
-						if _, err := discord.ChannelMessageSend(channelID, "ログインしました。"); err != nil {
-							ErrorHandler(w, err, http.StatusInternalServerError)
-						}
-					}
-				}
+			if err := runCommand(ctx, db, discord, vrc, settings, owners, userID, channelID, interactionData); err != nil {
+				ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+				return
+			}
+		}
+		writeOK(ctx, w)
+	}
+}
 
-				if subCmdInfo.Name == "logout" {
-					if _, err := discord.ChannelMessageSend(channelID, "未実装"); err != nil {
-						http.Error(w, "Error sending message", http.StatusInternalServerError)
-						return
-					}
-				}
+// runCommand はスラッシュコマンドを実行し、結果をコマンドを実行したチャンネルに送信する。
+// HTTPのインタラクションエンドポイントとGatewayの両方から呼び出される。
+// コマンドの失敗はユーザへのメッセージで伝えるため、エラーを返すのは結果を送信できなかった場合のみ
+func runCommand(ctx context.Context, db *firestore.DB, discord *disc.Discord, vrc *vrc2.VRC, settings rule.Settings, owners []string, userID string, channelID string, interactionData *disc.InteractionData) error {
+	// 非同期の通知をユーザの言語で送信するため、言語設定を保存する
+	caller := rememberLocale(ctx, db, userID, interactionData.Locale)
+
+	// 利用を停止されたユーザのコマンドは受け付けない
+	// 所有者が自身を停止しても戻せるよう /admin は、個人データの確認・削除はできるよう /account は除く
+	if caller.Disabled && interactionData.Name != "admin" && interactionData.Name != "account" {
+		audit(ctx, db, userID, auditCommand, auditRejected, commandDetails(interactionData)...)
+		_, err := discord.ChannelMessageSend(channelID, i18n.T(ctx, "account.disabled"))
+		return err
+	}
+	audit(ctx, db, userID, auditCommand, auditOK, commandDetails(interactionData)...)
+
+	// 通知先に送信できなかったユーザがコマンドを実行した場合は、Botのブロックが解除されたとみなして通知を再開する
+	if caller.Unreachable {
+		if err := db.SaveUnreachable(ctx, userID, false); err != nil {
+			slog.ErrorContext(ctx, "Failed to clear unreachable", "discordID", userID, "error", err)
+		} else {
+			audit(ctx, db, userID, auditReachable, auditOK)
+		}
+	}
+
+	// 管理者向けの処理
+	if interactionData.Name == "admin" {
+		msg := runAdmin(ctx, db, discord, vrc, settings, owners, userID, interactionData.Options[0])
+		if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+			return err
+		}
+	}
 
-				// ログイン処理（2FA）
-				if subCmdInfo.Name == "email-code" {
-					code := subCmdInfo.Options[0].Value
-					// DBからユーザのトークンを取得
-					userInfo, err := db.GetUserInfo(userID)
-					if err != nil {
-						if _, err := discord.ChannelMessageSend(channelID, err.Error()); err != nil {
-							http.Error(w, "Error sending message", http.StatusInternalServerError)
-							return
-						}
-					}
-
-					twoFactorAuthToken, err := vrc.Verify2FA(code, userInfo.Token)
-					if err != nil {
-						if _, err := discord.ChannelMessageSend(channelID, err.Error()); err != nil {
-							http.Error(w, "Error sending message", http.StatusInternalServerError)
-							return
-						}
-					}
-
-					err = db.SaveUserTwoFactorAuthToken(userID, twoFactorAuthToken)
-					if err != nil {
-						if _, err := discord.ChannelMessageSend(channelID, err.Error()); err != nil {
-							http.Error(w, "Error sending message", http.StatusInternalServerError)
-							return
-						}
-					}
-
-					if _, err := discord.ChannelMessageSend(channelID, "OK"); err != nil {
-						http.Error(w, "Error sending message", http.StatusInternalServerError)
-						return
-					}
+	// 個人データのエクスポートとアカウントの削除
+	if interactionData.Name == "account" {
+		subCmdInfo := interactionData.Options[0]
+		if subCmdInfo.Name == "export" {
+			// ファイルは本人のDMに送り、コマンドを実行したチャンネルには結果のみ返す
+			dmChannelID, m, msg := exportAccount(ctx, db, userID)
+			if m != nil {
+				if _, err := discord.Session.ChannelMessageSendComplex(dmChannelID, m); err != nil {
+					msg = reportError(ctx, fail("account.export_failed", err), "Failed to send exported data", "discordID", userID)
+				} else {
+					msg = i18n.T(ctx, "account.export_sent")
 				}
 			}
+			if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+				return err
+			}
+		}
+		if subCmdInfo.Name == "delete" {
+			if _, err := discord.Session.ChannelMessageSendComplex(channelID, confirmDeleteAccount(ctx, userID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 監査ログの表示
+	if interactionData.Name == "history" {
+		var limit string
+		for _, opt := range interactionData.Options {
+			if opt.Name == "limit" {
+				limit = opt.Value
+			}
+		}
+		msg := showHistory(ctx, db, settings, userID, limit)
+		if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+			return err
+		}
+	}
+
+	// 認証関連処理
+	if interactionData.Name == "auth" {
+		msg := authenticate(ctx, db, vrc, userID, interactionData.Options[0])
+		if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+			return err
+		}
+	}
+
+	// 通知先関連処理
+	if interactionData.Name == "notify" {
+		group := interactionData.Options[0]
+		if group.Name == "channel" {
+			msg := configureNotifyChannel(ctx, discord, db, userID, interactionData, group.Options[0])
+			if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+				return err
+			}
+		}
+		if group.Name == "sink" {
+			msg := configureNotifier(ctx, db, settings, userID, group.Options[0])
+			if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 統計関連処理
+	if interactionData.Name == "stats" {
+		subCmdInfo := interactionData.Options[0]
+		if subCmdInfo.Name == "summary" {
+			msg := statsSummary(ctx, db, vrc, settings, userID, subCmdInfo.Option("weeks"), subCmdInfo.Option("user"))
+			if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+				return err
+			}
+		}
+		if subCmdInfo.Name == "heatmap" {
+			m, msg := statsHeatmap(ctx, db, settings, userID, subCmdInfo.Option("weeks"), subCmdInfo.Option("user"))
+			if m == nil {
+				m = &discordgo.MessageSend{Content: msg}
+			}
+			if _, err := discord.Session.ChannelMessageSendComplex(channelID, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	// ダイジェスト関連処理
+	if interactionData.Name == "digest" {
+		msg := configureDigest(ctx, db, settings, userID, interactionData.Options[0])
+		if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+			return err
+		}
+	}
+
+	// 設定関連処理
+	if interactionData.Name == "settings" {
+		group := interactionData.Options[0]
+		if group.Name == "template" {
+			msg := configureTemplate(ctx, db, settings, userID, group.Options[0])
+			if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+				return err
+			}
+		}
+	}
+
+	// エクスポート関連処理
+	if interactionData.Name == "export" {
+		subCmdInfo := interactionData.Options[0]
+		if subCmdInfo.Name == "calendar" {
+			m, msg := exportCalendar(ctx, db, settings, userID, subCmdInfo.Option("regenerate") == "true")
+			if m == nil {
+				m = &discordgo.MessageSend{Content: msg}
+			}
+			if _, err := discord.Session.ChannelMessageSendComplex(channelID, m); err != nil {
+				return err
+			}
+		}
+	}
 
-			// JOIN通知関連処理
-			if interactionData.Name == "join" {
-				subCmdInfo := interactionData.Options[0]
-
-				// JOIN通知対象のユーザIDを登録
-				if subCmdInfo.Name == "register" {
-					url := subCmdInfo.Options[0].Value // https://vrchat.com/home/user/usr_33a8da12-14f4-4225-8711-320471ceb60b
-					targetUserID := url[len("https://vrchat.com/home/user/"):]
-					err := db.SaveTargetUser(userID, targetUserID)
-					if err != nil {
-						if _, err := discord.ChannelMessageSend(channelID, err.Error()); err != nil {
-							http.Error(w, "Error sending message", http.StatusInternalServerError)
-							return
-						}
-					} else {
-						if _, err := discord.ChannelMessageSend(channelID, "OK"); err != nil {
-							http.Error(w, "Error sending message", http.StatusInternalServerError)
-							return
-						}
-					}
+	// JOIN通知関連処理
+	if interactionData.Name == "join" {
+		subCmdInfo := interactionData.Options[0]
+
+		var msg string
+		switch subCmdInfo.Name {
+		// JOIN通知対象のユーザIDを登録
+		case "register":
+			// URL（https://vrchat.com/home/user/usr_xxx）、ユーザID、表示名のいずれかを受け付ける
+			// 特定したフレンドの表示名を確認ボタン付きで返し、確認してから登録する
+			var m *discordgo.MessageSend
+			m, msg = registerTargetUser(ctx, db, vrc, settings, userID, subCmdInfo.Options[0].Value)
+			if m != nil {
+				if _, err := discord.Session.ChannelMessageSendComplex(channelID, m); err != nil {
+					return err
 				}
 			}
+		case "unregister":
+			msg = unregisterTargetUser(ctx, db, userID, subCmdInfo.Option("user"))
+		case "list":
+			msg = listTargetUsers(ctx, db, userID)
+		case "gathering":
+			msg = configureGathering(ctx, db, settings, userID, subCmdInfo.Option("min"))
 		}
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("OK")); err != nil {
-			http.Error(w, "Error sending message", http.StatusInternalServerError)
-			return
+		if msg != "" {
+			if _, err := discord.ChannelMessageSend(channelID, msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runComponent はメッセージのボタンを押したときの処理を行う。
+// ボタンのIDは「操作:コマンドを実行したユーザのID[:引数]」の形式
+// 戻り値はボタンのメッセージを置き換えるメッセージ
+func runComponent(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, settings rule.Settings, discordID string, customID string) string {
+	action, rest, _ := strings.Cut(customID, ":")
+	ownerID, arg, _ := strings.Cut(rest, ":")
+	// 確認メッセージはコマンドを実行したユーザのみ操作できる（サーバーのチャンネルでは他のユーザも押せるため）
+	if ownerID != discordID {
+		return i18n.T(ctx, "account.not_yours")
+	}
+
+	switch action {
+	case accountDeleteConfirmID:
+		return deleteAccount(ctx, db, vrc, discordID)
+	case accountDeleteCancelID:
+		return i18n.T(ctx, "account.delete_canceled")
+	case joinRegisterConfirmID:
+		return confirmRegisterTarget(ctx, db, vrc, settings, discordID, arg)
+	case joinRegisterCancelID:
+		return i18n.T(ctx, "join.register_canceled")
+	}
+	return i18n.T(ctx, "unsupported_command")
+}
+
+// authenticate はVRChatへのログイン・2段階認証を行う。
+// 途中で失敗した場合はそれ以降の処理を行わない。戻り値はユーザに返すメッセージ
+func authenticate(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, discordID string, subCmd disc.InteractionOption) string {
+	switch subCmd.Name {
+	// ログイン処理（ユーザ名とパスワードを取得）
+	case "login":
+		token, err := vrc.Login(ctx, subCmd.Option("username"), subCmd.Option("password"))
+		if errors.Is(err, vrc2.ErrLoginFailed) {
+			audit(ctx, db, discordID, auditLogin, auditFailed, "reason", "invalid_credentials")
+			return i18n.T(ctx, "auth.login_failed")
+		}
+		if err != nil {
+			audit(ctx, db, discordID, auditLogin, auditFailed, "reason", "error")
+			return reportError(ctx, fail("auth.login_error", err), "Failed to log in", "discordID", discordID)
+		}
+		if err := db.SaveUserToken(ctx, discordID, token); err != nil {
+			return reportError(ctx, fail("auth.save_failed", err), "Failed to save token", "discordID", discordID)
+		}
+
+		// トークンが有効かされたかチェック　メール認証が必要な場合は無効になる
+		ok, err := vrc.VerifyAuthToken(ctx, token)
+		if err != nil {
+			return reportError(ctx, fail("auth.login_error", err), "Failed to verify token", "discordID", discordID)
+		}
+		if !ok {
+			audit(ctx, db, discordID, auditLogin, auditOK, "two_factor", "email_code")
+			return i18n.T(ctx, "auth.email_code_sent")
+		}
+		audit(ctx, db, discordID, auditLogin, auditOK)
+		return completeLogin(ctx, db, discordID)
+	case "logout":
+		return i18n.T(ctx, "not_implemented")
+	// ログイン処理（2FA）
+	case "email-code":
+		// DBからユーザのトークンを取得
+		userInfo, err := db.GetUserInfo(ctx, discordID)
+		if err != nil {
+			return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+		}
+		if userInfo.Token == "" {
+			return i18n.T(ctx, "join.login_required")
+		}
+
+		twoFactorAuthToken, err := vrc.Verify2FA(ctx, subCmd.Option("code"), userInfo.Token)
+		if errors.Is(err, vrc2.ErrTwoFactorFailed) {
+			audit(ctx, db, discordID, auditTwoFactor, auditFailed, "reason", "invalid_code")
+			return i18n.T(ctx, "auth.code_failed")
+		}
+		if err != nil {
+			audit(ctx, db, discordID, auditTwoFactor, auditFailed, "reason", "error")
+			return reportError(ctx, fail("auth.login_error", err), "Failed to verify 2FA", "discordID", discordID)
+		}
+		if err := db.SaveUserTwoFactorAuthToken(ctx, discordID, twoFactorAuthToken); err != nil {
+			return reportError(ctx, fail("auth.save_failed", err), "Failed to save two-factor auth token", "discordID", discordID)
+		}
+		audit(ctx, db, discordID, auditTwoFactor, auditOK)
+		return completeLogin(ctx, db, discordID)
+	}
+	return i18n.T(ctx, "unsupported_command")
+}
+
+// completeLogin はログインが完了したときに、以前のセッションの状態をリセットする。
+func completeLogin(ctx context.Context, db *firestore.DB, discordID string) string {
+	// 新しいセッションでフレンド一覧を取得し直す
+	friendLists.Invalidate(discordID)
+	// 再びトークンが無効になったときに再ログインを促せるようにする
+	if err := db.ChangeNotificationed(ctx, discordID, false); err != nil {
+		return reportError(ctx, fail("auth.save_failed", err), "Failed to reset notificationed", "discordID", discordID)
+	}
+	return i18n.T(ctx, "auth.logged_in")
+}
+
+// autocompleteChoices はスラッシュコマンドのオプション入力中の補完候補を返す。
+func autocompleteChoices(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, userID string, interactionData *disc.InteractionData) []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	if interactionData.Name == "join" && interactionData.Options[0].Name == "register" {
+		choices = friendChoices(ctx, db, vrc, userID, interactionData.Options[0].Options[0].Value)
+	} else if focused, ok := focusedOption(interactionData.Options[0]); ok && focused.Name == "user" {
+		// 通知対象のフレンドを指定するオプション
+		choices = watchTargetChoices(ctx, db, userID, focused.Value)
+	}
+	return choices
+}
+
+// 通知対象の登録の確認ボタンのID（: の後にコマンドを実行したユーザのID、登録するフレンドのIDが続く）
+const (
+	joinRegisterConfirmID = "join.register.confirm"
+	joinRegisterCancelID  = "join.register.cancel"
+)
+
+// registerTargetUser は指定された文字列からフレンドを特定し、登録を確認するボタン付きのメッセージを返す。
+// 登録は確認ボタンが押されたときに confirmRegisterTarget で行う。
+// フレンドを特定できなかった場合などはユーザに返すメッセージを返す
+func registerTargetUser(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, settings rule.Settings, discordID string, input string) (*discordgo.MessageSend, string) {
+	ref, err := vrc2.ParseUserRef(input)
+	if err != nil {
+		return nil, i18n.T(ctx, "join.invalid_user")
+	}
+
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return nil, reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+	if userInfo.Token == "" {
+		return nil, i18n.T(ctx, "join.login_required")
+	}
+
+	// フレンドでなければステータスを取得できないため、フレンド一覧から探す
+	friends, err := friendLists.Get(ctx, vrc, discordID, userInfo.Token, userInfo.TwoFactorAuthToken)
+	if err != nil {
+		return nil, reportError(ctx, fail("join.friends_failed", err), "Failed to get friends", "discordID", discordID)
+	}
+
+	friend, err := vrc2.FindFriend(friends, ref)
+	if errors.Is(err, vrc2.ErrAmbiguousDisplayName) {
+		return nil, i18n.T(ctx, "join.ambiguous_name", ref.DisplayName)
+	}
+	if err != nil {
+		return nil, i18n.T(ctx, "join.friend_not_found")
+	}
+	if msg := checkWatchTarget(ctx, settings, userInfo, friend); msg != "" {
+		return nil, msg
+	}
+
+	return &discordgo.MessageSend{
+		Content: i18n.T(ctx, "join.register_confirm", friend.DisplayName, friend.ID),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    i18n.T(ctx, "join.register_button"),
+						Style:    discordgo.PrimaryButton,
+						CustomID: joinRegisterConfirmID + ":" + discordID + ":" + friend.ID,
+					},
+					discordgo.Button{
+						Label:    i18n.T(ctx, "join.cancel_button"),
+						Style:    discordgo.SecondaryButton,
+						CustomID: joinRegisterCancelID + ":" + discordID,
+					},
+				},
+			},
+		},
+	}, ""
+}
+
+// confirmRegisterTarget は確認ボタンが押されたフレンドをJOIN通知対象として登録する。
+// 確認している間に登録の状態が変わることがあるため、登録できるかどうかを改めて確認する。
+// 戻り値はユーザに返すメッセージ
+func confirmRegisterTarget(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, settings rule.Settings, discordID string, targetID string) string {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+	if userInfo.Disabled {
+		return i18n.T(ctx, "account.disabled")
+	}
+	if userInfo.Token == "" {
+		return i18n.T(ctx, "join.login_required")
+	}
+
+	friends, err := friendLists.Get(ctx, vrc, discordID, userInfo.Token, userInfo.TwoFactorAuthToken)
+	if err != nil {
+		return reportError(ctx, fail("join.friends_failed", err), "Failed to get friends", "discordID", discordID)
+	}
+	friend, err := vrc2.FindFriend(friends, vrc2.UserRef{ID: targetID})
+	if err != nil {
+		return i18n.T(ctx, "join.friend_not_found")
+	}
+	if msg := checkWatchTarget(ctx, settings, userInfo, friend); msg != "" {
+		return msg
+	}
+
+	if err := db.AddWatchTarget(ctx, discordID, friend.ID); err != nil {
+		return reportError(ctx, fail("join.register_failed", err), "Failed to save target user", "discordID", discordID)
+	}
+
+	audit(ctx, db, discordID, auditWatchAdd, auditOK, "target", friend.ID)
+	return i18n.T(ctx, "join.registered", friend.DisplayName, friend.ID)
+}
+
+// checkWatchTarget はフレンドを通知対象に登録できるかどうかを確認する。
+// 登録できない場合はユーザに返すメッセージを返す
+func checkWatchTarget(ctx context.Context, settings rule.Settings, userInfo firestore.UserInfo, friend vrc2.Friend) string {
+	targets := userInfo.WatchTargets()
+	if slices.Contains(targets, friend.ID) {
+		return i18n.T(ctx, "join.already_registered", friend.DisplayName)
+	}
+	if len(targets) >= settings.MaxWatchTargets {
+		return i18n.T(ctx, "join.limit", settings.MaxWatchTargets)
+	}
+	return ""
+}
+
+// unregisterTargetUser は通知対象のフレンドの登録を解除する。
+// 戻り値はユーザに返すメッセージ
+func unregisterTargetUser(ctx context.Context, db *firestore.DB, discordID string, input string) string {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+
+	targetID, msg := resolveWatchTarget(ctx, userInfo, input)
+	if msg != "" {
+		return msg
+	}
+
+	if err := db.RemoveWatchTarget(ctx, discordID, targetID); err != nil {
+		return reportError(ctx, fail("join.unregister_failed", err), "Failed to remove target user", "discordID", discordID)
+	}
+	audit(ctx, db, discordID, auditWatchRemove, auditOK, "target", targetID)
+	return i18n.T(ctx, "join.unregistered", watchTargetName(userInfo, targetID))
+}
+
+// listTargetUsers は通知対象のフレンドの一覧を返す。
+func listTargetUsers(ctx context.Context, db *firestore.DB, discordID string) string {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+
+	targets := userInfo.WatchTargets()
+	if len(targets) == 0 {
+		return i18n.T(ctx, "join.empty")
+	}
+
+	var b strings.Builder
+	b.WriteString(i18n.T(ctx, "join.list") + "\n")
+	for _, id := range targets {
+		fmt.Fprintf(&b, "- %s（%s）\n", watchTargetName(userInfo, id), id)
+	}
+	if userInfo.GatheringMin >= 2 {
+		b.WriteString("\n" + i18n.T(ctx, "join.list_gathering", userInfo.GatheringMin) + "\n")
+	}
+	return b.String()
+}
+
+// configureGathering は何人以上の通知対象のフレンドが集まったら通知するかを設定する。
+func configureGathering(ctx context.Context, db *firestore.DB, settings rule.Settings, discordID string, minOption string) string {
+	min, err := strconv.Atoi(minOption)
+	if err != nil || min == 1 || min < 0 || min > settings.MaxWatchTargets {
+		return i18n.T(ctx, "gathering.invalid_min", settings.MaxWatchTargets)
+	}
+
+	if err := db.SaveGatheringMin(ctx, discordID, min); err != nil {
+		return reportError(ctx, fail("gathering.save_failed", err), "Failed to save gathering min", "discordID", discordID)
+	}
+	if min == 0 {
+		return i18n.T(ctx, "gathering.disabled")
+	}
+	return i18n.T(ctx, "gathering.enabled", min)
+}
+
+// resolveWatchTarget は通知対象のフレンドの中から、ユーザID・URL・表示名に一致するフレンドのユーザIDを返す。
+// input が空の場合は最初に登録したフレンドを返す。
+// 見つからなかった場合は、ユーザに返すメッセージを返す。
+func resolveWatchTarget(ctx context.Context, userInfo firestore.UserInfo, input string) (string, string) {
+	targets := userInfo.WatchTargets()
+	if len(targets) == 0 {
+		return "", i18n.T(ctx, "join.targets_required")
+	}
+	if strings.TrimSpace(input) == "" {
+		return targets[0], ""
+	}
+
+	ref, err := vrc2.ParseUserRef(input)
+	if err != nil {
+		return "", i18n.T(ctx, "join.unresolved_user")
+	}
+
+	// 通知対象の表示名は最後に観測したプレゼンスから求める
+	friends := make([]vrc2.Friend, 0, len(targets))
+	for _, id := range targets {
+		friends = append(friends, vrc2.Friend{ID: id, DisplayName: userInfo.LastPresences[id].DisplayName})
+	}
+	friend, err := vrc2.FindFriend(friends, ref)
+	if err != nil {
+		return "", i18n.T(ctx, "join.not_target")
+	}
+	return friend.ID, ""
+}
+
+// watchTargetName は通知対象のフレンドの表示名を返す。まだ観測していない場合はユーザIDを返す。
+func watchTargetName(userInfo firestore.UserInfo, targetID string) string {
+	if name := userInfo.LastPresences[targetID].DisplayName; name != "" {
+		return name
+	}
+	return targetID
+}
+
+// friendChoices は入力途中の表示名に前方一致するフレンドをオートコンプリートの候補として返す。
+// 候補の値にはユーザIDを設定するため、選択された場合はIDで登録される。
+func friendChoices(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, discordID string, input string) []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil || userInfo.Token == "" {
+		return choices
+	}
+
+	fs, err := friendLists.Get(ctx, vrc, discordID, userInfo.Token, userInfo.TwoFactorAuthToken)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to get friends for autocomplete", "discordID", discordID, "error", err)
+		return choices
+	}
+
+	for _, f := range searchFriends(fs, input, maxAutocompleteChoices) {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  f.DisplayName,
+			Value: f.ID,
+		})
+	}
+	return choices
+}
+
+// configureNotifyChannel は通知先をサーバーのテキストチャンネルに設定、またはDMに戻す。
+// 戻り値はユーザに返すメッセージ
+func configureNotifyChannel(ctx context.Context, discord *disc.Discord, db *firestore.DB, discordID string, data *disc.InteractionData, subCmd disc.InteractionOption) string {
+	if data.GuildID == "" {
+		return i18n.T(ctx, "channel.guild_only")
+	}
+	if data.MemberPermissions&discordgo.PermissionManageChannels == 0 {
+		return i18n.T(ctx, "channel.permission_required")
+	}
+
+	switch subCmd.Name {
+	case "set":
+		channelID := subCmd.Option("channel")
+		roleID := subCmd.Option("role")
+
+		// Botがチャンネルに投稿できるか確認するため、設定完了のメッセージを送信する
+		c := i18n.T(ctx, "channel.confirm")
+		if roleID != "" {
+			c += i18n.T(ctx, "channel.confirm_mention", "<@&"+roleID+">")
+		}
+		if _, err := discord.Session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content: c,
+			// 設定時はメンションしない
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		}); err != nil {
+			slog.WarnContext(ctx, "Failed to send message to notify channel", "discordID", discordID, "channelID", channelID, "error", err)
+			return i18n.T(ctx, "channel.send_failed")
+		}
+
+		if err := db.SaveNotifyChannel(ctx, discordID, channelID, roleID); err != nil {
+			return reportError(ctx, fail("channel.save_failed", err), "Failed to save notify channel", "discordID", discordID)
+		}
+		return i18n.T(ctx, "channel.set", "<#"+channelID+">")
+	case "clear":
+		if err := db.ClearNotifyChannel(ctx, discordID); err != nil {
+			return reportError(ctx, fail("channel.clear_failed", err), "Failed to clear notify channel", "discordID", discordID)
+		}
+		return i18n.T(ctx, "channel.cleared")
+	}
+	return i18n.T(ctx, "unsupported_command")
+}
+
+// configureNotifier はJOIN通知の送信先（Discord、Slack、Webhook、メール）を設定する。
+// 戻り値はユーザに返すメッセージ
+func configureNotifier(ctx context.Context, db *firestore.DB, settings rule.Settings, discordID string, subCmd disc.InteractionOption) string {
+	switch subCmd.Name {
+	case "set":
+		kind := subCmd.Option("type")
+		target := strings.TrimSpace(subCmd.Option("target"))
+		if kind != notify.KindDiscord && target == "" {
+			return i18n.T(ctx, "sink.target_required")
+		}
+		if err := notify.ValidateTarget(kind, target); err != nil {
+			return i18n.T(ctx, "sink.target_invalid")
+		}
+		// メールアドレスは確認コードを入力してから通知先に設定する
+		if kind == notify.KindEmail {
+			if !settings.SMTP.Enabled() {
+				return i18n.T(ctx, "sink.email_unavailable")
+			}
+			return startEmailVerification(ctx, db, settings, discordID, target)
+		}
+
+		// Webhookの場合は署名用の秘密鍵を発行する
+		var secret string
+		if kind == notify.KindWebhook {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				return reportError(ctx, fail("sink.save_failed", err), "Failed to generate webhook secret")
+			}
+			secret = hex.EncodeToString(b)
 		}
+
+		if err := db.SaveNotifier(ctx, discordID, kind, target, secret); err != nil {
+			return reportError(ctx, fail("sink.save_failed", err), "Failed to save notifier", "discordID", discordID)
+		}
+
+		if secret != "" {
+			return i18n.T(ctx, "sink.webhook_set", notify.SignatureHeader, secret)
+		}
+		return i18n.T(ctx, "sink.set", kind)
+	case "verify":
+		return verifyEmail(ctx, db, discordID, subCmd.Option("code"))
+	case "reset":
+		if err := db.SaveNotifier(ctx, discordID, notify.KindDiscord, "", ""); err != nil {
+			return reportError(ctx, fail("sink.save_failed", err), "Failed to reset notifier", "discordID", discordID)
+		}
+		return i18n.T(ctx, "sink.reset")
+	}
+	return i18n.T(ctx, "unsupported_command")
+}
+
+// focusedOption はオートコンプリートの対象になっている（入力中の）オプションを返す。
+func focusedOption(subCmd disc.InteractionOption) (disc.InteractionOption, bool) {
+	for _, opt := range subCmd.Options {
+		if opt.Focused {
+			return opt, true
+		}
+	}
+	return disc.InteractionOption{}, false
+}
+
+// watchTargetChoices は入力途中の表示名に前方一致する通知対象のフレンドを候補として返す。
+func watchTargetChoices(ctx context.Context, db *firestore.DB, discordID string, input string) []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return choices
+	}
+
+	var fs []vrc2.Friend
+	for _, id := range userInfo.WatchTargets() {
+		fs = append(fs, vrc2.Friend{ID: id, DisplayName: watchTargetName(userInfo, id)})
+	}
+	for _, f := range searchFriends(fs, input, maxAutocompleteChoices) {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  f.DisplayName,
+			Value: f.ID,
+		})
 	}
+	return choices
 }
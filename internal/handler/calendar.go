@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/ical"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/stats"
+	"github.com/bwmarrin/discordgo"
+)
+
+// CalendarHandler は通知対象のフレンドのオンラインのセッションをiCalendar形式で返す。
+// URLに含まれるトークン（/calendar/{token}.ics）でユーザを特定するため、認証は不要
+func CalendarHandler(db *firestore.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		token := strings.TrimSuffix(r.PathValue("token"), ".ics")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if !validCalendarToken(token) {
+			http.NotFound(w, r)
+			return
+		}
+
+		discordID, userInfo, err := db.GetUserInfoByCalendarToken(ctx, token)
+		if errors.Is(err, firestore.ErrUserNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		cal, err := buildCalendar(userContext(ctx, userInfo), db, discordID, userInfo)
+		if err != nil {
+			ErrorHandler(ctx, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", ical.ContentType)
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		if err := cal.Write(w); err != nil {
+			slog.ErrorContext(ctx, "Failed to write calendar", "discordID", discordID, "error", err)
+		}
+	}
+}
+
+// exportCalendar はカレンダーファイルと購読用のURLを返す。
+// regenerate が true の場合はトークンを発行し直し、以前の購読用のURLを無効にする。
+func exportCalendar(ctx context.Context, db *firestore.DB, settings rule.Settings, discordID string, regenerate bool) (*discordgo.MessageSend, string) {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return nil, reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+	if len(userInfo.WatchTargets()) == 0 {
+		return nil, i18n.T(ctx, "join.targets_required")
+	}
+
+	if userInfo.CalendarToken == "" || regenerate {
+		token, err := newCalendarToken()
+		if err != nil {
+			return nil, reportError(ctx, fail("calendar.failed", err), "Failed to generate calendar token")
+		}
+		if err := db.SaveCalendarToken(ctx, discordID, token); err != nil {
+			return nil, reportError(ctx, fail("calendar.failed", err), "Failed to save calendar token", "discordID", discordID)
+		}
+		userInfo.CalendarToken = token
+	}
+
+	cal, err := buildCalendar(ctx, db, discordID, userInfo)
+	if err != nil {
+		return nil, reportError(ctx, fail("calendar.failed", err), "Failed to build calendar", "discordID", discordID)
+	}
+
+	var buf bytes.Buffer
+	if err := cal.Write(&buf); err != nil {
+		return nil, reportError(ctx, fail("calendar.failed", err), "Failed to write calendar", "discordID", discordID)
+	}
+
+	c := i18n.T(ctx, "calendar.exported")
+	if settings.PublicBaseURL != "" {
+		c += "\n" + i18n.T(ctx, "calendar.subscribe", settings.PublicBaseURL+"/calendar/"+userInfo.CalendarToken+".ics")
+	}
+
+	return &discordgo.MessageSend{
+		Content: c,
+		Files: []*discordgo.File{
+			{
+				Name:        "vrc-online.ics",
+				ContentType: ical.ContentType,
+				Reader:      &buf,
+			},
+		},
+	}, ""
+}
+
+// buildCalendar は保持している期間のセッションをカレンダーの予定に変換する。
+func buildCalendar(ctx context.Context, db *firestore.DB, discordID string, userInfo firestore.UserInfo) (ical.Calendar, error) {
+	to := time.Now()
+	from := to.Add(-presenceRetention)
+	history, err := db.GetPresenceHistory(ctx, discordID, from)
+	if err != nil {
+		return ical.Calendar{}, err
+	}
+
+	var sessions []stats.Session
+	for _, targetID := range userInfo.WatchTargets() {
+		// 期間の前から続いているセッションも含める
+		h, err := withLastPresence(ctx, db, discordID, targetID, from, filterPresence(history, targetID))
+		if err != nil {
+			return ical.Calendar{}, err
+		}
+		sessions = append(sessions, stats.Sessions(h, from, to)...)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Start.Before(sessions[j].Start) })
+
+	cal := ical.Calendar{Name: i18n.T(ctx, "calendar.name")}
+	for _, s := range sessions {
+		e := ical.Event{
+			// 開始時刻は変わらないため、セッションが続いている間も同じ予定として更新される
+			UID:     fmt.Sprintf("%s-%s-%d@vrc-join-notify", discordID, s.TargetVRCUserID, s.Start.Unix()),
+			Start:   s.Start,
+			End:     s.End,
+			Summary: i18n.T(ctx, "calendar.event", s.DisplayName),
+			URL:     "https://vrchat.com/home/user/" + s.TargetVRCUserID,
+		}
+		if s.Ongoing {
+			e.Summary += i18n.T(ctx, "calendar.ongoing")
+		}
+
+		desc := []string{i18n.T(ctx, "calendar.status", s.Status)}
+		for _, worldID := range s.WorldIDs {
+			desc = append(desc, i18n.T(ctx, "world", "https://vrchat.com/home/world/"+worldID))
+		}
+		e.Description = strings.Join(desc, "\n")
+		if len(s.WorldIDs) > 0 {
+			e.Location = "https://vrchat.com/home/world/" + s.WorldIDs[len(s.WorldIDs)-1]
+		}
+
+		cal.Events = append(cal.Events, e)
+	}
+	return cal, nil
+}
+
+func newCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validCalendarToken はトークンが newCalendarToken で発行した形式かどうかを返す。
+func validCalendarToken(token string) bool {
+	if len(token) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
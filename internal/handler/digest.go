@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	// Cloud Functions の実行環境にはタイムゾーンのデータベースがないため埋め込む
+	_ "time/tzdata"
+
+	disc "github.com/aopontann/vrc-join-notify/internal/discord"
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/metrics"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/stats"
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+	"github.com/bwmarrin/discordgo"
+)
+
+// DigestHandler はダイジェストの送信時刻を過ぎたユーザに、直近24時間のフレンドの活動をまとめてDMで送信する。
+// スケジューラから定期的（15分ごとなど）に呼び出されることを想定している。
+// 同じ日のダイジェストは一度だけ送信されるため、呼び出しが重複・再試行されても問題ない。
+func DigestHandler(db *firestore.DB, discord *discordgo.Session, vrc *vrc2.VRC) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := SendDigests(r.Context(), db, discord, vrc); err != nil {
+			ErrorHandler(r.Context(), w, err, http.StatusInternalServerError)
+			return
+		}
+
+		writeOK(r.Context(), w)
+	}
+}
+
+// SendDigests はダイジェストの送信時刻を過ぎたユーザにダイジェストを送信する。
+// 個々のユーザへの送信の失敗はログに記録し、次回の実行で再送する。
+func SendDigests(ctx context.Context, db *firestore.DB, discord *discordgo.Session, vrc *vrc2.VRC) error {
+	userInfos, err := db.GetAllUserInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for discordID, userInfo := range userInfos {
+		if !userInfo.DigestEnabled || userInfo.Disabled || userInfo.ChannelID == "" {
+			continue
+		}
+		ctx := userContext(ctx, userInfo)
+
+		loc, err := time.LoadLocation(userInfo.DigestTimezone)
+		if err != nil {
+			slog.WarnContext(ctx, "Invalid digest timezone", "discordID", discordID, "timezone", userInfo.DigestTimezone)
+			continue
+		}
+		date, from, to, due := digestWindow(now, userInfo.DigestTime, loc)
+		if !due {
+			continue
+		}
+
+		// 他の実行と重複して送信しないよう、送信前に送信権を取得する
+		ok, err := db.ClaimDigest(ctx, discordID, date)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to claim digest", "discordID", discordID, "error", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		content, err := buildDigest(ctx, db, vrc, discordID, userInfo, from, to, loc)
+		if err == nil {
+			_, err = discord.ChannelMessageSend(userInfo.ChannelID, content)
+		}
+		metrics.Notifications.WithLabelValues("digest", metrics.NotificationResult(err)).Inc()
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to send digest", "discordID", discordID, "error", err)
+			// 次回の実行で再送できるようにする
+			if err := db.ReleaseDigest(ctx, discordID, date); err != nil {
+				slog.ErrorContext(ctx, "Failed to release digest", "discordID", discordID, "error", err)
+			}
+			continue
+		}
+		slog.InfoContext(ctx, "Digest sent", "discordID", discordID, "date", date)
+	}
+
+	return nil
+}
+
+// digestWindow は now の時点で送信すべきダイジェストの日付（loc での YYYY-MM-DD）と集計期間を返す。
+// その日の送信時刻 hhmm をまだ過ぎていない場合、due は false になる。
+func digestWindow(now time.Time, hhmm string, loc *time.Location) (date string, from, to time.Time, due bool) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return "", time.Time{}, time.Time{}, false
+	}
+
+	local := now.In(loc)
+	to = time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	if now.Before(to) {
+		return "", time.Time{}, time.Time{}, false
+	}
+	return to.Format("2006-01-02"), to.AddDate(0, 0, -1), to, true
+}
+
+// buildDigest は [from, to) の間にオンラインになった通知対象のフレンドの活動をまとめる。
+func buildDigest(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, discordID string, userInfo firestore.UserInfo, from, to time.Time, loc *time.Location) (string, error) {
+	history, err := db.GetPresenceHistory(ctx, discordID, from)
+	if err != nil {
+		return "", err
+	}
+
+	// フレンドごとに分け、期間の前から続いている状態を加える
+	byTarget := make(map[string][]firestore.Presence)
+	for _, p := range history {
+		byTarget[p.TargetVRCUserID] = append(byTarget[p.TargetVRCUserID], p)
+	}
+	for _, targetID := range userInfo.WatchTargets() {
+		if _, ok := byTarget[targetID]; !ok {
+			byTarget[targetID] = nil
+		}
+	}
+	for targetID, h := range byTarget {
+		h, err := withLastPresence(ctx, db, discordID, targetID, from, h)
+		if err != nil {
+			return "", err
+		}
+		byTarget[targetID] = h
+	}
+
+	type friendDigest struct {
+		name     string
+		total    time.Duration
+		sessions int
+		worldIDs []string
+	}
+	var digests []friendDigest
+	for _, h := range byTarget {
+		sessions := stats.Sessions(h, from, to)
+		if len(sessions) == 0 {
+			continue
+		}
+		d := friendDigest{name: sessions[0].DisplayName, sessions: len(sessions)}
+		for _, s := range sessions {
+			d.total += s.End.Sub(s.Start)
+			for _, worldID := range s.WorldIDs {
+				if !slices.Contains(d.worldIDs, worldID) {
+					d.worldIDs = append(d.worldIDs, worldID)
+				}
+			}
+		}
+		digests = append(digests, d)
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].total > digests[j].total })
+
+	var b strings.Builder
+	b.WriteString(i18n.T(ctx, "digest.header", from.In(loc).Format("1/2 15:04"), to.In(loc).Format("1/2 15:04")) + "\n")
+	if len(digests) == 0 {
+		b.WriteString(i18n.T(ctx, "digest.empty") + "\n")
+		return b.String(), nil
+	}
+
+	for _, d := range digests {
+		fmt.Fprintf(&b, "\n■ %s\n", d.name)
+		b.WriteString(i18n.T(ctx, "digest.online", formatDuration(ctx, d.total), d.sessions) + "\n")
+		if len(d.worldIDs) > 0 {
+			var names []string
+			for _, worldID := range d.worldIDs {
+				name := worldID
+				if world, err := vrc.GetWorld(ctx, worldID, userInfo.Token, userInfo.TwoFactorAuthToken); err == nil {
+					name = world.Name
+				}
+				names = append(names, name)
+			}
+			b.WriteString(i18n.T(ctx, "digest.worlds", strings.Join(names, i18n.T(ctx, "digest.separator"))) + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// configureDigest はダイジェストの受け取りを設定する。
+// 戻り値はユーザに返すメッセージ
+func configureDigest(ctx context.Context, db *firestore.DB, settings rule.Settings, discordID string, subCmd disc.InteractionOption) string {
+	switch subCmd.Name {
+	case "enable":
+		digestTime := subCmd.Option("time")
+		if _, err := time.Parse("15:04", digestTime); err != nil {
+			return i18n.T(ctx, "digest.invalid_time")
+		}
+		timezone := subCmd.Option("timezone")
+		if timezone == "" {
+			timezone = settings.DefaultTimezone
+		}
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return i18n.T(ctx, "digest.invalid_timezone")
+		}
+		digestOnly := subCmd.Option("instant") == "false"
+
+		if err := db.SaveDigestSettings(ctx, discordID, true, digestTime, timezone, digestOnly); err != nil {
+			return reportError(ctx, fail("digest.save_failed", err), "Failed to save digest settings", "discordID", discordID)
+		}
+
+		msg := i18n.T(ctx, "digest.enabled", digestTime, timezone)
+		if digestOnly {
+			msg += "\n" + i18n.T(ctx, "digest.digest_only")
+		}
+		return msg
+	case "disable":
+		if err := db.SaveDigestSettings(ctx, discordID, false, "", "", false); err != nil {
+			return reportError(ctx, fail("digest.save_failed", err), "Failed to save digest settings", "discordID", discordID)
+		}
+		return i18n.T(ctx, "digest.disabled")
+	}
+	return i18n.T(ctx, "unsupported_command")
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestWindow(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		name     string
+		now      time.Time
+		hhmm     string
+		wantDue  bool
+		wantDate string
+		wantFrom time.Time
+		wantTo   time.Time
+	}{
+		{
+			name:     "after the time",
+			now:      time.Date(2025, 1, 6, 9, 30, 0, 0, jst),
+			hhmm:     "09:00",
+			wantDue:  true,
+			wantDate: "2025-01-06",
+			wantFrom: time.Date(2025, 1, 5, 9, 0, 0, 0, jst),
+			wantTo:   time.Date(2025, 1, 6, 9, 0, 0, 0, jst),
+		},
+		{
+			name:    "before the time",
+			now:     time.Date(2025, 1, 6, 8, 59, 0, 0, jst),
+			hhmm:    "09:00",
+			wantDue: false,
+		},
+		{
+			// UTC では前日でも、ユーザのタイムゾーンの日付で判定する
+			name:     "local date differs from UTC",
+			now:      time.Date(2025, 1, 5, 23, 30, 0, 0, time.UTC),
+			hhmm:     "08:00",
+			wantDue:  true,
+			wantDate: "2025-01-06",
+			wantFrom: time.Date(2025, 1, 5, 8, 0, 0, 0, jst),
+			wantTo:   time.Date(2025, 1, 6, 8, 0, 0, 0, jst),
+		},
+		{
+			name:    "invalid time",
+			now:     time.Date(2025, 1, 6, 9, 30, 0, 0, jst),
+			hhmm:    "9時",
+			wantDue: false,
+		},
+	}
+	for _, tt := range tests {
+		date, from, to, due := digestWindow(tt.now, tt.hhmm, jst)
+		if due != tt.wantDue {
+			t.Errorf("%s: due = %v, want %v", tt.name, due, tt.wantDue)
+			continue
+		}
+		if !due {
+			continue
+		}
+		if date != tt.wantDate || !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+			t.Errorf("%s: digestWindow() = %s, %v, %v, want %s, %v, %v", tt.name, date, from, to, tt.wantDate, tt.wantFrom, tt.wantTo)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/notify"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+)
+
+const (
+	// emailVerificationTTL は確認コードの有効期間
+	emailVerificationTTL = 30 * time.Minute
+	// emailVerificationInterval は確認メールを再送できるまでの間隔
+	// 確認メールを使って第三者のメールアドレスに大量のメールを送れないようにする
+	emailVerificationInterval = 10 * time.Minute
+	// maxEmailVerificationAttempts は確認コードの入力を失敗できる回数
+	maxEmailVerificationAttempts = 5
+)
+
+// startEmailVerification はメールアドレスに確認コードを送信し、確認中のメールアドレスとして保存する。
+// 通知先は /notify sink verify で確認コードを入力するまで変わらない。戻り値はユーザに返すメッセージ
+func startEmailVerification(ctx context.Context, db *firestore.DB, settings rule.Settings, discordID string, address string) string {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+	if userInfo.Notifier == notify.KindEmail && userInfo.NotifierTarget == address {
+		return i18n.T(ctx, "sink.set", notify.KindEmail)
+	}
+	if v := userInfo.EmailVerification; v != nil && time.Since(v.SentAt) < emailVerificationInterval {
+		wait := emailVerificationInterval - time.Since(v.SentAt)
+		return i18n.T(ctx, "sink.email_wait", int(wait.Minutes())+1)
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return reportError(ctx, fail("sink.save_failed", err), "Failed to generate verification code")
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = notify.NewEmail(settings.SMTP, address).Notify(ctx, notify.Event{
+		Title:   i18n.T(ctx, "sink.email_verification_subject"),
+		Message: i18n.T(ctx, "sink.email_verification_body", code, int(emailVerificationTTL.Minutes())),
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return reportError(ctx, fail("sink.email_send_failed", err), "Failed to send verification email", "discordID", discordID)
+	}
+
+	now := time.Now()
+	err = db.SaveEmailVerification(ctx, discordID, &firestore.EmailVerification{
+		Address:   address,
+		CodeHash:  hashVerificationCode(code),
+		SentAt:    now,
+		ExpiresAt: now.Add(emailVerificationTTL),
+	})
+	if err != nil {
+		return reportError(ctx, fail("sink.save_failed", err), "Failed to save email verification", "discordID", discordID)
+	}
+	return i18n.T(ctx, "sink.email_verification_sent", address)
+}
+
+// verifyEmail は確認コードが一致すれば、確認中のメールアドレスを通知先に設定する。
+// 戻り値はユーザに返すメッセージ
+func verifyEmail(ctx context.Context, db *firestore.DB, discordID string, code string) string {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+
+	v := userInfo.EmailVerification
+	if v == nil {
+		return i18n.T(ctx, "sink.email_not_pending")
+	}
+	if time.Now().After(v.ExpiresAt) || v.Attempts >= maxEmailVerificationAttempts {
+		if err := db.SaveEmailVerification(ctx, discordID, nil); err != nil {
+			return reportError(ctx, fail("sink.save_failed", err), "Failed to delete email verification", "discordID", discordID)
+		}
+		return i18n.T(ctx, "sink.email_expired")
+	}
+
+	hash := hashVerificationCode(strings.TrimSpace(code))
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(v.CodeHash)) != 1 {
+		v.Attempts++
+		if err := db.SaveEmailVerification(ctx, discordID, v); err != nil {
+			return reportError(ctx, fail("sink.save_failed", err), "Failed to save email verification", "discordID", discordID)
+		}
+		return i18n.T(ctx, "sink.email_code_mismatch")
+	}
+
+	if err := db.ConfirmEmailNotifier(ctx, discordID, v.Address); err != nil {
+		return reportError(ctx, fail("sink.save_failed", err), "Failed to save notifier", "discordID", discordID)
+	}
+	return i18n.T(ctx, "sink.set", notify.KindEmail)
+}
+
+// hashVerificationCode は保存する確認コードのハッシュを返す。
+func hashVerificationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// userError は内部のエラーに、ユーザに表示するメッセージ（i18n のキー）を付けたエラー
+type userError struct {
+	key string
+	err error
+}
+
+func (e *userError) Error() string {
+	return e.key + ": " + e.err.Error()
+}
+
+func (e *userError) Unwrap() error {
+	return e.err
+}
+
+// fail は err が発生したとき、ユーザに key のメッセージを表示するエラーを返す。
+func fail(key string, err error) error {
+	return &userError{key: key, err: err}
+}
+
+// reportError はエラーの詳細をエラーIDとともにログに記録し、ユーザに表示するメッセージを返す。
+// ユーザには内部のエラーの内容を伝えず、問い合わせの際にログと突き合わせるためのエラーIDだけを伝える。
+// fail で作成したエラーでなければ汎用のメッセージを返す。
+func reportError(ctx context.Context, err error, msg string, args ...any) string {
+	key := "error"
+	var ue *userError
+	if errors.As(err, &ue) {
+		key = ue.key
+	}
+
+	id := errorID(ctx)
+	slog.ErrorContext(ctx, msg, append(args, "error_id", id, "error", err)...)
+	return i18n.T(ctx, key) + "\n" + i18n.T(ctx, "error_id", id)
+}
+
+// errorID はエラーを識別するIDを返す。
+// トレースが有効な場合はトレースIDを使い、Cloud Traceでも同じリクエストを辿れるようにする。
+func errorID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+)
+
+// friendCacheTTL はフレンド一覧をキャッシュする期間
+// オートコンプリートは入力のたびに呼ばれるため、VRChat APIへのリクエストを抑える
+const friendCacheTTL = 5 * time.Minute
+
+// maxAutocompleteChoices はDiscordが受け付けるオートコンプリート候補の最大数
+const maxAutocompleteChoices = 25
+
+type friendCacheEntry struct {
+	friends   []vrc2.Friend
+	fetchedAt time.Time
+}
+
+// friendCache はDiscordユーザごとのフレンド一覧のキャッシュ
+// 期限切れのエントリは、新しいエントリを追加するときに削除する
+type friendCache struct {
+	mu       sync.Mutex
+	entries  map[string]friendCacheEntry
+	prunedAt time.Time
+}
+
+var friendLists = &friendCache{entries: make(map[string]friendCacheEntry)}
+
+// Get はキャッシュが有効であればキャッシュを、無効であればVRChat APIから取得したフレンド一覧を返す。
+func (c *friendCache) Get(ctx context.Context, vrc *vrc2.VRC, discordID, auth, twoFactorAuth string) ([]vrc2.Friend, error) {
+	c.mu.Lock()
+	e, ok := c.entries[discordID]
+	c.mu.Unlock()
+	if ok && time.Since(e.fetchedAt) < friendCacheTTL {
+		return e.friends, nil
+	}
+
+	fs, err := vrc.GetFriends(ctx, auth, twoFactorAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.pruneLocked()
+	c.entries[discordID] = friendCacheEntry{friends: fs, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return fs, nil
+}
+
+// pruneLocked は期限切れのエントリを削除する。c.mu をロックした状態で呼び出す。
+// 全てのエントリを調べるため、キャッシュの期間に1回だけ行う
+func (c *friendCache) pruneLocked() {
+	if time.Since(c.prunedAt) < friendCacheTTL {
+		return
+	}
+	for id, e := range c.entries {
+		if time.Since(e.fetchedAt) >= friendCacheTTL {
+			delete(c.entries, id)
+		}
+	}
+	c.prunedAt = time.Now()
+}
+
+// Invalidate は指定したユーザのキャッシュを削除する。
+func (c *friendCache) Invalidate(discordID string) {
+	c.mu.Lock()
+	delete(c.entries, discordID)
+	c.mu.Unlock()
+}
+
+// searchFriends は表示名が前方一致するフレンドを最大 limit 件返す。
+func searchFriends(fs []vrc2.Friend, prefix string, limit int) []vrc2.Friend {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+
+	var found []vrc2.Friend
+	for _, f := range fs {
+		if len(found) >= limit {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(f.DisplayName), prefix) {
+			found = append(found, f)
+		}
+	}
+	return found
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+)
+
+func TestSearchFriends(t *testing.T) {
+	fs := []vrc2.Friend{
+		{ID: "usr_1", DisplayName: "Alice"},
+		{ID: "usr_2", DisplayName: "alex"},
+		{ID: "usr_3", DisplayName: "Bob"},
+		{ID: "usr_4", DisplayName: "アリス"},
+	}
+	tests := []struct {
+		name   string
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"case insensitive", "al", 25, []string{"usr_1", "usr_2"}},
+		{"trims spaces", "  BO ", 25, []string{"usr_3"}},
+		{"limit", "", 2, []string{"usr_1", "usr_2"}},
+		{"japanese", "アリ", 25, []string{"usr_4"}},
+		{"no match", "carol", 25, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, f := range searchFriends(fs, tt.prefix, tt.limit) {
+			got = append(got, f.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: searchFriends() = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: searchFriends() = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestFriendCachePrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		prunedAt time.Time
+		want     []string
+	}{
+		{"prunes expired entries", time.Time{}, []string{"fresh"}},
+		{"at most once per TTL", now.Add(-time.Minute), []string{"expired", "fresh"}},
+	}
+	for _, tt := range tests {
+		c := &friendCache{
+			entries: map[string]friendCacheEntry{
+				"expired": {fetchedAt: now.Add(-friendCacheTTL - time.Second)},
+				"fresh":   {fetchedAt: now},
+			},
+			prunedAt: tt.prunedAt,
+		}
+		c.pruneLocked()
+		if len(c.entries) != len(tt.want) {
+			t.Errorf("%s: entries = %v, want %v", tt.name, c.entries, tt.want)
+		}
+		for _, id := range tt.want {
+			if _, ok := c.entries[id]; !ok {
+				t.Errorf("%s: entry %q was removed", tt.name, id)
+			}
+		}
+	}
+
+	c := &friendCache{entries: map[string]friendCacheEntry{"123": {fetchedAt: now}}}
+	c.Invalidate("123")
+	if len(c.entries) != 0 {
+		t.Errorf("Invalidate() left %v", c.entries)
+	}
+}
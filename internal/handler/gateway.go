@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+
+	disc "github.com/aopontann/vrc-join-notify/internal/discord"
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/metrics"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/tracing"
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+	"github.com/bwmarrin/discordgo"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GatewayInteractionHandler はDiscordのGateway（WebSocket）で受け取ったインタラクションを処理する。
+// HTTPSのインタラクションエンドポイントを公開できない環境（NAT内の自宅サーバーなど）で使う。
+// コマンドの処理内容は DiscordBotHandler と同じ。
+func GatewayInteractionHandler(db *firestore.DB, discord *disc.Discord, vrc *vrc2.VRC, settings rule.Settings, owners []string) func(*discordgo.Session, *discordgo.InteractionCreate) {
+	return func(s *discordgo.Session, ic *discordgo.InteractionCreate) {
+		eventType, userID, channelID, interactionData, err := disc.ParseInteraction(ic.Interaction)
+		if err != nil {
+			slog.Error("Failed to parse interaction", "error", err)
+			return
+		}
+
+		ctx, span := tracing.Start(context.Background(), "discord.interaction",
+			attribute.Int("discord.event_type", eventType),
+			attribute.String("discord.command", commandName(interactionData)),
+			attribute.Bool("discord.gateway", true),
+		)
+		defer span.End()
+		ctx = i18n.NewContext(ctx, interactionData.Locale)
+
+		switch eventType {
+		case disc.Autocomplete:
+			err := s.InteractionRespond(ic.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+				Data: &discordgo.InteractionResponseData{
+					Choices: autocompleteChoices(ctx, db, vrc, userID, interactionData),
+				},
+			})
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to respond to autocomplete", "error", err)
+			}
+		case disc.MessageComponent:
+			// 3秒以内に応答しないとインタラクションが失敗するため、先に応答を保留する
+			err := s.InteractionRespond(ic.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseDeferredMessageUpdate,
+			})
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to defer component response", "error", err)
+				return
+			}
+
+			// ボタンのメッセージを処理結果で置き換え、ボタンを取り除く
+			content := runComponent(ctx, db, vrc, settings, userID, interactionData.CustomID)
+			components := []discordgo.MessageComponent{}
+			if _, err := s.InteractionResponseEdit(ic.Interaction, &discordgo.WebhookEdit{Content: &content, Components: &components}); err != nil {
+				slog.ErrorContext(ctx, "Failed to edit component response", "error", err)
+			}
+		case disc.SlashCommand:
+			// 3秒以内に応答しないとインタラクションが失敗するため、先に応答を保留する
+			err := s.InteractionRespond(ic.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+			})
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to defer interaction response", "error", err)
+				return
+			}
+
+			outcome, content := "ok", i18n.T(ctx, "ok")
+			if err := ensureGatewayUser(ctx, db, discord, userID); err != nil {
+				outcome, content = "error", reportError(ctx, err, "Failed to register user", "discordID", userID)
+			} else if err := runCommand(ctx, db, discord, vrc, settings, owners, userID, channelID, interactionData); err != nil {
+				outcome, content = "error", reportError(ctx, err, "Failed to run command", "discordID", userID)
+			}
+			metrics.SlashCommands.WithLabelValues(commandName(interactionData), outcome).Inc()
+
+			if _, err := s.InteractionResponseEdit(ic.Interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+				slog.ErrorContext(ctx, "Failed to edit interaction response", "error", err)
+			}
+		}
+	}
+}
+
+// ensureGatewayUser はユーザ情報が未登録の場合にDMチャンネルを作成して登録する。
+// Gatewayではアプリのインストール時のWebhookイベントを受け取れないため、初回のコマンド実行時に登録する。
+func ensureGatewayUser(ctx context.Context, db *firestore.DB, discord *disc.Discord, userID string) error {
+	userInfo, err := db.GetUserInfo(ctx, userID)
+	if err == nil && userInfo.ChannelID != "" {
+		return nil
+	}
+
+	ch, err := discord.UserChannelCreate(userID)
+	if err != nil {
+		return err
+	}
+	return db.SaveUserInfo(ctx, userID, ch.ID)
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/notify"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+	"github.com/bwmarrin/discordgo"
+)
+
+// notifyGathering は設定した人数以上の通知対象のフレンドが同じインスタンスにいれば通知する。
+// 同じ集まりが続いている間は繰り返し通知せず、集まりが解散したら再び通知できるようにする。
+// ダイジェストのみを受け取る設定の場合は、オンライン時の通知と同様に通知しない。
+func notifyGathering(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, discord *discordgo.Session, settings rule.Settings, discordID string, userInfo firestore.UserInfo, presences []firestore.Presence) {
+	if userInfo.GatheringMin < 2 || userInfo.DigestOnly {
+		return
+	}
+
+	gs := rule.Gatherings(presences, userInfo.GatheringMin)
+	if len(gs) == 0 {
+		if userInfo.GatheringLocation != "" {
+			if err := db.SaveGatheringLocation(ctx, discordID, ""); err != nil {
+				slog.ErrorContext(ctx, "Failed to reset gathering location", "discordID", discordID, "error", err)
+			}
+		}
+		return
+	}
+
+	// 既に通知した集まりが続いている場合は通知しない
+	for _, g := range gs {
+		if g.Location == userInfo.GatheringLocation {
+			return
+		}
+	}
+
+	g := gs[0]
+	worldName := g.WorldID
+	if world, err := vrc.GetWorld(ctx, g.WorldID, userInfo.Token, userInfo.TwoFactorAuthToken); err == nil {
+		worldName = world.Name
+	}
+
+	var names []string
+	for _, m := range g.Members {
+		names = append(names, m.DisplayName)
+	}
+
+	// 通知の意図の記録と同時に集まりの場所を保存し、送信に失敗した場合は意図から再送する
+	err := deliver(ctx, db, discord, settings, userInfo, firestore.NotificationIntent{
+		Key:       gatheringIntentKey(discordID, g.Location, userInfo.GatheringEpisodes),
+		DiscordID: discordID,
+		Kind:      firestore.IntentGathering,
+		Location:  g.Location,
+		Episode:   userInfo.GatheringEpisodes,
+	}, notify.Event{
+		Type:      notify.EventGathering,
+		DiscordID: discordID,
+		Location:  g.Location,
+		Members:   names,
+		Title:     i18n.T(ctx, "notify.title"),
+		Message: i18n.T(ctx, "gathering.members", strings.Join(names, i18n.T(ctx, "gathering.separator"))) + "\n" +
+			i18n.T(ctx, "world", worldName) + "\n" + launchURL(g.Location),
+		Time: time.Now(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to notify gathering", "discordID", discordID, "error", err)
+	}
+}
+
+// launchURL はインスタンスに参加するためのURLを返す。
+func launchURL(location string) string {
+	worldID, instanceID, _ := strings.Cut(location, ":")
+	q := url.Values{}
+	q.Set("worldId", worldID)
+	q.Set("instanceId", instanceID)
+	return "https://vrchat.com/home/launch?" + q.Encode()
+}
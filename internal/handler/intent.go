@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/metrics"
+	"github.com/aopontann/vrc-join-notify/internal/notify"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/shard"
+	"github.com/bwmarrin/discordgo"
+)
+
+// intentClaimTTL は通知を送信する実行が通知の意図を占有する時間
+// この時間を過ぎても送信済みにならなかった通知は、送信中に停止したとみなして再送する
+const intentClaimTTL = 2 * time.Minute
+
+// intentRetention は送信済み、または諦めた通知の意図を残す期間
+const intentRetention = 24 * time.Hour
+
+// 送信に失敗した通知を再送するまでの間隔（失敗するたびに倍にする）
+const (
+	retryBackoffBase = time.Minute
+	retryBackoffMax  = time.Hour
+)
+
+// retryBackoff は attempts 回目の送信に失敗した後、次に再送するまでの間隔を返す。
+func retryBackoff(attempts int) time.Duration {
+	d := retryBackoffBase
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= retryBackoffMax {
+			return retryBackoffMax
+		}
+	}
+	return d
+}
+
+// intentKey はユーザ・フレンド・「だれでもおいで」の回数から通知の冪等キーを作る。
+func intentKey(discordID string, targetID string, episode int) string {
+	return fmt.Sprintf("%s_%s_%d", discordID, targetID, episode)
+}
+
+// reauthIntentKey は再ログインの依頼の冪等キーを作る。無効になったトークンごとに1回だけ送る。
+// トークンはそのまま記録しない
+func reauthIntentKey(discordID string, token string) string {
+	return fmt.Sprintf("%s_reauth_%s", discordID, shortHash(token))
+}
+
+// gatheringIntentKey はインスタンスと集まりを通知した回数（UserInfo.GatheringEpisodes）から集まりの通知の冪等キーを作る。
+// 回数は通知の意図を記録するときに増えるため、同じインスタンスに再び集まった場合は別の通知になる
+func gatheringIntentKey(discordID string, location string, episode int) string {
+	return fmt.Sprintf("%s_gathering_%s_%d", discordID, shortHash(location), episode)
+}
+
+// shortHash はドキュメントIDに使えるよう、文字列のハッシュの先頭を返す。
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// deliverJoinMe はオンライン時の通知の意図を記録してから送信し、送信済みにする。
+func deliverJoinMe(ctx context.Context, db *firestore.DB, discord *discordgo.Session, settings rule.Settings, discordID string, userInfo firestore.UserInfo, targetID string, e notify.Event) error {
+	episode := userInfo.JoinEpisodes[targetID]
+	return deliver(ctx, db, discord, settings, userInfo, firestore.NotificationIntent{
+		Key:             intentKey(discordID, targetID, episode),
+		DiscordID:       discordID,
+		Kind:            firestore.IntentJoinMe,
+		TargetVRCUserID: targetID,
+		Episode:         episode,
+	}, e)
+}
+
+// deliver は通知の意図を記録してから送信し、送信済みにする。
+// 同じ冪等キーの意図が既に記録されている場合（前回の実行と重複した場合など）は送信しない。
+// 送信に失敗した場合は意図を残し、次回以降の実行で再送する。
+func deliver(ctx context.Context, db *firestore.DB, discord *discordgo.Session, settings rule.Settings, userInfo firestore.UserInfo, intent firestore.NotificationIntent, e notify.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	intent.Event = string(b)
+
+	created, err := db.CreateNotificationIntent(ctx, &intent, intentClaimTTL)
+	if err != nil {
+		return err
+	}
+	if !created {
+		slog.InfoContext(ctx, "Notification already recorded", "discordID", intent.DiscordID, "key", intent.Key)
+		return nil
+	}
+	return sendIntent(ctx, db, discord, settings, userInfo, intent, e)
+}
+
+// sendIntent は記録した通知の意図を送信し、結果を記録する。
+// 送信に失敗した場合は間隔を空けて再送するが、通知先に恒久的に送信できない場合や
+// 最初の送信から settings.DeliveryRetryWindow を過ぎる場合は諦める。
+func sendIntent(ctx context.Context, db *firestore.DB, discord *discordgo.Session, settings rule.Settings, userInfo firestore.UserInfo, intent firestore.NotificationIntent, e notify.Event) error {
+	discordID := intent.DiscordID
+	err := eventNotifier(discord, settings, userInfo, e).Notify(ctx, e)
+	metrics.Notifications.WithLabelValues(e.Type, metrics.NotificationResult(err)).Inc()
+	audit(ctx, db, discordID, auditDelivery, auditOutcome(err), "event", e.Type, "target", e.TargetUserID, "notifier", notifierKind(userInfo))
+	if err == nil {
+		return db.MarkIntentDelivered(ctx, intent.Key)
+	}
+
+	switch backoff := retryBackoff(intent.Attempts); {
+	case errors.Is(err, notify.ErrUnreachable):
+		// Botをブロックされた場合などは再送しても届かないため、再びコマンドを実行するまで通知を止める
+		slog.WarnContext(ctx, "Notification channel is unreachable", "discordID", discordID, "key", intent.Key, "error", err)
+		giveUpIntent(ctx, db, intent, intentError(userInfo, e, err))
+		if serr := db.SaveUnreachable(ctx, discordID, true); serr != nil {
+			slog.ErrorContext(ctx, "Failed to save unreachable", "discordID", discordID, "error", serr)
+		}
+		audit(ctx, db, discordID, auditUnreachable, auditOK, "notifier", notifierKind(userInfo))
+	case time.Since(intent.CreatedAt)+backoff > settings.DeliveryRetryWindow:
+		slog.WarnContext(ctx, "Giving up notification", "discordID", discordID, "key", intent.Key, "attempts", intent.Attempts, "error", err)
+		giveUpIntent(ctx, db, intent, intentError(userInfo, e, err))
+	default:
+		if rerr := db.RetryIntentAt(ctx, intent.Key, intentError(userInfo, e, err), time.Now().Add(backoff)); rerr != nil {
+			slog.ErrorContext(ctx, "Failed to schedule notification retry", "discordID", discordID, "key", intent.Key, "error", rerr)
+		}
+	}
+	return err
+}
+
+// intentExpired は再送する期間を過ぎたために諦めた通知の意図に記録するエラー
+const intentExpired = "expired"
+
+// intentError は通知の意図に記録するエラーを返す。
+// エラーの文字列は Slack や Webhook のURL（秘密の情報）を含むため、通知先の種類とエラーの分類だけを記録する
+func intentError(userInfo firestore.UserInfo, e notify.Event, err error) string {
+	kind := notifierKind(userInfo)
+	if e.Type == notify.EventReauthRequired {
+		kind = notify.KindDiscord
+	}
+	return kind + ": " + notify.ErrorClass(err)
+}
+
+// giveUpIntent は通知の再送を諦め、監査ログに記録する。lastError は intentError で作成したエラー
+func giveUpIntent(ctx context.Context, db *firestore.DB, intent firestore.NotificationIntent, lastError string) {
+	if gerr := db.GiveUpIntent(ctx, intent.Key, lastError); gerr != nil {
+		slog.ErrorContext(ctx, "Failed to give up notification intent", "discordID", intent.DiscordID, "key", intent.Key, "error", gerr)
+	}
+	metrics.NotificationsAbandoned.Inc()
+	audit(ctx, db, intent.DiscordID, auditAbandoned, auditFailed, "target", intent.TargetVRCUserID, "attempts", fmt.Sprint(intent.Attempts))
+}
+
+// redeliverIntents は送信中に停止した、または送信に失敗した通知を再送する。
+// 再送の前に意図を占有するため、複数の実行が並行していても同じ通知を再送するのは1回だけになる。
+// 最初の送信から settings.DeliveryRetryWindow を過ぎた通知は、再送せずに諦める。
+func redeliverIntents(ctx context.Context, db *firestore.DB, discord *discordgo.Session, settings rule.Settings, userInfos map[string]firestore.UserInfo, sh shard.Shard) {
+	intents, err := db.GetStuckIntents(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get stuck notification intents", "error", err)
+		return
+	}
+
+	for _, intent := range intents {
+		if !sh.Owns(intent.DiscordID) {
+			continue
+		}
+		// 障害などで長く送信できなかった古い通知は送らない
+		// 利用を停止されたユーザや送信できないユーザの通知も、未送信のまま残り続けないよう諦める
+		if time.Since(intent.CreatedAt) > settings.DeliveryRetryWindow {
+			slog.WarnContext(ctx, "Giving up expired notification", "discordID", intent.DiscordID, "key", intent.Key, "attempts", intent.Attempts)
+			giveUpIntent(ctx, db, intent, intentExpired)
+			continue
+		}
+		userInfo, ok := userInfos[intent.DiscordID]
+		if !ok || userInfo.Disabled || userInfo.Unreachable {
+			continue
+		}
+		ctx := userContext(ctx, userInfo)
+
+		var e notify.Event
+		if err := json.Unmarshal([]byte(intent.Event), &e); err != nil {
+			slog.ErrorContext(ctx, "Invalid notification intent", "discordID", intent.DiscordID, "key", intent.Key, "error", err)
+			continue
+		}
+
+		claimed, err := db.ClaimIntent(ctx, intent.Key, intentClaimTTL)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to claim notification intent", "discordID", intent.DiscordID, "key", intent.Key, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		intent.Attempts++
+
+		slog.InfoContext(ctx, "Redelivering notification", "discordID", intent.DiscordID, "key", intent.Key, "attempts", intent.Attempts)
+		if err := sendIntent(ctx, db, discord, settings, userInfo, intent, e); err != nil {
+			slog.ErrorContext(ctx, "Failed to redeliver notification", "discordID", intent.DiscordID, "key", intent.Key, "error", err)
+		}
+	}
+
+	if err := db.DeleteFinishedIntentsBefore(ctx, time.Now().Add(-intentRetention)); err != nil {
+		slog.WarnContext(ctx, "Failed to delete finished notification intents", "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/notify"
+)
+
+func TestIntentKey(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"join me", intentKey("123", "usr_a", 0), "123_usr_a_0"},
+		{"next episode", intentKey("123", "usr_a", 1), "123_usr_a_1"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: key = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+
+	// 集まりの通知は、同じインスタンスと回数であれば同じキーになる
+	location := "wrld_a:12345~friends(usr_b)~region(jp)"
+	if gatheringIntentKey("123", location, 2) != gatheringIntentKey("123", location, 2) {
+		t.Error("gatheringIntentKey() is not stable")
+	}
+	for _, other := range []string{
+		gatheringIntentKey("123", location, 3),
+		gatheringIntentKey("123", "wrld_b:1", 2),
+		gatheringIntentKey("456", location, 2),
+	} {
+		if other == gatheringIntentKey("123", location, 2) {
+			t.Errorf("gatheringIntentKey() collides: %q", other)
+		}
+	}
+
+	// 再ログインの依頼は無効になったトークンごとに1回だけ送り、キーにトークンを含めない
+	key := reauthIntentKey("123", "authcookie_secret")
+	if key != reauthIntentKey("123", "authcookie_secret") || key == reauthIntentKey("123", "authcookie_other") {
+		t.Errorf("reauthIntentKey() = %q is not unique per token", key)
+	}
+	if strings.Contains(key, "secret") {
+		t.Errorf("reauthIntentKey() = %q contains the token", key)
+	}
+	for _, k := range []string{key, gatheringIntentKey("123", location, 2)} {
+		if strings.Contains(k, "/") {
+			t.Errorf("key %q is not a valid document ID", k)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestIntentError(t *testing.T) {
+	secretURL := "https://hooks.slack.com/services/T000/B000/secret"
+	tests := []struct {
+		name     string
+		userInfo firestore.UserInfo
+		e        notify.Event
+		err      error
+		want     string
+	}{
+		{"slack status", firestore.UserInfo{Notifier: notify.KindSlack, NotifierTarget: secretURL}, notify.Event{Type: notify.EventJoinMe}, &notify.StatusError{Kind: notify.KindSlack, StatusCode: 404}, "slack: http_status_404"},
+		{"raw error", firestore.UserInfo{Notifier: notify.KindWebhook}, notify.Event{Type: notify.EventGathering}, errors.New(secretURL), "webhook: error"},
+		{"reauth goes to discord", firestore.UserInfo{Notifier: notify.KindEmail}, notify.Event{Type: notify.EventReauthRequired}, notify.ErrUnreachable, "discord: unreachable"},
+	}
+	for _, tt := range tests {
+		got := intentError(tt.userInfo, tt.e, tt.err)
+		if got != tt.want {
+			t.Errorf("%s: intentError() = %q, want %q", tt.name, got, tt.want)
+		}
+		if strings.Contains(got, "secret") {
+			t.Errorf("%s: intentError() = %q contains the webhook url", tt.name, got)
+		}
+	}
+}
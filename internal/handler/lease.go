@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+)
+
+// leaseReleaseTimeout はロックの解放を待つ時間（呼び出し元の ctx がキャンセルされていても解放する）
+const leaseReleaseTimeout = 10 * time.Second
+
+// errLeaseLost はロックの延長に失敗し、他の実行にロックが移ったことを表す
+var errLeaseLost = errors.New("lease lost to another run")
+
+// withLease は名前付きのロックを取得してから f を実行し、終了後にロックを解放する。
+// group については firestore.DB.AcquireLease を参照。
+// 他の実行がロックを持っている場合は f を実行せずに false を返す。
+// 実行中は有効期限の 1/3 ごとにロックを延長し、延長できなかった場合は f に渡した ctx をキャンセルする。
+func withLease(ctx context.Context, db *firestore.DB, name string, group string, ttl time.Duration, f func(context.Context) error) (bool, error) {
+	owner := newLeaseOwner()
+	ok, err := db.AcquireLease(ctx, name, group, owner, ttl)
+	if err != nil {
+		return false, fmt.Errorf("acquire lease %s: %w", name, err)
+	}
+	if !ok {
+		return false, nil
+	}
+	slog.DebugContext(ctx, "Lease acquired", "lease", name, "owner", owner)
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), leaseReleaseTimeout)
+		defer cancel()
+		if err := db.ReleaseLease(ctx, name, owner); err != nil {
+			slog.WarnContext(ctx, "Failed to release lease", "lease", name, "owner", owner, "error", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go renewLease(ctx, cancel, db, name, group, owner, ttl)
+
+	if err := f(ctx); err != nil {
+		// ロックを失って中断した場合は、その原因を返す
+		if cause := context.Cause(ctx); errors.Is(cause, errLeaseLost) {
+			return true, errors.Join(err, cause)
+		}
+		return true, err
+	}
+	return true, nil
+}
+
+// renewLease は ctx がキャンセルされるまでロックを定期的に延長する。
+// 他の実行にロックが移っていた場合は cancel を呼び出し、処理を中断させる。
+func renewLease(ctx context.Context, cancel context.CancelCauseFunc, db *firestore.DB, name string, group string, owner string, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := db.AcquireLease(ctx, name, group, owner, ttl)
+			if err != nil {
+				// 一時的なエラーであれば次の延長で取り戻せる（期限が切れるまでは他の実行に奪われない）
+				slog.WarnContext(ctx, "Failed to renew lease", "lease", name, "owner", owner, "error", err)
+				continue
+			}
+			if !ok {
+				slog.ErrorContext(ctx, "Lease lost to another run", "lease", name, "owner", owner)
+				cancel(errLeaseLost)
+				return
+			}
+		}
+	}
+}
+
+// newLeaseOwner は実行ごとに異なるロックの所有者のIDを返す。
+// 調査しやすいよう、ホスト名とプロセスIDを含める。
+func newLeaseOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
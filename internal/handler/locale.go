@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+)
+
+// rememberLocale はインタラクションの言語が保存されている言語と異なれば保存する。
+// 保存に失敗してもコマンドの実行は続ける。戻り値は保存されているユーザ情報（取得できなければゼロ値）
+func rememberLocale(ctx context.Context, db *firestore.DB, discordID string, locale string) firestore.UserInfo {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return firestore.UserInfo{}
+	}
+	if locale == "" {
+		return userInfo
+	}
+	locale = i18n.Normalize(locale)
+	if userInfo.Locale == locale {
+		return userInfo
+	}
+	if err := db.SaveLocale(ctx, discordID, locale); err != nil {
+		slog.WarnContext(ctx, "Failed to save locale", "discordID", discordID, "error", err)
+	}
+	userInfo.Locale = locale
+	return userInfo
+}
+
+// userContext は保存されているユーザの言語を設定したコンテキストを返す。
+// ポーリングやダイジェストなど、インタラクションを伴わない通知で使う。
+func userContext(ctx context.Context, userInfo firestore.UserInfo) context.Context {
+	return i18n.NewContext(ctx, userInfo.Locale)
+}
@@ -1,104 +1,306 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/metrics"
+	"github.com/aopontann/vrc-join-notify/internal/notify"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/shard"
+	"github.com/aopontann/vrc-join-notify/internal/tracing"
 	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
 	"github.com/bwmarrin/discordgo"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func NotifyHandler(db *firestore.DB) http.HandlerFunc {
+// PollOptions は通知処理の排他制御とユーザの分割の設定
+type PollOptions struct {
+	// 通知処理のロックの有効期限（0の場合はロックを取得しない）
+	// 前回の実行が終わる前に次の実行が始まると同じ通知を重複して送信するため、ロックで防ぐ
+	LockTTL time.Duration
+	// この実行で処理するユーザのシャード（ゼロ値の場合は全てのユーザを処理する）
+	Shard shard.Shard
+	// 指定した場合はこのユーザのみ処理する（/admin poll）
+	UserID string
+}
+
+// NotifyHandler は通知処理を実行する。スケジューラから呼び出す。
+// クエリパラメータ shard（1/4 など）を指定すると、設定のシャードの代わりにそのシャードのユーザのみ処理する。
+// 設定でシャードを指定している場合は、同じ分割数のシャードのみ指定できる。
+func NotifyHandler(db *firestore.DB, discord *discordgo.Session, vrc *vrc2.VRC, settings rule.Settings, opts PollOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		discord, err := discordgo.New("Bot " + os.Getenv("DISCORD_TOKEN"))
-		if err != nil {
-			ErrorHandler(w, err, http.StatusInternalServerError)
+		// opts はリクエスト間で共有するため、リクエストごとにコピーしてから変更する
+		reqOpts := opts
+		if v := r.URL.Query().Get("shard"); v != "" {
+			sh, err := shard.Parse(v)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// ロックはシャードの分割数ごとに別になるため、分割数が異なる実行は同じユーザを同時に処理してしまう
+			if opts.Shard.Count > 1 && sh.Count != opts.Shard.Count {
+				http.Error(w, fmt.Sprintf("shard %s does not match the configured shard count %d", sh, opts.Shard.Count), http.StatusBadRequest)
+				return
+			}
+			reqOpts.Shard = sh
+		}
+
+		if err := Poll(r.Context(), db, discord, vrc, settings, reqOpts); err != nil {
+			ErrorHandler(r.Context(), w, err, http.StatusInternalServerError)
 			return
 		}
+		writeOK(r.Context(), w)
+	}
+}
 
-		vrc := vrc2.NewVRC()
+// Poll は担当するユーザについて通知対象のフレンドのプレゼンスを確認し、必要に応じて通知する。
+// opts.LockTTL が指定されている場合はシャードごとのロックを取得し、他の実行が処理中であれば何もしない。
+func Poll(ctx context.Context, db *firestore.DB, discord *discordgo.Session, vrc *vrc2.VRC, settings rule.Settings, opts PollOptions) error {
+	_, err := poll(ctx, db, discord, vrc, settings, opts)
+	return err
+}
 
-		userInfos, err := db.GetAllUserInfo()
-		if err != nil {
-			ErrorHandler(w, err, http.StatusInternalServerError)
-			return
+// poll は Poll と同じ処理を行い、他の実行がロックを持っていたために実行しなかった場合は false を返す。
+func poll(ctx context.Context, db *firestore.DB, discord *discordgo.Session, vrc *vrc2.VRC, settings rule.Settings, opts PollOptions) (bool, error) {
+	run := func(ctx context.Context) error {
+		return pollUsers(ctx, db, discord, vrc, settings, opts.Shard, opts.UserID)
+	}
+
+	// 1人のユーザを処理する場合は、そのユーザを担当するシャードの実行と重ならないよう全体のロックを取る
+	name := pollLeaseName(opts.Shard)
+	if opts.UserID != "" {
+		name = pollLeaseGroup
+	}
+
+	var ran bool
+	var err error
+	if opts.LockTTL > 0 {
+		ran, err = withLease(ctx, db, name, pollLeaseGroup, opts.LockTTL, run)
+	} else {
+		ran, err = true, run(ctx)
+	}
+
+	switch {
+	case !ran && err == nil:
+		slog.InfoContext(ctx, "Skipped polling because another run is in progress", "shard", opts.Shard.String())
+		metrics.PollRuns.WithLabelValues("locked").Inc()
+	case err != nil:
+		metrics.PollRuns.WithLabelValues("failed").Inc()
+	default:
+		metrics.PollRuns.WithLabelValues("completed").Inc()
+	}
+	return ran, err
+}
+
+// pollLeaseGroup は通知処理のロックのグループ。分割しない実行のロックの名前でもある
+const pollLeaseGroup = "poll"
+
+// pollLeaseName は通知処理のロックの名前を返す。シャードごとに別のロックにし、シャード同士は並行して実行できるようにする。
+// 分割しない実行のロックはグループ全体のロックになるため、シャードの実行と同時には実行されない。
+func pollLeaseName(sh shard.Shard) string {
+	if sh.Count <= 1 {
+		return pollLeaseGroup
+	}
+	return fmt.Sprintf("poll-%d-of-%d", sh.Index, sh.Count)
+}
+
+// pollUsers はシャードが担当する全てのユーザ（userID を指定した場合はそのユーザのみ）について、
+// 未送信の通知の再送と通知処理を行う。
+// 一部のユーザの処理に失敗しても、残りのユーザの処理は続ける。ctx がキャンセルされた場合は中断する。
+func pollUsers(ctx context.Context, db *firestore.DB, discord *discordgo.Session, vrc *vrc2.VRC, settings rule.Settings, sh shard.Shard, userID string) error {
+	start := time.Now()
+	defer func() {
+		metrics.PollDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	userInfos, err := db.GetAllUserInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if userID != "" {
+		userInfo, ok := userInfos[userID]
+		if !ok {
+			return firestore.ErrUserNotFound
 		}
+		userInfos = map[string]firestore.UserInfo{userID: userInfo}
+	}
 
-		for discordID, userInfo := range userInfos {
-			// 初回ログインをしていない場合やターゲットユーザが登録されていない場合はスキップ
-			if userInfo.Token == "" || userInfo.TwoFactorAuthToken == "" || userInfo.TargetVRCUserID == "" {
-				continue
-			}
+	// 前回までの実行で送信できなかった通知を先に再送する
+	redeliverIntents(ctx, db, discord, settings, userInfos, sh)
+
+	var errs []error
+	for discordID, userInfo := range userInfos {
+		if !sh.Owns(discordID) {
+			continue
+		}
+		if ctx.Err() != nil {
+			errs = append(errs, context.Cause(ctx))
+			break
+		}
+		if err := pollUser(ctx, db, vrc, discord, settings, discordID, userInfo); err != nil {
+			slog.ErrorContext(ctx, "Failed to poll user", "discordID", discordID, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
 
-			// トークンがまだ有効か確認
-			ok, err := vrc.VerifyAuthToken(userInfo.Token)
+// pollUser はユーザが通知対象に登録したフレンドのプレゼンスを確認し、必要に応じて通知する。
+func pollUser(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, discord *discordgo.Session, settings rule.Settings, discordID string, userInfo firestore.UserInfo) error {
+	ctx, span := tracing.Start(ctx, "notify.poll_user", attribute.String("discord.user_id", discordID))
+	defer span.End()
+	ctx = userContext(ctx, userInfo)
+
+	// 初回ログインをしていない場合やターゲットユーザが登録されていない場合、利用を停止されている場合はスキップ
+	targets := userInfo.WatchTargets()
+	if userInfo.Disabled || userInfo.Unreachable || userInfo.Token == "" || userInfo.TwoFactorAuthToken == "" || len(targets) == 0 {
+		metrics.PollUsers.WithLabelValues("skipped").Inc()
+		return nil
+	}
+	metrics.PollUsers.WithLabelValues("processed").Inc()
+
+	// トークンがまだ有効か確認
+	ok, err := vrc.VerifyAuthToken(ctx, userInfo.Token)
+	if err != nil {
+		return err
+	}
+
+	// トークンが無効な場合はDiscordに通知
+	if !ok {
+		// ログは毎回表示
+		slog.WarnContext(ctx, "Auth token is invalid", "discordID", discordID)
+		metrics.TokenInvalid.Inc()
+
+		// ただし、Discordへの通知は一度だけにする
+		// 通知フラグがFALSEの場合のみ通知を行い、通知後にTRUEに変更する
+		// 通知の意図の記録と同時に通知フラグをTRUEにし、送信に失敗した場合は意図から再送する
+		if !userInfo.Notificationed {
+			err := deliver(ctx, db, discord, settings, userInfo, firestore.NotificationIntent{
+				Key:       reauthIntentKey(discordID, userInfo.Token),
+				DiscordID: discordID,
+				Kind:      firestore.IntentReauth,
+			}, notify.Event{
+				Type:      notify.EventReauthRequired,
+				DiscordID: discordID,
+				Message:   i18n.T(ctx, "auth.relogin"),
+				Time:      time.Now(),
+			})
+			audit(ctx, db, discordID, auditSessionExpired, auditOutcome(err))
 			if err != nil {
-				ErrorHandler(w, err, http.StatusInternalServerError)
-				continue
+				return err
 			}
+		}
+		// 無効なトークンではフレンドの情報を取得できない
+		return nil
+	}
 
-			// トークンが無効な場合はDiscordに通知
-			if !ok {
-				// ログは毎回表示
-				slog.Warn("Auth token is invalid", "discordID", discordID)
-
-				// ただし、Discordへの通知は一度だけにする
-				// 通知フラグがFALSEの場合のみ通知を行い、通知後にTRUEに変更する
-				if !userInfo.Notificationed {
-					// Discordへの通知
-					if _, err := discord.ChannelMessageSend(userInfo.ChannelID, "再ログインしてください。"); err != nil {
-						ErrorHandler(w, err, http.StatusInternalServerError)
-						continue
-					}
-					// 次回実行時に通知しないようにするための処理
-					if err := db.ChangeNotificationed(discordID, true); err != nil {
-						ErrorHandler(w, err, http.StatusInternalServerError)
-					}
-					continue
-				}
-			}
+	// 通知対象のフレンドごとにプレゼンスを確認する
+	var presences []firestore.Presence
+	var errs []error
+	for _, targetID := range targets {
+		tu, err := vrc.GetUserInfo(ctx, targetID, userInfo.Token, userInfo.TwoFactorAuthToken)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get target user info", "error", err)
+			continue
+		}
+
+		// プレゼンスが変化していれば履歴に記録する
+		if tu.ID != "" {
+			presences = append(presences, recordPresence(ctx, db, discordID, userInfo, tu))
+		}
 
-			// ターゲットユーザの情報を取得
-			tu, err := vrc.GetUserInfo(userInfo.TargetVRCUserID, userInfo.Token, userInfo.TwoFactorAuthToken)
+		notified := userInfo.Notified[targetID]
+		// ダイジェストのみを受け取る設定の場合は、オンライン時の通知を送らない
+		if tu.State == "online" && tu.Status == "join me" && !notified && !userInfo.DigestOnly {
+			// ユーザが選択した通知先への通知
+			// 送信前に通知の意図を記録し、送信済みフラグも同時に立てることで、重複して通知しないようにする
+			err := deliverJoinMe(ctx, db, discord, settings, discordID, userInfo, targetID, notify.Event{
+				Type:              notify.EventJoinMe,
+				DiscordID:         discordID,
+				TargetUserID:      tu.ID,
+				DisplayName:       tu.DisplayName,
+				State:             tu.State,
+				Status:            tu.Status,
+				StatusDescription: tu.StatusDescription,
+				Location:          tu.Location,
+				Platform:          tu.Platform,
+				Title:             i18n.T(ctx, "notify.title"),
+				Message:           joinMessage(ctx, vrc, settings, discordID, userInfo, tu),
+				Time:              time.Now(),
+			})
 			if err != nil {
-				slog.Error("Failed to get target user info", "error", err)
+				errs = append(errs, err)
 				continue
 			}
-			if tu.State == "online" && tu.Status == "join me" && !userInfo.Notificationed {
-				// Discordへの通知
-				if _, err := discord.ChannelMessageSend(userInfo.ChannelID, tu.DisplayName+" さんがオンラインになりました。"); err != nil {
-					ErrorHandler(w, err, http.StatusInternalServerError)
-					continue
-				}
-
-				// 次回実行時に通知しないようにするための処理
-				err := db.ChangeNotificationed(discordID, true)
-				if err != nil {
-					ErrorHandler(w, err, http.StatusInternalServerError)
-					continue
-				}
-
-			}
-			// オフラインになった場合、通知フラグをFALSEに戻す
-			if tu.State == "offline" && userInfo.Notificationed {
-				err := db.ChangeNotificationed(discordID, false)
-				if err != nil {
-					ErrorHandler(w, err, http.StatusInternalServerError)
-					continue
-				}
-			}
 		}
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("OK")); err != nil {
-			ErrorHandler(w, err, http.StatusInternalServerError)
-			return
+		// オフラインになった場合、通知フラグをFALSEに戻し、次にオンラインになったときは別の通知として扱う
+		if tu.State == "offline" && notified {
+			err := db.EndJoinEpisode(ctx, discordID, targetID)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
 		}
 	}
+
+	// 複数の通知対象のフレンドが同じインスタンスに集まっていれば通知する
+	notifyGathering(ctx, db, vrc, discord, settings, discordID, userInfo, presences)
+	return errors.Join(errs...)
+}
+
+// notifierFor はユーザが選択した通知先を返す。
+// Discordの場合、通知先チャンネルが設定されていればそのチャンネルに、設定されていなければDMに通知する。
+func notifierFor(discord *discordgo.Session, settings rule.Settings, userInfo firestore.UserInfo) notify.Notifier {
+	switch userInfo.Notifier {
+	case notify.KindSlack:
+		return notify.NewSlack(userInfo.NotifierTarget)
+	case notify.KindWebhook:
+		return notify.NewWebhook(userInfo.NotifierTarget, userInfo.NotifierSecret)
+	case notify.KindEmail:
+		return notify.NewEmail(settings.SMTP, userInfo.NotifierTarget)
+	}
+
+	if userInfo.NotifyChannelID != "" {
+		return &notify.Discord{Session: discord, ChannelID: userInfo.NotifyChannelID, RoleID: userInfo.MentionRoleID}
+	}
+	return &notify.Discord{Session: discord, ChannelID: userInfo.ChannelID}
 }
 
-func ErrorHandler(w http.ResponseWriter, err error, status int) {
-	slog.Error(err.Error())
-	http.Error(w, err.Error(), status)
+// eventNotifier は通知の送信先を返す。再ログインの依頼はユーザが選択した通知先ではなく、BotとのDMに送る。
+func eventNotifier(discord *discordgo.Session, settings rule.Settings, userInfo firestore.UserInfo, e notify.Event) notify.Notifier {
+	if e.Type == notify.EventReauthRequired {
+		return &notify.Discord{Session: discord, ChannelID: userInfo.ChannelID}
+	}
+	return notifierFor(discord, settings, userInfo)
+}
+
+// notifierKind は監査ログに記録する通知先の種類を返す。宛先は秘密の情報を含むため記録しない。
+func notifierKind(userInfo firestore.UserInfo) string {
+	if userInfo.Notifier != "" {
+		return userInfo.Notifier
+	}
+	return notify.KindDiscord
+}
+
+// ErrorHandler はエラーをログに記録し、ステータスコードを返す。
+// ログにトレースのIDを含めるため、ctx にはリクエストの Context を渡す。内部のエラーの内容はレスポンスに含めない。
+func ErrorHandler(ctx context.Context, w http.ResponseWriter, err error, status int) {
+	slog.ErrorContext(ctx, "Request failed", "status", status, "error", err)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// writeOK は処理が成功したことを返す。
+// ヘッダを送信した後は別のステータスを返せないため、書き込みの失敗はログに記録するだけにする。
+func writeOK(ctx context.Context, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("OK")); err != nil {
+		slog.WarnContext(ctx, "Failed to write response", "error", err)
+	}
 }
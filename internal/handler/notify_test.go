@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/shard"
+)
+
+func TestPollLeaseName(t *testing.T) {
+	tests := []struct {
+		shard shard.Shard
+		want  string
+	}{
+		{shard.Shard{}, "poll"},
+		{shard.Shard{Index: 0, Count: 1}, "poll"},
+		{shard.Shard{Index: 1, Count: 2}, "poll-1-of-2"},
+		{shard.Shard{Index: 1, Count: 4}, "poll-1-of-4"},
+	}
+	for _, tt := range tests {
+		if got := pollLeaseName(tt.shard); got != tt.want {
+			t.Errorf("pollLeaseName(%v) = %q, want %q", tt.shard, got, tt.want)
+		}
+	}
+}
+
+func TestNotifyHandlerRejectsShardCount(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?shard=1/2", http.StatusBadRequest},
+		{"?shard=0/1", http.StatusBadRequest},
+		{"?shard=4/4", http.StatusBadRequest},
+		{"?shard=abc", http.StatusBadRequest},
+	}
+	// 不正なシャードは通知処理の前に拒否するため、依存するクライアントは不要
+	h := NotifyHandler(nil, nil, nil, rule.Settings{}, PollOptions{Shard: shard.Shard{Index: 1, Count: 4}})
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("POST", "/notify"+tt.query, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.query, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	disc "github.com/aopontann/vrc-join-notify/internal/discord"
+	"github.com/bwmarrin/discordgo"
+)
+
+// statusRecorder はハンドラが返したHTTPステータスコードを記録する。
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// outcome はステータスコードをメトリクスのラベルの値に変換する。
+func (r *statusRecorder) outcome() string {
+	if r.status >= http.StatusBadRequest {
+		return "error"
+	}
+	return "ok"
+}
+
+// commandName はサブコマンドを含めたコマンド名（join register など）を返す。
+func commandName(data *disc.InteractionData) string {
+	if data == nil {
+		return ""
+	}
+	name := data.Name
+	// サブコマンドグループ・サブコマンドのみを辿る（オプションの値は含めない）
+	opts := data.Options
+	for len(opts) > 0 && (opts[0].Type == int(discordgo.ApplicationCommandOptionSubCommandGroup) || opts[0].Type == int(discordgo.ApplicationCommandOptionSubCommand)) {
+		name += " " + opts[0].Name
+		opts = opts[0].Options
+	}
+	return name
+}
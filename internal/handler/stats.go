@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	"github.com/aopontann/vrc-join-notify/internal/stats"
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+	"github.com/bwmarrin/discordgo"
+)
+
+// presenceRetention はプレゼンスの履歴を保持する期間
+const presenceRetention = 12 * 7 * 24 * time.Hour
+
+// recordPresence はフレンドのプレゼンスが前回の観測から変化していれば履歴に記録する。
+// 戻り値は今回観測したプレゼンス
+func recordPresence(ctx context.Context, db *firestore.DB, discordID string, userInfo firestore.UserInfo, tu vrc2.UserInfo) firestore.Presence {
+	p := firestore.Presence{
+		TargetVRCUserID: tu.ID,
+		DisplayName:     tu.DisplayName,
+		State:           tu.State,
+		Status:          tu.Status,
+		WorldID:         vrc2.WorldIDFromLocation(tu.Location),
+		Location:        tu.Location,
+		Platform:        tu.Platform,
+		ObservedAt:      time.Now(),
+	}
+
+	last, ok := userInfo.LastPresences[tu.ID]
+	if ok && !p.Changed(last) {
+		return p
+	}
+
+	if err := db.SavePresence(ctx, discordID, p); err != nil {
+		slog.ErrorContext(ctx, "Failed to save presence", "discordID", discordID, "error", err)
+		return p
+	}
+
+	// 保持期間を過ぎた履歴を削除する
+	if err := db.DeletePresenceHistoryBefore(ctx, discordID, p.ObservedAt.Add(-presenceRetention)); err != nil {
+		slog.ErrorContext(ctx, "Failed to delete old presence history", "discordID", discordID, "error", err)
+	}
+	return p
+}
+
+// statsSummary は通知対象のフレンドの直近 weeks 週間のオンライン状況をまとめたメッセージを返す。
+// 曜日や時間帯はユーザのタイムゾーンで集計する。
+func statsSummary(ctx context.Context, db *firestore.DB, vrc *vrc2.VRC, settings rule.Settings, discordID string, weeksOption string, userOption string) string {
+	q, msg := loadStatsQuery(ctx, db, discordID, weeksOption, userOption)
+	if msg != "" {
+		return msg
+	}
+	s := stats.Summarize(q.history, q.from, q.to, userLocation(settings, q.userInfo))
+
+	var b strings.Builder
+	b.WriteString(i18n.T(ctx, "stats.summary", watchTargetName(q.userInfo, q.targetID), q.weeks) + "\n")
+	b.WriteString(i18n.T(ctx, "stats.total", formatDuration(ctx, s.Total), formatDuration(ctx, s.DailyAverage)) + "\n")
+
+	b.WriteString("\n" + i18n.T(ctx, "stats.by_weekday") + "\n")
+	weekdays := strings.Split(i18n.T(ctx, "stats.weekdays"), ",")
+	// 月曜日から表示する
+	for i := 1; i <= 7; i++ {
+		wd := time.Weekday(i % 7)
+		fmt.Fprintf(&b, "- %s: %s\n", weekdays[wd], formatDuration(ctx, s.ByWeekday[wd]))
+	}
+
+	if len(s.Windows) > 0 {
+		b.WriteString("\n" + i18n.T(ctx, "stats.windows") + "\n")
+		for _, w := range s.Windows {
+			b.WriteString("- " + i18n.T(ctx, "stats.window", w.StartHour, w.EndHour%24) + "\n")
+		}
+	}
+
+	if len(s.Worlds) > 0 {
+		b.WriteString("\n" + i18n.T(ctx, "stats.worlds") + "\n")
+		for i, w := range s.Worlds {
+			if i >= 5 {
+				break
+			}
+			name := w.WorldID
+			if world, err := vrc.GetWorld(ctx, w.WorldID, q.userInfo.Token, q.userInfo.TwoFactorAuthToken); err == nil {
+				name = world.Name
+			}
+			b.WriteString(i18n.T(ctx, "stats.world", i+1, name, w.Visits, formatDuration(ctx, w.Duration)) + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// statsHeatmap は通知対象のフレンドの曜日×時間帯ごとのオンライン率のヒートマップ画像を返す。
+// 曜日や時間帯はユーザのタイムゾーンで集計する。画像を作成できなかった場合は、ユーザに返すメッセージを返す。
+func statsHeatmap(ctx context.Context, db *firestore.DB, settings rule.Settings, discordID string, weeksOption string, userOption string) (*discordgo.MessageSend, string) {
+	q, msg := loadStatsQuery(ctx, db, discordID, weeksOption, userOption)
+	if msg != "" {
+		return nil, msg
+	}
+
+	var buf bytes.Buffer
+	if err := stats.NewHeatmap(q.history, q.from, q.to, userLocation(settings, q.userInfo)).EncodePNG(&buf); err != nil {
+		return nil, reportError(ctx, fail("stats.heatmap_failed", err), "Failed to encode heatmap", "discordID", discordID)
+	}
+
+	return &discordgo.MessageSend{
+		Content: i18n.T(ctx, "stats.heatmap", watchTargetName(q.userInfo, q.targetID), q.weeks),
+		Files: []*discordgo.File{
+			{
+				Name:        "heatmap.png",
+				ContentType: "image/png",
+				Reader:      &buf,
+			},
+		},
+	}, ""
+}
+
+// statsQuery は統計の集計対象
+type statsQuery struct {
+	weeks    int
+	userInfo firestore.UserInfo
+	targetID string
+	from     time.Time
+	to       time.Time
+	history  []firestore.Presence
+}
+
+// loadStatsQuery は通知対象のフレンドの直近の履歴を取得する。
+// 期間の開始時点の状態が分かるよう、期間より前の最後のプレゼンスを履歴の先頭に加える。
+// フレンドが指定されていない場合は、最初に登録したフレンドを対象とする。
+// 取得できなかった場合は、ユーザに返すメッセージを返す。
+func loadStatsQuery(ctx context.Context, db *firestore.DB, discordID string, weeksOption string, userOption string) (statsQuery, string) {
+	weeks, err := parseWeeks(weeksOption)
+	if err != nil {
+		return statsQuery{}, i18n.T(ctx, "stats.invalid_weeks")
+	}
+
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return statsQuery{}, reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+	targetID, msg := resolveWatchTarget(ctx, userInfo, userOption)
+	if msg != "" {
+		return statsQuery{}, msg
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -7*weeks)
+	history, err := db.GetPresenceHistory(ctx, discordID, from)
+	if err != nil {
+		return statsQuery{}, reportError(ctx, fail("stats.history_failed", err), "Failed to get presence history", "discordID", discordID)
+	}
+	history, err = withLastPresence(ctx, db, discordID, targetID, from, filterPresence(history, targetID))
+	if err != nil {
+		return statsQuery{}, reportError(ctx, fail("stats.history_failed", err), "Failed to get last presence", "discordID", discordID)
+	}
+	if len(history) == 0 {
+		return statsQuery{}, i18n.T(ctx, "stats.no_history")
+	}
+
+	return statsQuery{weeks: weeks, userInfo: userInfo, targetID: targetID, from: from, to: to, history: history}, ""
+}
+
+// withLastPresence は from より前に観測した最後のプレゼンスを、1人のフレンドの履歴の先頭に加える。
+// 期間の前から続いているセッションや、期間中に変化のなかったフレンドも集計できるようにする
+func withLastPresence(ctx context.Context, db *firestore.DB, discordID string, targetID string, from time.Time, history []firestore.Presence) ([]firestore.Presence, error) {
+	last, ok, err := db.GetLastPresenceBefore(ctx, discordID, targetID, from)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return history, nil
+	}
+	return append([]firestore.Presence{last}, history...), nil
+}
+
+// parseWeeks は集計する週数を解析する。未指定の場合は4週間とする。
+func parseWeeks(s string) (int, error) {
+	if s == "" {
+		return 4, nil
+	}
+	weeks, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if weeks < 1 || weeks > 12 {
+		return 0, fmt.Errorf("weeks out of range: %d", weeks)
+	}
+	return weeks, nil
+}
+
+// filterPresence は指定したフレンドの履歴だけを返す。
+func filterPresence(history []firestore.Presence, targetID string) []firestore.Presence {
+	var filtered []firestore.Presence
+	for _, p := range history {
+		if p.TargetVRCUserID == targetID {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+func formatDuration(ctx context.Context, d time.Duration) string {
+	d = d.Round(time.Minute)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	if h == 0 {
+		return i18n.T(ctx, "duration.minutes", m)
+	}
+	return i18n.T(ctx, "duration.hours", h, m)
+}
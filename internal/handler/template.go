@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	disc "github.com/aopontann/vrc-join-notify/internal/discord"
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/i18n"
+	"github.com/aopontann/vrc-join-notify/internal/message"
+	"github.com/aopontann/vrc-join-notify/internal/rule"
+	vrc2 "github.com/aopontann/vrc-join-notify/internal/vrc"
+)
+
+// joinMessage はユーザが設定したテンプレートから「だれでもおいで」になったときの通知文を作成する。
+// テンプレートの実行に失敗した場合は既定の通知文を返す。
+func joinMessage(ctx context.Context, vrc *vrc2.VRC, settings rule.Settings, discordID string, userInfo firestore.UserInfo, tu vrc2.UserInfo) string {
+	data := message.Data{
+		DisplayName:       tu.DisplayName,
+		UserID:            tu.ID,
+		Status:            tu.Status,
+		StatusDescription: tu.StatusDescription,
+		WorldID:           vrc2.WorldIDFromLocation(tu.Location),
+		InstanceType:      vrc2.InstanceTypeFromLocation(tu.Location),
+		Platform:          tu.Platform,
+		Time:              time.Now().In(userLocation(settings, userInfo)),
+	}
+	tmpl, err := message.Parse(templateText(ctx, userInfo.NotifyTemplate))
+	// ワールド名の取得にはAPIの呼び出しが必要なため、テンプレートで使う場合のみ取得する
+	if err == nil && data.WorldID != "" && tmpl.UsesField("World") {
+		if world, err := vrc.GetWorld(ctx, data.WorldID, userInfo.Token, userInfo.TwoFactorAuthToken); err == nil {
+			data.World = world.Name
+		}
+	}
+
+	var msg string
+	if err == nil {
+		msg, err = tmpl.Execute(data)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to render notify template", "discordID", discordID, "error", err)
+		msg, _ = message.Render(templateText(ctx, ""), data)
+	}
+	return msg
+}
+
+// userLocation はユーザの時刻の表示に使うタイムゾーンを返す。
+// ダイジェストのタイムゾーンが設定されていればそれを、なければ既定のタイムゾーンを使う。
+func userLocation(settings rule.Settings, userInfo firestore.UserInfo) *time.Location {
+	for _, name := range []string{userInfo.DigestTimezone, settings.DefaultTimezone} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// configureTemplate は通知文のテンプレートを設定、既定に戻す、またはプレビューする。
+// 戻り値はユーザに返すメッセージ
+func configureTemplate(ctx context.Context, db *firestore.DB, settings rule.Settings, discordID string, subCmd disc.InteractionOption) string {
+	userInfo, err := db.GetUserInfo(ctx, discordID)
+	if err != nil {
+		return reportError(ctx, fail("user_info_failed", err), "Failed to get user info", "discordID", discordID)
+	}
+
+	switch subCmd.Name {
+	case "set":
+		text := subCmd.Option("template")
+		preview, err := previewTemplate(ctx, settings, userInfo, text)
+		if err != nil {
+			return templateErrorMessage(ctx, err)
+		}
+		if err := db.SaveNotifyTemplate(ctx, discordID, text); err != nil {
+			return reportError(ctx, fail("template.save_failed", err), "Failed to save notify template", "discordID", discordID)
+		}
+		return i18n.T(ctx, "template.set", preview)
+	case "reset":
+		if err := db.SaveNotifyTemplate(ctx, discordID, ""); err != nil {
+			return reportError(ctx, fail("template.save_failed", err), "Failed to save notify template", "discordID", discordID)
+		}
+		return i18n.T(ctx, "template.reset")
+	case "preview":
+		// テンプレートを指定しない場合は設定中のテンプレートをプレビューする
+		text := subCmd.Option("template")
+		if text == "" {
+			text = userInfo.NotifyTemplate
+		}
+		preview, err := previewTemplate(ctx, settings, userInfo, text)
+		if err != nil {
+			return templateErrorMessage(ctx, err)
+		}
+		return i18n.T(ctx, "template.preview", preview)
+	}
+	return i18n.T(ctx, "unsupported_command")
+}
+
+// previewTemplate はサンプルのデータでテンプレートを実行する。
+// 存在しないフィールドの参照など、実行時にしか分からない誤りもここで検出する。
+func previewTemplate(ctx context.Context, settings rule.Settings, userInfo firestore.UserInfo, text string) (string, error) {
+	t, err := message.Parse(templateText(ctx, text))
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(message.SampleData(time.Now().In(userLocation(settings, userInfo))))
+}
+
+// templateText はテンプレートが設定されていない場合に、ユーザの言語の既定のテンプレートを返す。
+func templateText(ctx context.Context, text string) string {
+	if text == "" {
+		return i18n.T(ctx, "template.default")
+	}
+	return text
+}
+
+func templateErrorMessage(ctx context.Context, err error) string {
+	if errors.Is(err, message.ErrTooLong) {
+		return i18n.T(ctx, "template.too_long")
+	}
+	return i18n.T(ctx, "template.invalid", err.Error())
+}
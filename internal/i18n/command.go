@@ -0,0 +1,131 @@
+package i18n
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandLocales は英語の名前・説明を設定するDiscordのロケール
+var commandLocales = []discordgo.Locale{discordgo.EnglishUS, discordgo.EnglishGB}
+
+// enCommands はスラッシュコマンドの英語の説明
+// キーはコマンド・サブコマンド・オプションの名前を . でつないだもの、選択肢は オプション=値
+var enCommands = map[string]string{
+	"auth":                 "Authentication",
+	"auth.login":           "Log in",
+	"auth.login.username":  "Username",
+	"auth.login.password":  "Password",
+	"auth.email-code":      "Two-factor authentication with an email code",
+	"auth.email-code.code": "Code",
+	"auth.logout":          "Log out",
+
+	"join":                 "Friends to be notified about",
+	"join.register":        "Watch a friend",
+	"join.register.url":    "User page URL, user ID or display name",
+	"join.unregister":      "Stop watching a friend",
+	"join.unregister.user": "Watched friend",
+	"join.list":            "List watched friends",
+	"join.gathering":       "Notify when watched friends gather in the same instance",
+	"join.gathering.min":   "How many friends must gather (0 turns it off)",
+
+	"stats":               "Online statistics for watched friends",
+	"stats.summary":       "Online time, most visited worlds and usual online hours",
+	"stats.summary.weeks": "Number of weeks (default: 4)",
+	"stats.summary.user":  "Watched friend (default: the first one watched)",
+	"stats.heatmap":       "Heatmap of online rates by weekday and hour",
+	"stats.heatmap.weeks": "Number of weeks (default: 4)",
+	"stats.heatmap.user":  "Watched friend (default: the first one watched)",
+
+	"export":                     "Export data",
+	"export.calendar":            "Export watched friends' online history as a calendar (.ics)",
+	"export.calendar.regenerate": "Issue a new subscription URL (the old URL stops working)",
+
+	"digest":                 "Daily digest",
+	"digest.enable":          "Receive the daily digest",
+	"digest.enable.time":     "Time to send (e.g. 21:00)",
+	"digest.enable.timezone": "Time zone (default: Asia/Tokyo)",
+	"digest.enable.instant":  "Also receive online notifications (default: true)",
+	"digest.disable":         "Stop the daily digest",
+
+	"notify":                     "Notification destination",
+	"notify.sink":                "Where notifications are sent",
+	"notify.sink.set":            "Set where notifications are sent",
+	"notify.sink.set.type":       "Destination type",
+	"notify.sink.set.type=email": "Email",
+	"notify.sink.set.target":     "Slack incoming webhook URL, webhook URL or email address",
+	"notify.sink.verify":         "Enter the code sent to your email address",
+	"notify.sink.verify.code":    "Verification code",
+	"notify.sink.reset":          "Send notifications to Discord again",
+	"notify.channel":             "Notification channel",
+	"notify.channel.set":         "Send notifications to a server text channel",
+	"notify.channel.set.channel": "Notification channel",
+	"notify.channel.set.role":    "Role to mention in notifications",
+	"notify.channel.clear":       "Send notifications to DMs again",
+
+	"settings":                           "Settings",
+	"settings.template":                  "Notification message template",
+	"settings.template.set":              "Set the notification message template",
+	"settings.template.set.template":     "Template (e.g. {{.DisplayName}} is in {{.World}})",
+	"settings.template.reset":            "Reset the notification message to the default",
+	"settings.template.preview":          "Preview the notification message with sample data",
+	"settings.template.preview.template": "Template to preview (default: the current template)",
+
+	"account":        "Your account",
+	"account.export": "Send the data we store about you to your DMs as a JSON file",
+	"account.delete": "Log out and delete all your data",
+
+	"history":       "Show your activity history",
+	"history.limit": "Number of entries (default: 10)",
+
+	"admin":                   "Bot administration",
+	"admin.stats":             "User count and breakdown by status",
+	"admin.user":              "Show a user's state",
+	"admin.user.user":         "User",
+	"admin.poll":              "Poll a user now",
+	"admin.poll.user":         "User",
+	"admin.history":           "Show a user's activity history",
+	"admin.history.user":      "User",
+	"admin.history.limit":     "Number of entries (default: 10)",
+	"admin.broadcast":         "Send an announcement DM to all users",
+	"admin.broadcast.message": "Announcement text",
+	"admin.disable":           "Disable a user",
+	"admin.disable.user":      "User",
+	"admin.enable":            "Enable a user",
+	"admin.enable.user":       "User",
+}
+
+// LocalizeCommand はスラッシュコマンドとそのオプションに英語の説明と選択肢の名前を設定する。
+// Discordの言語設定が英語のユーザには英語で、それ以外のユーザにはコマンドの定義のまま表示される。
+func LocalizeCommand(cmd *discordgo.ApplicationCommand) *discordgo.ApplicationCommand {
+	if desc, ok := enCommands[cmd.Name]; ok {
+		cmd.DescriptionLocalizations = localizations(desc)
+	}
+	for _, opt := range cmd.Options {
+		localizeOption(cmd.Name, opt)
+	}
+	return cmd
+}
+
+func localizeOption(parent string, opt *discordgo.ApplicationCommandOption) {
+	key := parent + "." + opt.Name
+	if desc, ok := enCommands[key]; ok {
+		opt.DescriptionLocalizations = *localizations(desc)
+	}
+	for _, c := range opt.Choices {
+		if name, ok := enCommands[key+"="+fmt.Sprint(c.Value)]; ok {
+			c.NameLocalizations = *localizations(name)
+		}
+	}
+	for _, sub := range opt.Options {
+		localizeOption(key, sub)
+	}
+}
+
+func localizations(s string) *map[discordgo.Locale]string {
+	m := make(map[discordgo.Locale]string, len(commandLocales))
+	for _, l := range commandLocales {
+		m[l] = s
+	}
+	return &m
+}
@@ -0,0 +1,238 @@
+package i18n
+
+var en = map[string]string{
+	// 共通
+	"ok":                  "OK",
+	"error":               "An error occurred.",
+	"unsupported_command": "This command is not supported.",
+	"not_implemented":     "Not implemented yet.",
+	"user_info_failed":    "Failed to load your user information.",
+	"world":               "World: %s",
+	"error_id":            "(Error ID: %s)",
+
+	// インストール時の案内
+	"onboarding.user": `
+The app has been installed.
+This app notifies you when the friends you choose change their status to "Join Me".
+Everything is done with slash commands.
+You can run slash commands from the gamepad button at the bottom of the screen.
+Slash commands
+- /auth login		Log in
+- /auth logout		Log out
+- /auth email-code	Two-factor authentication
+- /join register	Watch a friend
+- /join unregister	Stop watching a friend
+- /join list		List watched friends
+- /join gathering	Notify when several friends gather
+- /notify channel set	Send notifications to a server channel (when installed to a server)
+- /notify sink set	Send notifications to Slack, a webhook or email
+- /stats summary	Online statistics for watched friends
+- /stats heatmap	Heatmap of online rates by weekday and hour
+- /export calendar	Export online history as a calendar (.ics)
+- /digest enable	Receive a daily digest
+- /settings template set	Customise the notification message
+- /history		Your activity history
+- /account export	Export the data we store about you
+- /account delete	Delete your account
+
+Getting started
+1. Run the login command with your username and password.
+2. If you see "A verification code has been sent to your email.", run the two-factor authentication command with the code from the email.
+3. Run the watch command with your friend's VRChat web page URL, user ID or display name.
+4. You will be notified when that friend's status changes to "Join Me".
+
+Notes
+- If you receive "Please log in again.", run the login command again.
+- You can watch up to %d friends.
+- To watch another friend, run the watch command again.
+- A friend's VRChat web page URL looks like https://vrchat.com/home/user/XXXXXX
+- The watch command suggests friends as you type a display name.
+- Messages are shown in Japanese if your Discord language is set to Japanese.
+`,
+	"onboarding.guild": `
+The app has been installed to the server.
+To receive notifications in a text channel, run the following commands in the server.
+- /notify channel set	Set the notification channel (you can also choose a role to mention)
+- /notify channel clear	Send notifications to DMs again
+
+Notes
+- Setting the notification channel requires the "Manage Channels" permission.
+- Log in and watch friends with /auth login and /join register as before.
+`,
+
+	// 認証
+	"auth.email_code_sent": "A verification code has been sent to your email.",
+	"auth.logged_in":       "Logged in.",
+	"auth.relogin":         "Please log in again.",
+	"auth.login_failed":    "Login failed. Check your username and password.",
+	"auth.login_error":     "An error occurred while logging in to VRChat. Please try again later.",
+	"auth.code_failed":     "The verification code is incorrect or has expired.",
+	"auth.save_failed":     "Failed to save your login information.",
+
+	// 通知対象のフレンド
+	"join.invalid_user":       "Could not identify the user. Specify a user page URL (https://vrchat.com/home/user/usr_XXXXXX), a user ID or a display name.",
+	"join.login_required":     "Please log in first.",
+	"join.friends_failed":     "Failed to load your friends. You may need to log in again.",
+	"join.ambiguous_name":     "You have more than one friend named \"%s\". Specify a user page URL or user ID instead.",
+	"join.friend_not_found":   "The user was not found in your friends.",
+	"join.already_registered": "You are already watching %s.",
+	"join.limit":              "You can watch up to %d friends. Use /join unregister to stop watching someone.",
+	"join.register_failed":    "Failed to watch the friend.",
+	"join.register_confirm":   "Watch %s (%s)?",
+	"join.register_button":    "Watch",
+	"join.cancel_button":      "Cancel",
+	"join.register_canceled":  "Canceled.",
+	"join.registered":         "Now watching %s (%s).",
+	"join.unregister_failed":  "Failed to stop watching the friend.",
+	"join.unregistered":       "Stopped watching %s.",
+	"join.empty":              "You are not watching any friends.",
+	"join.list":               "Watched friends",
+	"join.list_gathering":     "You will be notified when %d or more of them are in the same instance.",
+	"join.targets_required":   "Please watch a friend first.",
+	"join.unresolved_user":    "Could not identify the user.",
+	"join.not_target":         "You are not watching that user.",
+
+	// フレンドが集まったときの通知
+	"gathering.invalid_min": "Specify a number from 2 to %d. (0 turns the notification off)",
+	"gathering.save_failed": "Failed to save the setting.",
+	"gathering.disabled":    "Gathering notifications are now off.",
+	"gathering.enabled":     "You will be notified when %d or more watched friends are in the same instance.",
+	"gathering.members":     "%s are in the same instance.",
+	"gathering.separator":   ", ",
+
+	// 通知先
+	"notify.title":                    "VRChat Join Notification",
+	"channel.guild_only":              "Run this command in a server.",
+	"channel.permission_required":     "Setting the notification channel requires the \"Manage Channels\" permission.",
+	"channel.confirm":                 "Join notifications will be sent to this channel.",
+	"channel.confirm_mention":         "%s will be mentioned in notifications.",
+	"channel.send_failed":             "Could not send a message to the channel. Check that the bot can view and send messages there.",
+	"channel.save_failed":             "Failed to set the notification channel.",
+	"channel.set":                     "Notifications will be sent to %s.",
+	"channel.clear_failed":            "Failed to clear the notification channel.",
+	"channel.cleared":                 "Notifications will be sent to DMs again.",
+	"sink.target_required":            "Specify where to send notifications (a URL or an email address).",
+	"sink.target_invalid":             "The destination is not in a valid format.",
+	"sink.save_failed":                "Failed to set the notification destination.",
+	"sink.webhook_set":                "Notifications will be sent to the webhook.\nThe %s header of each request contains an HMAC-SHA256 signature of the body using the following secret.\nSecret: `%s`",
+	"sink.set":                        "Notifications will be sent to %s.",
+	"sink.reset":                      "Notifications will be sent to Discord again.",
+	"sink.email_unavailable":          "Email notifications are not available on this bot.",
+	"sink.email_wait":                 "A verification email was just sent. Try again in %d minutes.",
+	"sink.email_send_failed":          "Failed to send the verification email. Check the email address.",
+	"sink.email_verification_sent":    "A verification code has been sent to %s. Enter it with /notify sink verify to start receiving notifications by email.",
+	"sink.email_verification_subject": "VRChat JOIN notifier: verify your email address",
+	"sink.email_verification_body":    "Verification code: %s\n\nRun /notify sink verify on Discord and enter this code. The code expires in %d minutes.\nIf you did not request this, you can ignore this email.",
+	"sink.email_not_pending":          "There is no email address awaiting verification. Set one with /notify sink set.",
+	"sink.email_expired":              "The verification code has expired or too many attempts were made. Start over with /notify sink set.",
+	"sink.email_code_mismatch":        "The verification code does not match.",
+
+	// 統計
+	"stats.summary":        "Online activity of %s over the last %d weeks",
+	"stats.total":          "Total: %s (%s per day on average)",
+	"stats.by_weekday":     "Average by weekday",
+	"stats.weekdays":       "Sun,Mon,Tue,Wed,Thu,Fri,Sat",
+	"stats.windows":        "Usual online hours",
+	"stats.window":         "%d:00–%d:00",
+	"stats.worlds":         "Most visited worlds",
+	"stats.world":          "%d. %s (%d visits, %s)",
+	"stats.heatmap":        "Online rate of %s by weekday and hour over the last %d weeks (top: online, bottom: Join Me)",
+	"stats.heatmap_failed": "Failed to create the heatmap.",
+	"stats.invalid_weeks":  "Specify a number of weeks from 1 to 12.",
+	"stats.history_failed": "Failed to load the history.",
+	"stats.no_history":     "There is no history yet.",
+	"duration.minutes":     "%dm",
+	"duration.hours":       "%dh %dm",
+
+	// カレンダー
+	"calendar.failed":    "Failed to create the calendar.",
+	"calendar.exported":  "Exported the online history of your watched friends as a calendar.",
+	"calendar.subscribe": "Subscribe to the following URL in your calendar app to keep it up to date. (Do not share this URL with anyone)\n%s",
+	"calendar.name":      "VRChat friends' online history",
+	"calendar.event":     "%s online",
+	"calendar.ongoing":   " (online now)",
+	"calendar.status":    "Status: %s",
+
+	// ダイジェスト
+	"digest.header":           "Digest (%s – %s)",
+	"digest.empty":            "None of your watched friends came online during this period.",
+	"digest.online":           "- Online: %s (%d sessions)",
+	"digest.worlds":           "- Worlds: %s",
+	"digest.separator":        ", ",
+	"digest.invalid_time":     "Specify the time as HH:MM, for example 21:00.",
+	"digest.invalid_timezone": "Specify the time zone like Asia/Tokyo.",
+	"digest.save_failed":      "Failed to save the digest settings.",
+	"digest.enabled":          "A digest will be sent every day at %s (%s).",
+	"digest.digest_only":      "Online notifications will not be sent.",
+	"digest.disabled":         "The daily digest has been stopped.",
+
+	// 通知文のテンプレート
+	"template.default":     "{{.DisplayName}} is now online.",
+	"template.save_failed": "Failed to save the template.",
+	"template.set":         "The notification template has been set. Notifications will look like this:\n%s",
+	"template.reset":       "The notification message has been reset to the default.",
+	"template.preview":     "Preview (using sample data)\n%s",
+	"template.too_long":    "The template or the resulting message is too long.",
+	"template.invalid":     "The template is invalid.\n```\n%s\n```",
+
+	// 管理者向けのコマンド
+	"account.disabled":           "This account has been suspended.",
+	"admin.forbidden":            "Only the bot owners can run this command.",
+	"admin.users_failed":         "Failed to load the users.",
+	"admin.user_not_found":       "That user is not registered.",
+	"admin.user_count":           "Users: %d",
+	"admin.status.active":        "Active",
+	"admin.status.expired":       "Login expired",
+	"admin.status.no_target":     "No watched friends",
+	"admin.status.not_logged_in": "Not logged in",
+	"admin.status.unreachable":   "Unreachable",
+	"admin.status.disabled":      "Disabled",
+	"admin.field.status":         "Status: %s",
+	"admin.field.locale":         "Language: %s",
+	"admin.field.targets":        "Watched friends: %d %s",
+	"admin.field.notifier":       "Destination: %s",
+	"admin.field.digest":         "Digest: %s",
+	"admin.poll_failed":          "Polling failed.",
+	"admin.polled":               "Polled %s. (Status: %s)",
+	"admin.poll_locked":          "Another polling run is in progress. Please try again later.",
+	"admin.empty_message":        "Specify the announcement text.",
+	"admin.broadcasted":          "Sent the announcement to %d users. (Failed: %d)",
+	"admin.save_failed":          "Failed to save the setting.",
+	"admin.disabled":             "Disabled %s.",
+	"admin.enabled":              "Enabled %s.",
+
+	// 監査ログ
+	"history.header":                    "Activity history (newest first)",
+	"history.empty":                     "There is no activity history yet.",
+	"history.failed":                    "Failed to load the activity history.",
+	"history.invalid_limit":             "Specify a number from 1 to %d.",
+	"history.outcome.ok":                "succeeded",
+	"history.outcome.failed":            "failed",
+	"history.outcome.rejected":          "rejected",
+	"history.action.command":            "Command",
+	"history.action.auth.login":         "Login",
+	"history.action.auth.2fa":           "Two-factor authentication",
+	"history.action.auth.expired":       "Login expired",
+	"history.action.auth.revoked":       "Session revoked",
+	"history.action.join.register":      "Watch friend",
+	"history.action.join.unregister":    "Stop watching friend",
+	"history.action.notify.abandoned":   "Notification abandoned",
+	"history.action.notify.unreachable": "Notification channel unreachable",
+	"history.action.notify.reachable":   "Notifications resumed",
+	"history.action.notify.delivered":   "Notification",
+	"history.action.admin.disable":      "Disabled",
+	"history.action.admin.enable":       "Enabled",
+
+	// 個人データのエクスポートとアカウントの削除
+	"account.not_found":       "You are not registered.",
+	"account.export_failed":   "Failed to export your data.",
+	"account.exported":        "Here is the data we store about you. (Tokens and other secrets are redacted)",
+	"account.export_sent":     "Your data has been sent to your DMs.",
+	"account.delete_confirm":  "This logs you out of VRChat and deletes all the data we store about you (login information, watched friends, settings and history). This cannot be undone. Are you sure?",
+	"account.delete_button":   "Delete",
+	"account.cancel_button":   "Cancel",
+	"account.not_yours":       "Only the user who ran the command can use this button.",
+	"account.delete_canceled": "Account deletion has been canceled.",
+	"account.delete_failed":   "Failed to delete your account.",
+	"account.deleted":         "Your account has been deleted. To use the app again, start over with /auth login.",
+}
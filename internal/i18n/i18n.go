@@ -0,0 +1,78 @@
+// Package i18n はユーザに表示するメッセージの日本語・英語の翻訳を提供する。
+//
+// メッセージはキーで参照し、書式を含むメッセージは fmt.Sprintf と同じ形式で引数を埋め込む。
+// 言語はDiscordのインタラクションの locale から決め、非同期の通知のためにユーザ情報にも保存する。
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// 対応している言語
+const (
+	Japanese = "ja"
+	English  = "en"
+)
+
+// Default は言語が分からない場合に使う言語
+const Default = Japanese
+
+var catalogs = map[string]map[string]string{
+	Japanese: ja,
+	English:  en,
+}
+
+// Normalize はDiscordのロケール（ja、en-US、en-GB など）を対応している言語に変換する。
+// 空の場合は Default を、日本語以外の場合は英語を返す。
+func Normalize(locale string) string {
+	switch {
+	case locale == "":
+		return Default
+	case strings.HasPrefix(locale, Japanese):
+		return Japanese
+	}
+	return English
+}
+
+type contextKey struct{}
+
+// NewContext は言語を設定したコンテキストを返す。
+func NewContext(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, Normalize(locale))
+}
+
+// FromContext はコンテキストに設定された言語を返す。設定されていない場合は Default を返す。
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok {
+		return locale
+	}
+	return Default
+}
+
+// T はコンテキストに設定された言語でメッセージを返す。
+func T(ctx context.Context, key string, args ...any) string {
+	return Message(FromContext(ctx), key, args...)
+}
+
+// Message は指定した言語でメッセージを返す。
+// 翻訳がない場合は Default の言語のメッセージを、それもない場合はキーをそのまま返す。
+func Message(locale, key string, args ...any) string {
+	msg, ok := Lookup(Normalize(locale), key)
+	if !ok {
+		if msg, ok = Lookup(Default, key); !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Lookup は指定した言語のメッセージを書式を埋め込まずに返す。
+func Lookup(locale, key string) (string, bool) {
+	msg, ok := catalogs[locale][key]
+	return msg, ok
+}
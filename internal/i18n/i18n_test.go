@@ -0,0 +1,105 @@
+package i18n
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var verbPattern = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// 全ての言語に同じキーがあり、書式の引数が一致していることを確認する
+func TestCatalogs(t *testing.T) {
+	for key, msg := range catalogs[Default] {
+		want := verbPattern.FindAllString(msg, -1)
+		for locale, catalog := range catalogs {
+			got, ok := catalog[key]
+			if !ok {
+				t.Errorf("%s: missing key %q", locale, key)
+				continue
+			}
+			if verbs := verbPattern.FindAllString(got, -1); !slices.Equal(verbs, want) {
+				t.Errorf("%s: %q has verbs %v, want %v", locale, key, verbs, want)
+			}
+		}
+	}
+	for locale, catalog := range catalogs {
+		for key := range catalog {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s: unknown key %q", locale, key)
+			}
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"":      Japanese,
+		"ja":    Japanese,
+		"en-US": English,
+		"en-GB": English,
+		"ko":    English,
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	ctx := context.Background()
+	if got := T(ctx, "auth.relogin"); got != "再ログインしてください。" {
+		t.Errorf("T() without locale = %q", got)
+	}
+
+	ctx = NewContext(ctx, "en-US")
+	if got := T(ctx, "join.limit", 10); got != "You can watch up to 10 friends. Use /join unregister to stop watching someone." {
+		t.Errorf("T() = %q", got)
+	}
+	if got := T(ctx, "unknown.key"); got != "unknown.key" {
+		t.Errorf("T() with unknown key = %q", got)
+	}
+}
+
+func TestLocalizeCommand(t *testing.T) {
+	cmd := LocalizeCommand(&discordgo.ApplicationCommand{
+		Name:        "notify",
+		Description: "通知先の設定",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name: "sink",
+				Type: discordgo.ApplicationCommandOptionSubCommandGroup,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name: "set",
+						Type: discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name: "type",
+								Type: discordgo.ApplicationCommandOptionString,
+								Choices: []*discordgo.ApplicationCommandOptionChoice{
+									{Name: "メール", Value: "email"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	if got := (*cmd.DescriptionLocalizations)[discordgo.EnglishUS]; got != "Notification destination" {
+		t.Errorf("command description = %q", got)
+	}
+	typ := cmd.Options[0].Options[0].Options[0]
+	if got := typ.DescriptionLocalizations[discordgo.EnglishGB]; got != "Destination type" {
+		t.Errorf("option description = %q", got)
+	}
+	if got := typ.Choices[0].NameLocalizations[discordgo.EnglishUS]; got != "Email" {
+		t.Errorf("choice name = %q", got)
+	}
+}
@@ -0,0 +1,238 @@
+package i18n
+
+var ja = map[string]string{
+	// 共通
+	"ok":                  "OK",
+	"error":               "エラーが発生しました。",
+	"unsupported_command": "未対応のコマンドです。",
+	"not_implemented":     "未実装",
+	"user_info_failed":    "ユーザ情報の取得に失敗しました。",
+	"world":               "ワールド: %s",
+	"error_id":            "（エラーID: %s）",
+
+	// インストール時の案内
+	"onboarding.user": `
+アプリのインストールが完了しました。
+指定したフレンドが「だれでもおいで」ステータスになったとき通知を受け取れるアプリです。
+操作は基本的にスラッシュコマンドを用います。
+スラッシュコマンドは画面下のゲームパッドボタンから実行できます。
+スラッシュコマンド一覧
+- /auth login		ログイン
+- /auth logout		ログアウト
+- /auth email-code	2段階認証
+- /join register	通知登録
+- /join unregister	通知登録の解除
+- /join list		通知登録したフレンドの一覧
+- /join gathering	複数のフレンドが集まったときの通知
+- /notify channel set	通知先をサーバーのチャンネルに設定（サーバーにインストールした場合）
+- /notify sink set	通知の送信先をSlack・Webhook・メールに変更
+- /stats summary	通知対象のフレンドのオンライン状況の統計
+- /stats heatmap	曜日・時間帯ごとのオンライン率のヒートマップ
+- /export calendar	オンライン履歴をカレンダー（.ics）形式で出力
+- /digest enable	1日1回のまとめ通知（ダイジェスト）を受け取る
+- /settings template set	通知文をテンプレートで変更
+- /history		操作履歴
+- /account export	保存しているデータのエクスポート
+- /account delete	アカウントの削除
+
+使い方
+1. ユーザ名とパスワードを指定してログインコマンドを実行してください。
+2. 「メールに認証コードが送信されました。」と表示された場合は、メールに届いた番号を指定して2段階認証コマンドを実行してください。
+3. 通知を受け取りたいフレンドのVRChatのWEBページのURL、ユーザID、または表示名を指定して、通知登録コマンドを実行してください。
+4. 指定したフレンドが「だれでもおいで」ステータスになったとき通知が届きます。
+
+備考
+- 「再ログインしてください。」とメッセージが届いた場合、ログインコマンドを再実行してください。
+- 通知対象のフレンドは%d人まで登録できます。
+- 他のフレンドの通知を受け取りたい場合、通知登録コマンドを再実行してください。
+- フレンドのVRChatのWEBページのURLは次のようなものです。（https://vrchat.com/home/user/XXXXXX）
+- 通知登録コマンドでは、表示名を入力するとフレンドの候補が表示されます。
+- 英語で表示する場合は、Discordの言語設定を English にしてコマンドを実行してください。
+`,
+	"onboarding.guild": `
+サーバーへのインストールが完了しました。
+サーバーのテキストチャンネルで通知を受け取る場合は、サーバー内で次のコマンドを実行してください。
+- /notify channel set	通知先チャンネルの設定（メンションするロールも指定できます）
+- /notify channel clear	通知先をDMに戻す
+
+備考
+- 通知先チャンネルの設定には「チャンネルの管理」権限が必要です。
+- ログインと通知登録はこれまで通り /auth login と /join register で行ってください。
+`,
+
+	// 認証
+	"auth.email_code_sent": "メールに認証コードが送信されました。",
+	"auth.logged_in":       "ログインしました。",
+	"auth.relogin":         "再ログインしてください。",
+	"auth.login_failed":    "ログインに失敗しました。ユーザ名とパスワードを確認してください。",
+	"auth.login_error":     "VRChatへのログイン中にエラーが発生しました。時間をおいて再度お試しください。",
+	"auth.code_failed":     "認証コードが正しくないか、有効期限が切れています。",
+	"auth.save_failed":     "ログイン情報の保存に失敗しました。",
+
+	// 通知対象のフレンド
+	"join.invalid_user":       "ユーザを特定できませんでした。ユーザページのURL（https://vrchat.com/home/user/usr_XXXXXX）、ユーザID、表示名のいずれかを指定してください。",
+	"join.login_required":     "先にログインしてください。",
+	"join.friends_failed":     "フレンド一覧の取得に失敗しました。再ログインが必要な可能性があります。",
+	"join.ambiguous_name":     "「%s」という表示名のフレンドが複数います。ユーザページのURLかユーザIDを指定してください。",
+	"join.friend_not_found":   "指定したユーザがフレンド一覧に見つかりませんでした。",
+	"join.already_registered": "%s さんは既に通知対象に登録されています。",
+	"join.limit":              "通知対象に登録できるフレンドは%d人までです。/join unregister で登録を解除してください。",
+	"join.register_failed":    "通知対象の登録に失敗しました。",
+	"join.register_confirm":   "%s さん（%s）を通知対象に登録しますか？",
+	"join.register_button":    "登録する",
+	"join.cancel_button":      "キャンセル",
+	"join.register_canceled":  "通知対象の登録をキャンセルしました。",
+	"join.registered":         "%s さん（%s）を通知対象に登録しました。",
+	"join.unregister_failed":  "通知対象の登録解除に失敗しました。",
+	"join.unregistered":       "%s さんを通知対象から外しました。",
+	"join.empty":              "通知対象のフレンドは登録されていません。",
+	"join.list":               "通知対象のフレンド",
+	"join.list_gathering":     "%d人以上が同じインスタンスに集まったときに通知します。",
+	"join.targets_required":   "先に通知対象のフレンドを登録してください。",
+	"join.unresolved_user":    "ユーザを特定できませんでした。",
+	"join.not_target":         "指定したユーザは通知対象に登録されていません。",
+
+	// フレンドが集まったときの通知
+	"gathering.invalid_min": "人数は2〜%dの範囲で指定してください。（0を指定すると通知しません）",
+	"gathering.save_failed": "設定に失敗しました。",
+	"gathering.disabled":    "フレンドが集まったときの通知を停止しました。",
+	"gathering.enabled":     "通知対象のフレンドが%d人以上同じインスタンスに集まったときに通知します。",
+	"gathering.members":     "%s さんが同じインスタンスに集まっています。",
+	"gathering.separator":   " さん、",
+
+	// 通知先
+	"notify.title":                    "VRChat JOIN通知",
+	"channel.guild_only":              "このコマンドはサーバー内で実行してください。",
+	"channel.permission_required":     "通知先チャンネルの設定には「チャンネルの管理」権限が必要です。",
+	"channel.confirm":                 "このチャンネルにJOIN通知を送信します。",
+	"channel.confirm_mention":         "通知時に %s をメンションします。",
+	"channel.send_failed":             "指定したチャンネルにメッセージを送信できませんでした。Botがチャンネルを閲覧・送信できるか確認してください。",
+	"channel.save_failed":             "通知先チャンネルの設定に失敗しました。",
+	"channel.set":                     "通知先を %s に設定しました。",
+	"channel.clear_failed":            "通知先チャンネルの解除に失敗しました。",
+	"channel.cleared":                 "通知先をDMに戻しました。",
+	"sink.target_required":            "通知先の宛先（URLまたはメールアドレス）を指定してください。",
+	"sink.target_invalid":             "通知先の宛先の形式が正しくありません。",
+	"sink.save_failed":                "通知先の設定に失敗しました。",
+	"sink.webhook_set":                "通知先をWebhookに設定しました。\nリクエストの %s ヘッダには、次の秘密鍵によるボディのHMAC-SHA256署名が含まれます。\n秘密鍵: `%s`",
+	"sink.set":                        "通知先を %s に設定しました。",
+	"sink.reset":                      "通知先をDiscordに戻しました。",
+	"sink.email_unavailable":          "このボットではメールの通知を利用できません。",
+	"sink.email_wait":                 "確認メールを送信したばかりです。%d分後に再度お試しください。",
+	"sink.email_send_failed":          "確認メールの送信に失敗しました。メールアドレスを確認してください。",
+	"sink.email_verification_sent":    "%s に確認コードを送信しました。/notify sink verify でコードを入力すると、通知先がメールに切り替わります。",
+	"sink.email_verification_subject": "VRChat JOIN通知 メールアドレスの確認",
+	"sink.email_verification_body":    "確認コード: %s\n\nDiscordで /notify sink verify を実行し、このコードを入力してください。コードの有効期限は%d分です。\n心当たりがない場合は、このメールを無視してください。",
+	"sink.email_not_pending":          "確認中のメールアドレスはありません。/notify sink set で通知先のメールアドレスを指定してください。",
+	"sink.email_expired":              "確認コードの有効期限が切れたか、入力を失敗した回数が上限に達しました。/notify sink set からやり直してください。",
+	"sink.email_code_mismatch":        "確認コードが一致しません。",
+
+	// 統計
+	"stats.summary":        "%s さんの直近%d週間のオンライン状況",
+	"stats.total":          "合計: %s（1日平均 %s）",
+	"stats.by_weekday":     "曜日ごとの平均",
+	"stats.weekdays":       "日,月,火,水,木,金,土",
+	"stats.windows":        "よくオンラインになる時間帯",
+	"stats.window":         "%d:00〜%d:00",
+	"stats.worlds":         "よく訪れるワールド",
+	"stats.world":          "%d. %s（%d回、%s）",
+	"stats.heatmap":        "%s さんの直近%d週間の曜日・時間帯ごとのオンライン率（上: オンライン、下: だれでもおいで）",
+	"stats.heatmap_failed": "ヒートマップの作成に失敗しました。",
+	"stats.invalid_weeks":  "週数は1〜12の範囲で指定してください。",
+	"stats.history_failed": "履歴の取得に失敗しました。",
+	"stats.no_history":     "まだ履歴がありません。",
+	"duration.minutes":     "%d分",
+	"duration.hours":       "%d時間%d分",
+
+	// カレンダー
+	"calendar.failed":    "カレンダーの作成に失敗しました。",
+	"calendar.exported":  "通知対象のフレンドのオンライン履歴をカレンダー形式で出力しました。",
+	"calendar.subscribe": "カレンダーアプリで次のURLを購読すると、自動で更新されます。（URLは他の人に共有しないでください）\n%s",
+	"calendar.name":      "VRChat フレンドのオンライン履歴",
+	"calendar.event":     "%s オンライン",
+	"calendar.ongoing":   "（オンライン中）",
+	"calendar.status":    "ステータス: %s",
+
+	// ダイジェスト
+	"digest.header":           "ダイジェスト（%s〜%s）",
+	"digest.empty":            "期間内にオンラインになったフレンドはいませんでした。",
+	"digest.online":           "- オンライン: %s（%d回）",
+	"digest.worlds":           "- ワールド: %s",
+	"digest.separator":        "、",
+	"digest.invalid_time":     "時刻は 21:00 のように HH:MM の形式で指定してください。",
+	"digest.invalid_timezone": "タイムゾーンは Asia/Tokyo のように指定してください。",
+	"digest.save_failed":      "ダイジェストの設定に失敗しました。",
+	"digest.enabled":          "毎日 %s（%s）にダイジェストを送信します。",
+	"digest.digest_only":      "オンライン時の通知は送信しません。",
+	"digest.disabled":         "ダイジェストの送信を停止しました。",
+
+	// 通知文のテンプレート
+	"template.default":     "{{.DisplayName}} さんがオンラインになりました。",
+	"template.save_failed": "テンプレートの保存に失敗しました。",
+	"template.set":         "通知文のテンプレートを設定しました。通知は次のように届きます。\n%s",
+	"template.reset":       "通知文を既定に戻しました。",
+	"template.preview":     "プレビュー（サンプルのデータを使用しています）\n%s",
+	"template.too_long":    "テンプレート、または作成される通知文が長すぎます。",
+	"template.invalid":     "テンプレートが正しくありません。\n```\n%s\n```",
+
+	// 管理者向けのコマンド
+	"account.disabled":           "このアカウントは利用を停止されています。",
+	"admin.forbidden":            "このコマンドはボットの管理者のみ実行できます。",
+	"admin.users_failed":         "ユーザ一覧の取得に失敗しました。",
+	"admin.user_not_found":       "指定したユーザは登録されていません。",
+	"admin.user_count":           "ユーザ数: %d人",
+	"admin.status.active":        "通知中",
+	"admin.status.expired":       "ログイン期限切れ",
+	"admin.status.no_target":     "通知対象なし",
+	"admin.status.not_logged_in": "未ログイン",
+	"admin.status.unreachable":   "送信不可",
+	"admin.status.disabled":      "利用停止",
+	"admin.field.status":         "状態: %s",
+	"admin.field.locale":         "言語: %s",
+	"admin.field.targets":        "通知対象: %d人 %s",
+	"admin.field.notifier":       "通知先: %s",
+	"admin.field.digest":         "ダイジェスト: %s",
+	"admin.poll_failed":          "ポーリングに失敗しました。",
+	"admin.polled":               "%s のポーリングを実行しました。（状態: %s）",
+	"admin.poll_locked":          "他のポーリングを実行中です。しばらくしてから再度お試しください。",
+	"admin.empty_message":        "お知らせの本文を指定してください。",
+	"admin.broadcasted":          "お知らせを%d人に送信しました。（失敗: %d人）",
+	"admin.save_failed":          "設定の保存に失敗しました。",
+	"admin.disabled":             "%s の利用を停止しました。",
+	"admin.enabled":              "%s の利用を再開しました。",
+
+	// 監査ログ
+	"history.header":                    "操作履歴（新しい順）",
+	"history.empty":                     "操作履歴はまだありません。",
+	"history.failed":                    "操作履歴の取得に失敗しました。",
+	"history.invalid_limit":             "件数は1〜%dの範囲で指定してください。",
+	"history.outcome.ok":                "成功",
+	"history.outcome.failed":            "失敗",
+	"history.outcome.rejected":          "拒否",
+	"history.action.command":            "コマンド",
+	"history.action.auth.login":         "ログイン",
+	"history.action.auth.2fa":           "2段階認証",
+	"history.action.auth.expired":       "ログイン期限切れ",
+	"history.action.auth.revoked":       "セッションの破棄",
+	"history.action.join.register":      "通知対象の登録",
+	"history.action.join.unregister":    "通知対象の登録解除",
+	"history.action.notify.delivered":   "通知の送信",
+	"history.action.notify.abandoned":   "通知の再送中止",
+	"history.action.notify.unreachable": "通知先に送信不可",
+	"history.action.notify.reachable":   "通知の再開",
+	"history.action.admin.disable":      "利用停止",
+	"history.action.admin.enable":       "利用再開",
+
+	// 個人データのエクスポートとアカウントの削除
+	"account.not_found":       "ユーザ情報が登録されていません。",
+	"account.export_failed":   "データのエクスポートに失敗しました。",
+	"account.exported":        "保存しているあなたのデータです。（トークンなどの秘密の情報は伏せています）",
+	"account.export_sent":     "保存しているデータをDMに送信しました。",
+	"account.delete_confirm":  "VRChatからログアウトし、保存しているあなたのデータ（ログイン情報、通知対象のフレンド、設定、履歴）を全て削除します。元に戻すことはできません。よろしいですか？",
+	"account.delete_button":   "削除する",
+	"account.cancel_button":   "キャンセル",
+	"account.not_yours":       "このボタンはコマンドを実行したユーザのみ操作できます。",
+	"account.delete_canceled": "アカウントの削除をキャンセルしました。",
+	"account.delete_failed":   "アカウントの削除に失敗しました。",
+	"account.deleted":         "アカウントを削除しました。再び利用する場合は /auth login からやり直してください。",
+}
@@ -0,0 +1,116 @@
+// Package ical はiCalendar（RFC 5545）形式のカレンダーを書き出す。
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// ContentType はiCalendarのMIMEタイプ
+const ContentType = "text/calendar; charset=utf-8"
+
+type Calendar struct {
+	// カレンダーアプリに表示されるカレンダー名
+	Name   string
+	Events []Event
+}
+
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+}
+
+// Write はカレンダーをiCalendar形式で書き出す。
+func (c Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	l := &lineWriter{w: bw}
+
+	l.line("BEGIN:VCALENDAR")
+	l.line("VERSION:2.0")
+	l.line("PRODID:-//aopontann//vrc-join-notify//JA")
+	l.line("CALSCALE:GREGORIAN")
+	l.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		l.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+
+	stamp := formatTime(time.Now())
+	for _, e := range c.Events {
+		l.line("BEGIN:VEVENT")
+		l.line("UID:" + escape(e.UID))
+		l.line("DTSTAMP:" + stamp)
+		l.line("DTSTART:" + formatTime(e.Start))
+		l.line("DTEND:" + formatTime(e.End))
+		l.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			l.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			l.line("LOCATION:" + escape(e.Location))
+		}
+		if e.URL != "" {
+			l.line("URL:" + e.URL)
+		}
+		l.line("END:VEVENT")
+	}
+
+	l.line("END:VCALENDAR")
+	if l.err != nil {
+		return l.err
+	}
+	return bw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escape はテキスト値の特殊文字をエスケープする。
+func escape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return r.Replace(s)
+}
+
+// maxLineOctets は折り返しなしで書ける1行の最大のオクテット数
+const maxLineOctets = 75
+
+// lineWriter はCRLFで区切り、75オクテットを超える行を折り返して書き出す。
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (l *lineWriter) line(s string) {
+	if l.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		// マルチバイト文字の途中で折り返さないよう、文字単位で数える
+		if n+size > maxLineOctets {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	b.WriteString("\r\n")
+
+	_, l.err = l.w.WriteString(b.String())
+}
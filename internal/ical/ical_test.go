@@ -0,0 +1,59 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarWrite(t *testing.T) {
+	c := Calendar{
+		Name: "Alice のオンライン履歴",
+		Events: []Event{
+			{
+				UID:         "usr_1-20250106T120000Z@vrc-join-notify",
+				Start:       time.Date(2025, 1, 6, 21, 0, 0, 0, time.FixedZone("JST", 9*60*60)),
+				End:         time.Date(2025, 1, 6, 23, 0, 0, 0, time.FixedZone("JST", 9*60*60)),
+				Summary:     "Alice オンライン",
+				Description: "ステータス: join me\nワールド: wrld_a, wrld_b",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:20250106T120000Z\r\n",
+		"DTEND:20250106T140000Z\r\n",
+		"SUMMARY:Alice オンライン\r\n",
+		`DESCRIPTION:ステータス: join me\nワールド: wrld_a\, wrld_b` + "\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	var buf bytes.Buffer
+	c := Calendar{Events: []Event{{Summary: strings.Repeat("あ", 40)}}}
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line exceeds %d octets: %q", maxLineOctets, line)
+		}
+	}
+	if !strings.Contains(buf.String(), "\r\n あ") {
+		t.Errorf("long line was not folded:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,368 @@
+// Package message はユーザが設定したテンプレートから通知文を作成する。
+//
+// テンプレートは text/template の構文で記述し、次のフィールドを参照できる。
+//
+//	.DisplayName        フレンドの表示名
+//	.UserID             フレンドのユーザID（usr_xxx）
+//	.Status             ステータス（join me、active、ask me、busy）
+//	.StatusDescription  ステータスメッセージ
+//	.World              ワールド名（プライベートなインスタンスなどで分からない場合は空）
+//	.WorldID            ワールドID
+//	.InstanceType       インスタンスの種類（public、friends+、friends、invite+、invite、group、不明な場合は空）
+//	.Platform           プラットフォーム（standalonewindows、android など）
+//	.Time               通知した時刻（time.Time）
+//
+// 使える関数は比較（eq、ne、lt、le、gt、ge）、論理演算（and、or、not）、len、print、printf と、
+// upper、lower、trim、truncate、default、replace、date に限られる。
+// 外部の資源にアクセスしたり処理が終わらなくなったりしないよう、range、template、define、block は使えない。
+// 関数が返す文字列も通知文の上限を超えられず、printf の幅と精度は MaxFormatWidth までに限られる。
+package message
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultTemplate はユーザがテンプレートを設定していない場合のテンプレート
+const DefaultTemplate = `{{.DisplayName}} さんがオンラインになりました。`
+
+// テンプレートの長さと、作成した通知文の長さの上限（Discordのメッセージの上限は2000文字）
+const (
+	MaxTemplateLength = 1000
+	MaxMessageLength  = 2000
+	// printf で指定できる幅と精度の上限
+	MaxFormatWidth = 100
+)
+
+// maxValueBytes は関数が返す文字列の長さの上限（バイト数）
+// 途中の値が大きくなりすぎてメモリを使い果たさないよう、最終的な通知文と同じ上限を設ける
+const maxValueBytes = MaxMessageLength * utf8.UTFMax
+
+// Data はテンプレートから参照できる通知の内容
+type Data struct {
+	DisplayName       string
+	UserID            string
+	Status            string
+	StatusDescription string
+	World             string
+	WorldID           string
+	InstanceType      string
+	Platform          string
+	Time              time.Time
+}
+
+// SampleData はプレビューに使う通知の内容を返す。
+func SampleData(now time.Time) Data {
+	return Data{
+		DisplayName:       "VRChatのフレンド",
+		UserID:            "usr_00000000-0000-0000-0000-000000000000",
+		Status:            "join me",
+		StatusDescription: "だれでもどうぞ",
+		World:             "The Black Cat",
+		WorldID:           "wrld_4cf554b4-430c-4f8f-b53e-1f294eed230b",
+		InstanceType:      "friends+",
+		Platform:          "standalonewindows",
+		Time:              now,
+	}
+}
+
+// ErrTooLong はテンプレート、または作成した通知文が長すぎる場合のエラー
+var ErrTooLong = errors.New("message: too long")
+
+// builtins はテンプレートから使える text/template の組み込み関数
+// print と printf は長さを制限するため funcs で置き換えている
+var builtins = map[string]bool{
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"and": true, "or": true, "not": true,
+	"len": true,
+}
+
+// funcs はテンプレートから使える独自の関数
+// どの関数も、返す文字列が maxValueBytes を超える場合は ErrTooLong を返す
+var funcs = template.FuncMap{
+	"upper": func(s string) (string, error) {
+		return limit(strings.ToUpper(s))
+	},
+	"lower": func(s string) (string, error) {
+		return limit(strings.ToLower(s))
+	},
+	"trim": func(s string) (string, error) {
+		return limit(strings.TrimSpace(s))
+	},
+	// truncate は n 文字を超える部分を … に置き換える
+	"truncate": func(n int, s string) (string, error) {
+		if n < 0 || utf8.RuneCountInString(s) <= n {
+			return limit(s)
+		}
+		return limit(string([]rune(s)[:n]) + "…")
+	},
+	// default は値が空の場合に def を返す
+	"default": func(def string, s string) (string, error) {
+		if s == "" {
+			return limit(def)
+		}
+		return limit(s)
+	},
+	// replace は置き換えた結果の長さを先に求め、上限を超える場合は置き換えない
+	"replace": func(old, new, s string) (string, error) {
+		if old == "" {
+			return "", errors.New("message: replace: old must not be empty")
+		}
+		if n := strings.Count(s, old); len(s)+n*(len(new)-len(old)) > maxValueBytes {
+			return "", ErrTooLong
+		}
+		return limit(strings.ReplaceAll(s, old, new))
+	},
+	// date は時刻を Go のレイアウト（2006-01-02 15:04 など）で整形する
+	"date": func(layout string, t time.Time) (string, error) {
+		return limit(t.Format(layout))
+	},
+	"print": func(args ...any) (string, error) {
+		return limit(fmt.Sprint(args...))
+	},
+	"printf": func(format string, args ...any) (string, error) {
+		if err := checkFormat(format); err != nil {
+			return "", err
+		}
+		return limit(fmt.Sprintf(format, args...))
+	},
+}
+
+// limit は s が maxValueBytes を超える場合に ErrTooLong を返す。
+func limit(s string) (string, error) {
+	if len(s) > maxValueBytes {
+		return "", ErrTooLong
+	}
+	return s, nil
+}
+
+// checkFormat は printf の書式の幅と精度が MaxFormatWidth 以下であることを確認する。
+// 引数で幅や精度を指定する * は、値を確認できないため使えない。
+func checkFormat(format string) error {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		// % の後の数字（幅、精度、引数の番号）とフラグを読み、動詞で終わる
+		for i++; i < len(format); i++ {
+			c := format[i]
+			if c == '*' {
+				return errors.New("message: printf: * is not allowed")
+			}
+			if c >= '0' && c <= '9' {
+				j := i
+				for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+					j++
+				}
+				if n, err := strconv.Atoi(format[i:j]); err != nil || n > MaxFormatWidth {
+					return fmt.Errorf("%w: printf width and precision must be at most %d", ErrTooLong, MaxFormatWidth)
+				}
+				i = j - 1
+				continue
+			}
+			if !strings.ContainsRune("+-# .[]", rune(c)) {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Template は検証済みのテンプレート
+type Template struct {
+	t *template.Template
+}
+
+// Parse はテンプレートを解析し、使えない構文や関数が含まれていないか検証する。
+func Parse(text string) (*Template, error) {
+	if utf8.RuneCountInString(text) > MaxTemplateLength {
+		return nil, ErrTooLong
+	}
+
+	t, err := template.New("message").Option("missingkey=error").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// define で複数のテンプレートを定義することも禁止する
+	if len(t.Templates()) > 1 {
+		return nil, errors.New("message: define is not allowed")
+	}
+	if t.Tree == nil {
+		return nil, errors.New("message: empty template")
+	}
+	if err := validate(t.Tree.Root); err != nil {
+		return nil, err
+	}
+	return &Template{t: t}, nil
+}
+
+// validate は構文木を辿り、許可していない構文や関数が使われていればエラーを返す。
+func validate(node parse.Node) error {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			if err := validate(c); err != nil {
+				return err
+			}
+		}
+	case *parse.TextNode, *parse.CommentNode, *parse.DotNode, *parse.FieldNode, *parse.VariableNode,
+		*parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+		return nil
+	case *parse.ActionNode:
+		return validate(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Cmds {
+			if err := validate(c); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			if err := validate(a); err != nil {
+				return err
+			}
+		}
+	case *parse.IdentifierNode:
+		if !builtins[n.Ident] && funcs[n.Ident] == nil {
+			return fmt.Errorf("message: function %q is not allowed", n.Ident)
+		}
+	case *parse.ChainNode:
+		return validate(n.Node)
+	case *parse.IfNode:
+		return validateBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return validateBranch(&n.BranchNode)
+	default:
+		// range、template、break、continue など
+		return fmt.Errorf("message: %q is not allowed", node.String())
+	}
+	return nil
+}
+
+func validateBranch(b *parse.BranchNode) error {
+	if err := validate(b.Pipe); err != nil {
+		return err
+	}
+	if err := validate(b.List); err != nil {
+		return err
+	}
+	if b.ElseList != nil {
+		return validate(b.ElseList)
+	}
+	return nil
+}
+
+// UsesField はテンプレートが Data のフィールド name（"World" など）を参照しているかを返す。
+// 取得に時間のかかる値を、テンプレートで使う場合のみ用意するために使う。
+func (t *Template) UsesField(name string) bool {
+	return usesField(t.t.Tree.Root, name)
+}
+
+// usesField は構文木を辿り、.name または $.name で始まるフィールドの参照があるかを返す。
+// with の中の . は Data ではないが、多めに判定しても問題ないため区別しない。
+func usesField(node parse.Node, name string) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Nodes {
+			if usesField(c, name) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		return n.Ident[0] == name
+	case *parse.VariableNode:
+		return len(n.Ident) > 1 && n.Ident[0] == "$" && n.Ident[1] == name
+	case *parse.ActionNode:
+		return usesField(n.Pipe, name)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Cmds {
+			if usesField(c, name) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			if usesField(a, name) {
+				return true
+			}
+		}
+	case *parse.ChainNode:
+		return usesField(n.Node, name)
+	case *parse.IfNode:
+		return usesFieldInBranch(&n.BranchNode, name)
+	case *parse.WithNode:
+		return usesFieldInBranch(&n.BranchNode, name)
+	}
+	return false
+}
+
+func usesFieldInBranch(b *parse.BranchNode, name string) bool {
+	return usesField(b.Pipe, name) || usesField(b.List, name) || (b.ElseList != nil && usesField(b.ElseList, name))
+}
+
+// Execute は通知の内容からメッセージを作成する。
+func (t *Template) Execute(data Data) (string, error) {
+	var b bytes.Buffer
+	if err := t.t.Execute(&limitedWriter{w: &b, n: MaxMessageLength * utf8.UTFMax}, data); err != nil {
+		if errors.Is(err, ErrTooLong) {
+			return "", ErrTooLong
+		}
+		return "", err
+	}
+	s := strings.TrimSpace(b.String())
+	if utf8.RuneCountInString(s) > MaxMessageLength {
+		return "", ErrTooLong
+	}
+	if s == "" {
+		return "", errors.New("message: empty message")
+	}
+	return s, nil
+}
+
+// Render は text が空の場合は DefaultTemplate を使い、通知文を作成する。
+func Render(text string, data Data) (string, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	t, err := Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(data)
+}
+
+// limitedWriter は n バイトを超えて書き込もうとした場合に ErrTooLong を返す。
+// printf などで非常に長い文字列を作成された場合に備える。
+type limitedWriter struct {
+	w *bytes.Buffer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		return 0, ErrTooLong
+	}
+	l.n -= len(p)
+	return l.w.Write(p)
+}
@@ -0,0 +1,118 @@
+package message
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	data := SampleData(time.Date(2024, 5, 1, 21, 30, 0, 0, time.UTC))
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "default", text: "", want: "VRChatのフレンド さんがオンラインになりました。"},
+		{name: "fields", text: "{{.DisplayName}} が {{.World}}（{{.InstanceType}}）にいます", want: "VRChatのフレンド が The Black Cat（friends+）にいます"},
+		{name: "if", text: `{{if eq .Status "join me"}}参加できます{{else}}参加できません{{end}}`, want: "参加できます"},
+		{name: "with", text: `{{with .StatusDescription}}「{{.}}」{{end}}`, want: "「だれでもどうぞ」"},
+		{name: "default func", text: `{{.WorldID | printf "%.4s"}} {{"" | default "不明"}}`, want: "wrld 不明"},
+		{name: "upper", text: "{{upper .Platform}}", want: "STANDALONEWINDOWS"},
+		{name: "truncate", text: "{{truncate 3 .DisplayName}}", want: "VRC…"},
+		{name: "replace", text: `{{replace "+" "プラス" .InstanceType}}`, want: "friendsプラス"},
+		{name: "date", text: `{{date "15:04" .Time}}`, want: "21:30"},
+		{name: "variable", text: `{{$n := .DisplayName}}{{$n}}`, want: "VRChatのフレンド"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.text, data)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "syntax", text: "{{.DisplayName"},
+		{name: "range", text: "{{range .DisplayName}}{{end}}"},
+		{name: "define", text: `{{define "x"}}a{{end}}`},
+		{name: "template", text: `{{template "message" .}}`},
+		{name: "unknown func", text: "{{call .DisplayName}}"},
+		{name: "too long", text: strings.Repeat("あ", MaxTemplateLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.text); err == nil {
+				t.Errorf("Parse(%q) error = nil", tt.text)
+			}
+		})
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	data := SampleData(time.Now())
+
+	// 存在しないフィールドは実行時にエラーになる
+	if _, err := Render("{{.Token}}", data); err == nil {
+		t.Error("Render() with unknown field error = nil")
+	}
+	// 空のメッセージは送信できない
+	if _, err := Render("{{if false}}x{{end}}", data); err == nil {
+		t.Error("Render() with empty message error = nil")
+	}
+	// 長すぎるメッセージ
+	if _, err := Render(`{{printf "%03000d" 1}}`, data); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Render() with long message error = %v, want ErrTooLong", err)
+	}
+	// 関数の途中の結果も通知文の上限を超えられない
+	if _, err := Render(`{{replace "" "xxxxxxxxxx" (replace "" "xxxxxxxxxx" (replace "" "xxxxxxxxxx" (printf "%01000000d" 1)))}}`, data); err == nil {
+		t.Error("Render() with nested replace error = nil")
+	}
+	if _, err := Render(`{{replace "x" "xxxxxxxxxx" (replace "x" "xxxxxxxxxx" (replace "x" "xxxxxxxxxx" (printf "%0100d" 0 | replace "0" "x")))}}`, data); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Render() with growing replace error = %v, want ErrTooLong", err)
+	}
+	// 空文字列の置き換えと、引数で指定する幅は使えない
+	if _, err := Render(`{{replace "" "x" .DisplayName}}`, data); err == nil {
+		t.Error("Render() with empty old error = nil")
+	}
+	if _, err := Render(`{{printf "%*d" 100000 1}}`, data); err == nil {
+		t.Error("Render() with * width error = nil")
+	}
+}
+
+func TestUsesField(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "{{.World}}", want: true},
+		{text: "{{.WorldID}}", want: false},
+		{text: "World: {{.DisplayName}}", want: false},
+		{text: `{{if .WorldID}}{{.World | default "不明"}}{{end}}`, want: true},
+		{text: `{{if eq .Status "join me"}}{{else}}{{upper .World}}{{end}}`, want: true},
+		{text: `{{with .StatusDescription}}{{$.World}}{{end}}`, want: true},
+		{text: `{{with .World}}{{.}}{{end}}`, want: true},
+		{text: `{{printf "%s" (.World)}}`, want: true},
+		{text: `{{/* .World */}}{{.DisplayName}}`, want: false},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(tt.text)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.text, err)
+		}
+		if got := tmpl.UsesField("World"); got != tt.want {
+			t.Errorf("UsesField(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package metrics はPrometheusで収集するメトリクスを定義する。
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vrc_join_notify"
+
+var (
+	// VRChat APIの呼び出し回数（endpoint: 呼び出したAPI、status: HTTPステータスコード、通信エラーの場合は error）
+	VRCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vrc_api_requests_total",
+		Help:      "Number of VRChat API requests by endpoint and status.",
+	}, []string{"endpoint", "status"})
+
+	// VRChat APIの応答時間
+	VRCRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "vrc_api_request_duration_seconds",
+		Help:      "Latency of VRChat API requests by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	// 通知処理1回あたりの処理時間
+	PollDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "poll_duration_seconds",
+		Help:      "Duration of a full notification polling run.",
+		Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	})
+
+	// 通知処理の実行回数（result: completed, failed, locked）
+	// locked は他の実行がロックを持っていたため実行しなかった回数
+	PollRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "poll_runs_total",
+		Help:      "Number of notification polling runs by result.",
+	}, []string{"result"})
+
+	// 通知処理で処理したユーザ数（result: processed, skipped）
+	PollUsers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "poll_users_total",
+		Help:      "Number of users processed or skipped by the notification poller.",
+	}, []string{"result"})
+
+	// 送信した通知の数（kind: 通知の種類、result: sent, failed）
+	Notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Number of notifications by kind and result.",
+	}, []string{"kind", "result"})
+
+	// 実行されたスラッシュコマンドの数（command: コマンド名、outcome: ok, error）
+	SlashCommands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slash_commands_total",
+		Help:      "Number of slash commands by name and outcome.",
+	}, []string{"command", "outcome"})
+
+	// 再送を諦めた通知の数
+	NotificationsAbandoned = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_abandoned_total",
+		Help:      "Number of notifications given up after retries or because the channel is unreachable.",
+	})
+
+	// 無効になっていた認証トークンの数
+	TokenInvalid = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vrc_token_invalid_total",
+		Help:      "Number of VRChat auth tokens found to be invalid while polling.",
+	})
+)
+
+// Handler は /metrics のエンドポイントのハンドラを返す。
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve は ctx がキャンセルされるまで addr で /metrics を公開する。
+// 公開しているエンドポイントとは別のアドレスで待ち受けるために使う。
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NotificationResult は通知の成否を Notifications の result ラベルの値に変換する。
+func NotificationResult(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "sent"
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotificationResult(t *testing.T) {
+	if got := NotificationResult(nil); got != "sent" {
+		t.Errorf("NotificationResult(nil) = %q, want sent", got)
+	}
+	if got := NotificationResult(errors.New("boom")); got != "failed" {
+		t.Errorf("NotificationResult(err) = %q, want failed", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	VRCRequests.WithLabelValues("friends", "200").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := io.ReadAll(rec.Body)
+	want := `vrc_join_notify_vrc_api_requests_total{endpoint="friends",status="200"} 1`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("metrics output does not contain %q", want)
+	}
+}
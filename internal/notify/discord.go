@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ErrUnreachable は通知先のチャンネルに恒久的に送信できないことを表す
+// ユーザがBotをブロックした、チャンネルが削除された、Botがチャンネルにアクセスできなくなった場合など
+var ErrUnreachable = errors.New("notify: channel is unreachable")
+
+// unreachableCodes は再送しても成功しないDiscordのエラーコード
+var unreachableCodes = []int{
+	discordgo.ErrCodeUnknownChannel,
+	discordgo.ErrCodeMissingAccess,
+	discordgo.ErrCodeCannotSendMessagesToThisUser,
+	discordgo.ErrCodeMissingPermissions,
+}
+
+// Discord はDiscordのチャンネル（DMまたはサーバーのテキストチャンネル）に通知する。
+type Discord struct {
+	Session   *discordgo.Session
+	ChannelID string
+	RoleID    string // 通知時にメンションするロール（空の場合はメンションしない）
+}
+
+func (d *Discord) Notify(ctx context.Context, e Event) error {
+	m := &discordgo.MessageSend{
+		Content:         e.Message,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if d.RoleID != "" {
+		m.Content = "<@&" + d.RoleID + "> " + e.Message
+		m.AllowedMentions.Roles = []string{d.RoleID}
+	}
+	_, err := d.Session.ChannelMessageSendComplex(d.ChannelID, m, discordgo.WithContext(ctx))
+	if unreachable(err) {
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+	return err
+}
+
+// unreachable はDiscordのエラーが、再送しても成功しない恒久的なエラーかどうかを返す。
+func unreachable(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Message == nil {
+		return false
+	}
+	return slices.Contains(unreachableCodes, restErr.Message.Code)
+}
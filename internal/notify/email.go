@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpTimeout はSMTPサーバーへの接続から送信を終えるまでの時間の上限
+// 応答しないサーバーがあっても、他のユーザの通知処理が止まらないようにする
+const smtpTimeout = 30 * time.Second
+
+// SMTPServer はメールの送信に使うSMTPサーバーの設定
+type SMTPServer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Enabled はSMTPサーバーが設定されているかどうかを返す。
+func (s SMTPServer) Enabled() bool {
+	return s.Host != ""
+}
+
+// Email はSMTPサーバー経由でメールで通知する。
+type Email struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	To       string
+	// 送信を終えるまでの時間の上限（0の場合は smtpTimeout）
+	Timeout time.Duration
+}
+
+// NewEmail は server のSMTPサーバーを使って、to 宛てに通知する Email を作成する。
+func NewEmail(server SMTPServer, to string) *Email {
+	return &Email{
+		Addr:     net.JoinHostPort(server.Host, server.Port),
+		Username: server.Username,
+		Password: server.Password,
+		From:     server.From,
+		To:       to,
+	}
+}
+
+// Notify は smtp.SendMail と同様に送信するが、接続と全ての応答に期限を設け、ctx がキャンセルされた場合も中断する。
+func (m *Email) Notify(ctx context.Context, e Event) error {
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = smtpTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(m.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.message(e)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (m *Email) message(e Event) []byte {
+	subject := e.Title
+	if subject == "" {
+		subject = "VRChat JOIN通知"
+	}
+	if e.DisplayName != "" {
+		subject += ": " + e.DisplayName
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(e.Message, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
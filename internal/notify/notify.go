@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Notifier はJOIN通知の送信先
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// 通知先の種類
+const (
+	KindDiscord = "discord"
+	KindSlack   = "slack"
+	KindWebhook = "webhook"
+	KindEmail   = "email"
+)
+
+// 通知イベントの種類
+const (
+	EventJoinMe    = "join_me"   // フレンドが「だれでもおいで」ステータスになった
+	EventGathering = "gathering" // 複数のフレンドが同じインスタンスに集まった
+	// VRChatのトークンが無効になり、再ログインが必要になった（通知先の設定に関わらずBotとのDMに送る）
+	EventReauthRequired = "reauth_required"
+)
+
+// Event は通知先に渡す通知内容
+// Webhook ではこの構造体がそのままJSONとして送信される
+type Event struct {
+	Type              string    `json:"type"`
+	DiscordID         string    `json:"discord_id"`
+	TargetUserID      string    `json:"target_user_id"`
+	DisplayName       string    `json:"display_name"`
+	State             string    `json:"state"`
+	Status            string    `json:"status"`
+	StatusDescription string    `json:"status_description"`
+	Location          string    `json:"location"`
+	Platform          string    `json:"platform"`
+	Members           []string  `json:"members,omitempty"` // 集まっているフレンドの表示名
+	Title             string    `json:"title,omitempty"`   // メールの件名などに使う通知の見出し
+	Message           string    `json:"message"`           // 人が読むための通知文
+	Time              time.Time `json:"time"`
+}
+
+// ValidateTarget は通知先の種類ごとに宛先の形式を確認する。
+func ValidateTarget(kind string, target string) error {
+	switch kind {
+	case KindDiscord:
+		return nil
+	case KindSlack:
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme != "https" || u.Host != "hooks.slack.com" {
+			return fmt.Errorf("invalid slack webhook url: %q", target)
+		}
+		return nil
+	case KindWebhook:
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			return fmt.Errorf("invalid webhook url: %q", target)
+		}
+		// 名前解決が必要なホストは送信のたびに PublicClient で確認する
+		if strings.EqualFold(u.Hostname(), "localhost") {
+			return fmt.Errorf("%w: %q", ErrNonPublicAddress, target)
+		}
+		if a, err := netip.ParseAddr(u.Hostname()); err == nil && !IsPublicAddr(a) {
+			return fmt.Errorf("%w: %q", ErrNonPublicAddress, target)
+		}
+		return nil
+	case KindEmail:
+		addr, err := mail.ParseAddress(target)
+		if err != nil || addr.Address != target {
+			return fmt.Errorf("invalid email address: %q", target)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown notifier kind: %q", kind)
+}
+
+// StatusError は送信先のHTTPサーバーが成功以外のステータスコードを返したことを表す
+type StatusError struct {
+	Kind       string // 通知先の種類（KindSlack、KindWebhook）
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed to post %s webhook, status code: %d", e.Kind, e.StatusCode)
+}
+
+// ErrorClass は送信のエラーを、保存しても秘密の情報を含まない分類に変換する。
+// Slack や Webhook のエラー（*url.Error）はURLをそのまま含むため、エラーの文字列は保存しない
+func ErrorClass(err error) string {
+	var statusErr *StatusError
+	var smtpErr *textproto.Error
+	var restErr *discordgo.RESTError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrUnreachable):
+		return "unreachable"
+	case errors.Is(err, ErrNonPublicAddress):
+		return "non_public_address"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("http_status_%d", statusErr.StatusCode)
+	case errors.As(err, &smtpErr):
+		return fmt.Sprintf("smtp_status_%d", smtpErr.Code)
+	case errors.As(err, &restErr) && restErr.Response != nil:
+		return fmt.Sprintf("http_status_%d", restErr.Response.StatusCode)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "error"
+}
@@ -0,0 +1,338 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var testEvent = Event{
+	Type:         EventJoinMe,
+	DiscordID:    "123",
+	TargetUserID: "usr_33a8da12-14f4-4225-8711-320471ceb60b",
+	DisplayName:  "Alice",
+	State:        "online",
+	Status:       "join me",
+	Message:      "Alice さんがオンラインになりました。",
+	Time:         time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+func TestSlackNotify(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	s := &Slack{Client: srv.Client(), WebhookURL: srv.URL}
+	if err := s.Notify(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != testEvent.Message {
+		t.Fatalf("text = %q, want %q", got["text"], testEvent.Message)
+	}
+}
+
+func TestSlackNotifyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	s := &Slack{Client: srv.Client(), WebhookURL: srv.URL}
+	if err := s.Notify(context.Background(), testEvent); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestWebhookNotify(t *testing.T) {
+	const secret = "s3cret"
+
+	var got Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !VerifySignature(secret, body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("invalid signature: %s", r.Header.Get(SignatureHeader))
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	wh := &Webhook{Client: srv.Client(), URL: srv.URL, Secret: secret}
+	if err := wh.Notify(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, testEvent) {
+		t.Fatalf("event = %+v, want %+v", got, testEvent)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"type":"join_me"}`)
+	sig := "sha256=" + Sign("a", body)
+	if !VerifySignature("a", body, sig) {
+		t.Fatal("expected valid signature")
+	}
+	if VerifySignature("b", body, sig) {
+		t.Fatal("expected invalid signature with another secret")
+	}
+}
+
+// startSMTPServer はメールの受信内容を返すだけの最小限のSMTPサーバーを起動する。
+func startSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), received
+}
+
+func TestEmailNotify(t *testing.T) {
+	addr, received := startSMTPServer(t)
+
+	m := &Email{Addr: addr, From: "bot@example.com", To: "user@example.com"}
+	if err := m.Notify(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "To: user@example.com") {
+			t.Errorf("missing To header: %s", data)
+		}
+		if !strings.Contains(data, testEvent.Message) {
+			t.Errorf("missing message: %s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for mail")
+	}
+}
+
+func TestEmailNotifyTimeout(t *testing.T) {
+	// 接続を受け付けるが応答しないSMTPサーバー
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	m := &Email{Addr: ln.Addr().String(), From: "bot@example.com", To: "user@example.com", Timeout: 100 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- m.Notify(context.Background(), testEvent) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify() did not time out")
+	}
+}
+
+func TestValidateTarget(t *testing.T) {
+	tests := []struct {
+		kind   string
+		target string
+		ok     bool
+	}{
+		{KindDiscord, "", true},
+		{KindSlack, "https://hooks.slack.com/services/T000/B000/XXXX", true},
+		{KindSlack, "https://example.com/services/T000", false},
+		{KindWebhook, "https://example.com/hook", true},
+		{KindWebhook, "http://example.com/hook", false},
+		{KindWebhook, "https://localhost/hook", false},
+		{KindWebhook, "https://127.0.0.1:8080/hook", false},
+		{KindWebhook, "https://169.254.169.254/computeMetadata/v1/", false},
+		{KindWebhook, "https://10.0.0.1/hook", false},
+		{KindWebhook, "https://[::1]/hook", false},
+		{KindWebhook, "https://93.184.215.14/hook", true},
+		{KindEmail, "user@example.com", true},
+		{KindEmail, "User <user@example.com>", false},
+		{"sms", "000", false},
+	}
+	for _, tt := range tests {
+		err := ValidateTarget(tt.kind, tt.target)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateTarget(%q, %q) = %v, want ok=%v", tt.kind, tt.target, err, tt.ok)
+		}
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.1.2.3", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookNotifyNonPublic(t *testing.T) {
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	// テスト用のサーバーはループバックアドレスで待ち受けるため、送信を拒否する
+	err := NewWebhook(srv.URL, "secret").Notify(context.Background(), testEvent)
+	if !errors.Is(err, ErrNonPublicAddress) {
+		t.Fatalf("Notify() error = %v, want %v", err, ErrNonPublicAddress)
+	}
+	if called {
+		t.Fatal("request reached a loopback address")
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	secretURL := "https://hooks.slack.com/services/T000/B000/secret"
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"status", &StatusError{Kind: KindSlack, StatusCode: http.StatusForbidden}, "http_status_403"},
+		{"wrapped status", fmt.Errorf("send: %w", &StatusError{Kind: KindWebhook, StatusCode: 500}), "http_status_500"},
+		{"unreachable", fmt.Errorf("%w: blocked", ErrUnreachable), "unreachable"},
+		{"non public", &url.Error{Op: "Post", URL: secretURL, Err: ErrNonPublicAddress}, "non_public_address"},
+		{"deadline", &url.Error{Op: "Post", URL: secretURL, Err: context.DeadlineExceeded}, "timeout"},
+		{"network", &url.Error{Op: "Post", URL: secretURL, Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, "network"},
+		{"smtp", &textproto.Error{Code: 550, Msg: "mailbox unavailable"}, "smtp_status_550"},
+		{"discord", &discordgo.RESTError{Response: &http.Response{StatusCode: 502}}, "http_status_502"},
+		{"other", errors.New(secretURL), "error"},
+	}
+	for _, tt := range tests {
+		got := ErrorClass(tt.err)
+		if got != tt.want {
+			t.Errorf("%s: ErrorClass() = %q, want %q", tt.name, got, tt.want)
+		}
+		if strings.Contains(got, "secret") {
+			t.Errorf("%s: ErrorClass() = %q contains the webhook url", tt.name, got)
+		}
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	restErr := func(code int) error {
+		return &discordgo.RESTError{Message: &discordgo.APIErrorMessage{Code: code}}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"blocked", restErr(discordgo.ErrCodeCannotSendMessagesToThisUser), true},
+		{"unknown channel", restErr(discordgo.ErrCodeUnknownChannel), true},
+		{"wrapped", fmt.Errorf("send: %w", restErr(discordgo.ErrCodeMissingAccess)), true},
+		{"rate limited", restErr(0), false},
+		{"no message", &discordgo.RESTError{}, false},
+		{"other", errors.New("timeout"), false},
+	}
+	for _, tt := range tests {
+		if got := unreachable(tt.err); got != tt.want {
+			t.Errorf("%s: unreachable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Slack はSlackの Incoming Webhook に通知する。
+// NewSlack で作成した場合は PublicClient を使い、応答しない場合も一定時間で諦める。
+type Slack struct {
+	Client     *http.Client
+	WebhookURL string
+}
+
+func NewSlack(webhookURL string) *Slack {
+	return &Slack{Client: PublicClient, WebhookURL: webhookURL}
+}
+
+func (s *Slack) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(map[string]string{"text": e.Message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Kind: KindSlack, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
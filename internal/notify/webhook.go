@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress は送信先がループバック・プライベート・リンクローカルなどの公開されていないアドレスであることを表す
+var ErrNonPublicAddress = errors.New("notify: destination is not a public address")
+
+// PublicClient は公開されたアドレスにのみ接続するHTTPクライアント
+// ユーザが指定したURLにサーバーの内部のネットワーク（メタデータサーバーなど）へリクエストさせないために使う。
+// 接続のたびに名前解決した結果のアドレスを確認するため、リダイレクトやDNSの応答を変えても内部のアドレスには接続しない
+var PublicClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		// プロキシを経由すると接続先のアドレスを確認できないため、プロキシは使わない
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: dialPublic,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// dialPublic は接続先のアドレスが公開されていない場合にエラーを返す。
+func dialPublic(network string, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, ap.Addr())
+	}
+	return nil
+}
+
+// 公開されていないが、netip.Addr のメソッドでは判定できないアドレスの範囲
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // 「このネットワーク」
+	netip.MustParsePrefix("100.64.0.0/10"),  // キャリアグレードNAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETFプロトコル割り当て
+	netip.MustParsePrefix("198.18.0.0/15"),  // ベンチマーク
+	netip.MustParsePrefix("240.0.0.0/4"),    // 予約済み
+	netip.MustParsePrefix("64:ff9b:1::/48"), // ローカルで使うIPv4/IPv6変換
+	netip.MustParsePrefix("2001:db8::/32"),  // ドキュメント
+}
+
+// IsPublicAddr はインターネットから到達できるユニキャストアドレスかどうかを返す。
+func IsPublicAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	if !a.IsGlobalUnicast() || a.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(a) {
+			return false
+		}
+	}
+	return true
+}
+
+// SignatureHeader はリクエストボディのHMAC-SHA256署名を格納するヘッダ
+// 値は "sha256=" に続けて16進数で表現した署名
+const SignatureHeader = "X-Signature-256"
+
+// Webhook は任意のURLに Event をJSONとしてPOSTする。
+// 受信側は共有した秘密鍵で SignatureHeader を検証することで送信元を確認できる。
+// URLはユーザが指定するため、NewWebhook で作成した場合は公開されたアドレスにのみ送信する。
+type Webhook struct {
+	Client *http.Client
+	URL    string
+	Secret string
+}
+
+func NewWebhook(url string, secret string) *Webhook {
+	return &Webhook{Client: PublicClient, URL: url, Secret: secret}
+}
+
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, body))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{Kind: KindWebhook, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Sign はボディのHMAC-SHA256署名を16進数で返す。
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature は SignatureHeader の値がボディの署名と一致するか確認する。
+func VerifySignature(secret string, body []byte, header string) bool {
+	expected := "sha256=" + Sign(secret, body)
+	return hmac.Equal([]byte(expected), []byte(header))
+}
@@ -0,0 +1,48 @@
+// Package rule は通知を送るかどうかを判定するルールを提供する。
+package rule
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+)
+
+// Gathering は同じインスタンスにいる通知対象のフレンドの集まり
+type Gathering struct {
+	Location string
+	WorldID  string
+	Members  []firestore.Presence
+}
+
+// Gatherings は min 人以上の通知対象のフレンドが同じインスタンスにいる集まりを、人数の多い順に返す。
+// プライベートなインスタンスや移動中などでロケーションが分からないフレンドは対象外とする。
+func Gatherings(presences []firestore.Presence, min int) []Gathering {
+	if min < 2 {
+		return nil
+	}
+
+	byLocation := make(map[string][]firestore.Presence)
+	for _, p := range presences {
+		if p.State != "online" || !strings.HasPrefix(p.Location, "wrld_") {
+			continue
+		}
+		byLocation[p.Location] = append(byLocation[p.Location], p)
+	}
+
+	var gs []Gathering
+	for loc, members := range byLocation {
+		if len(members) < min {
+			continue
+		}
+		sort.Slice(members, func(i, j int) bool { return members[i].DisplayName < members[j].DisplayName })
+		gs = append(gs, Gathering{Location: loc, WorldID: members[0].WorldID, Members: members})
+	}
+	sort.Slice(gs, func(i, j int) bool {
+		if len(gs[i].Members) != len(gs[j].Members) {
+			return len(gs[i].Members) > len(gs[j].Members)
+		}
+		return gs[i].Location < gs[j].Location
+	})
+	return gs
+}
@@ -0,0 +1,41 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+)
+
+func TestGatherings(t *testing.T) {
+	const (
+		instA = "wrld_a:12345~friends(usr_x)"
+		instB = "wrld_a:67890~hidden(usr_y)"
+	)
+	presences := []firestore.Presence{
+		{DisplayName: "Carol", State: "online", WorldID: "wrld_a", Location: instA},
+		{DisplayName: "Alice", State: "online", WorldID: "wrld_a", Location: instA},
+		{DisplayName: "Bob", State: "online", WorldID: "wrld_a", Location: instB},
+		{DisplayName: "Dave", State: "online", Location: "private"},
+		{DisplayName: "Erin", State: "online", Location: "private"},
+		{DisplayName: "Frank", State: "offline", WorldID: "wrld_a", Location: instA},
+	}
+
+	gs := Gatherings(presences, 2)
+	if len(gs) != 1 {
+		t.Fatalf("len = %d, want 1: %+v", len(gs), gs)
+	}
+	g := gs[0]
+	if g.Location != instA || g.WorldID != "wrld_a" {
+		t.Errorf("gathering = %+v", g)
+	}
+	if len(g.Members) != 2 || g.Members[0].DisplayName != "Alice" || g.Members[1].DisplayName != "Carol" {
+		t.Errorf("members = %+v", g.Members)
+	}
+
+	if gs := Gatherings(presences, 3); len(gs) != 0 {
+		t.Errorf("Gatherings(min=3) = %+v, want none", gs)
+	}
+	if gs := Gatherings(presences, 0); gs != nil {
+		t.Errorf("Gatherings(min=0) = %+v, want nil", gs)
+	}
+}
@@ -0,0 +1,31 @@
+package rule
+
+import (
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/notify"
+)
+
+// Settings はユーザが個別に設定していない場合に使う通知ルールの既定値と、通知の送信に使う設定
+type Settings struct {
+	// 通知対象に登録できるフレンドの最大人数
+	// 通知処理では通知対象のフレンドごとにVRChat APIを呼び出すため、上限を設ける
+	MaxWatchTargets int
+	// ダイジェストでタイムゾーンが指定されなかった場合に使うタイムゾーン
+	DefaultTimezone string
+	// 送信に失敗した通知を再送する期間（最初に送信しようとしてからこの期間を過ぎたら諦める）
+	DeliveryRetryWindow time.Duration
+	// 公開しているURL（末尾の / は除く）カレンダーの購読URLに使い、空の場合は購読URLを案内しない
+	PublicBaseURL string
+	// メールの通知に使うSMTPサーバー（設定されていない場合はメールの通知を使えない）
+	SMTP notify.SMTPServer
+}
+
+// DefaultSettings は設定ファイルで指定されなかった場合の既定値を返す。
+func DefaultSettings() Settings {
+	return Settings{
+		MaxWatchTargets:     10,
+		DefaultTimezone:     "Asia/Tokyo",
+		DeliveryRetryWindow: 24 * time.Hour,
+	}
+}
@@ -0,0 +1,122 @@
+// Package sessionfile はパスフレーズで暗号化したファイルに値を保存する。
+// CLIでVRChatのセッション（auth、twoFactorAuth）をローカルに保存するために使う。
+package sessionfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ファイルの形式: magic | salt | nonce | AES-256-GCMで暗号化したJSON
+var magic = []byte("VRCNSESS1")
+
+const (
+	saltSize = 16
+	keySize  = 32
+)
+
+// scryptのパラメータ（2017年時点の推奨値）
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrDecrypt はパスフレーズが異なる、またはファイルが壊れている場合のエラー
+var ErrDecrypt = errors.New("sessionfile: wrong passphrase or corrupted file")
+
+// Save は v をJSONに変換し、passphrase から導出した鍵で暗号化して path に保存する。
+// ファイルは所有者のみが読み書きできる権限で作成する。
+func Save(path string, passphrase []byte, v any) error {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.Write(magic)
+	b.Write(salt)
+	b.Write(nonce)
+	// ヘッダを追加データとして認証し、改ざんを検出する
+	b.Write(aead.Seal(nil, nonce, plain, b.Bytes()))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// 書き込み途中で失敗しても既存のファイルを壊さないよう、一時ファイルに書いてから置き換える
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load は path のファイルを passphrase で復号し、v に格納する。
+// ファイルが存在しない場合は os.ErrNotExist を返す。
+func Load(path string, passphrase []byte, v any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(b, magic) || len(b) < len(magic)+saltSize {
+		return fmt.Errorf("sessionfile: %s is not a session file", path)
+	}
+
+	salt := b[len(magic) : len(magic)+saltSize]
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	headerSize := len(magic) + saltSize + aead.NonceSize()
+	if len(b) < headerSize {
+		return ErrDecrypt
+	}
+
+	plain, err := aead.Open(nil, b[len(magic)+saltSize:headerSize], b[headerSize:], b[:headerSize])
+	if err != nil {
+		return ErrDecrypt
+	}
+	return json.Unmarshal(plain, v)
+}
+
+func newAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
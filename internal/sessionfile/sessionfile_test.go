@@ -0,0 +1,83 @@
+package sessionfile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type session struct {
+	Auth          string `json:"auth"`
+	TwoFactorAuth string `json:"two_factor_auth"`
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "session.enc")
+	want := session{Auth: "authcookie_xxx", TwoFactorAuth: "2fa_xxx"}
+
+	if err := Save(path, []byte("passphrase"), want); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("permission = %o, want 600", perm)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte(want.Auth)) {
+		t.Error("session file contains the plain auth token")
+	}
+
+	var got session
+	if err := Load(path, []byte("passphrase"), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.enc")
+	if err := Save(path, []byte("passphrase"), session{Auth: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var s session
+	if err := Load(path, []byte("wrong"), &s); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong passphrase: err = %v, want ErrDecrypt", err)
+	}
+
+	// 1バイトでも改ざんされていれば復号に失敗する
+	b, _ := os.ReadFile(path)
+	b[len(b)-1] ^= 0xff
+	tampered := filepath.Join(dir, "tampered.enc")
+	if err := os.WriteFile(tampered, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(tampered, []byte("passphrase"), &s); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("tampered: err = %v, want ErrDecrypt", err)
+	}
+
+	plain := filepath.Join(dir, "plain.json")
+	if err := os.WriteFile(plain, []byte(`{"auth":"a"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(plain, []byte("passphrase"), &s); err == nil {
+		t.Error("plain file: expected error")
+	}
+
+	if err := Load(filepath.Join(dir, "missing.enc"), []byte("passphrase"), &s); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing: err = %v, want os.ErrNotExist", err)
+	}
+}
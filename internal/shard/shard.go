@@ -0,0 +1,92 @@
+// Package shard は通知処理の対象のユーザを、DiscordのユーザIDのハッシュで複数のワーカーに分割する。
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Shard は分割した数（Count）と、そのうち担当する番号（Index、0始まり）
+// ゼロ値は分割しない（全てのユーザを担当する）
+type Shard struct {
+	Index int
+	Count int
+}
+
+// Parse は "1/4"（4分割のうち1番）の形式の文字列を読み込む。空文字の場合は分割しない。
+func Parse(s string) (Shard, error) {
+	if s == "" {
+		return Shard{}, nil
+	}
+	index, count, ok := strings.Cut(s, "/")
+	if !ok {
+		return Shard{}, fmt.Errorf("shard %q must be in the form index/count", s)
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return Shard{}, fmt.Errorf("shard %q: %w", s, err)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return Shard{}, fmt.Errorf("shard %q: %w", s, err)
+	}
+	if n < 1 {
+		return Shard{}, fmt.Errorf("shard %q: count must be at least 1", s)
+	}
+	sh := Shard{Index: i, Count: n}
+	if err := sh.Validate(); err != nil {
+		return Shard{}, err
+	}
+	return sh, nil
+}
+
+// Validate は番号が分割した数の範囲にあるかを確認する。
+func (s Shard) Validate() error {
+	if s == (Shard{}) {
+		return nil
+	}
+	if s.Count < 1 || s.Index < 0 || s.Index >= s.Count {
+		return fmt.Errorf("shard %d/%d: index must be between 0 and count-1", s.Index, s.Count)
+	}
+	return nil
+}
+
+// Owns はユーザがこのシャードの担当かどうかを返す。
+func (s Shard) Owns(discordID string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	return Of(discordID, s.Count) == s.Index
+}
+
+// String は "1/4" の形式の文字列を返す。分割しない場合は空文字を返す。
+func (s Shard) String() string {
+	if s.Count <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// UnmarshalText は設定ファイルの "1/4" の形式の文字列を読み込む。
+func (s *Shard) UnmarshalText(b []byte) error {
+	v, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+func (s Shard) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Of はユーザIDを count 個に分割したときの番号を返す。
+// 同じユーザIDは常に同じ番号になるため、ワーカーの間でユーザが重複しない。
+func Of(discordID string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(discordID))
+	return int(h.Sum32() % uint32(count))
+}
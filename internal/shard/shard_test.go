@@ -0,0 +1,76 @@
+package shard
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Shard
+		wantErr bool
+	}{
+		{in: "", want: Shard{}},
+		{in: "0/1", want: Shard{Index: 0, Count: 1}},
+		{in: "3/4", want: Shard{Index: 3, Count: 4}},
+		{in: "4/4", wantErr: true},
+		{in: "-1/4", wantErr: true},
+		{in: "0/0", wantErr: true},
+		{in: "1", wantErr: true},
+		{in: "a/b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOwns(t *testing.T) {
+	const count = 4
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = strconv.Itoa(100000000000000000 + i)
+	}
+
+	// 全てのユーザがちょうど1つのシャードに割り当てられる
+	perShard := make([]int, count)
+	for _, id := range ids {
+		owners := 0
+		for i := 0; i < count; i++ {
+			if (Shard{Index: i, Count: count}).Owns(id) {
+				owners++
+				perShard[i]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("user %s is owned by %d shards, want 1", id, owners)
+		}
+	}
+	// 極端に偏らない
+	for i, n := range perShard {
+		if n < len(ids)/count/2 {
+			t.Errorf("shard %d owns %d users, want about %d", i, n, len(ids)/count)
+		}
+	}
+
+	// 分割しない場合は全てのユーザを担当する
+	if !(Shard{}).Owns(ids[0]) {
+		t.Error("zero Shard does not own a user")
+	}
+}
+
+func TestString(t *testing.T) {
+	if got := (Shard{}).String(); got != "" {
+		t.Errorf("Shard{}.String() = %q, want empty", got)
+	}
+	if got := (Shard{Index: 1, Count: 4}).String(); got != "1/4" {
+		t.Errorf("String() = %q, want 1/4", got)
+	}
+}
@@ -0,0 +1,186 @@
+package stats
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+)
+
+// Heatmap は曜日×時間帯ごとのオンライン率（0〜1）
+// 添字は [time.Weekday][時] でアクセスする
+type Heatmap struct {
+	Online [7][24]float64
+	JoinMe [7][24]float64
+}
+
+// NewHeatmap は [from, to) の期間のプレゼンスの履歴から、曜日×時間帯ごとに
+// オンラインだった割合と「だれでもおいで」だった割合を求める。
+func NewHeatmap(history []firestore.Presence, from, to time.Time, loc *time.Location) Heatmap {
+	var online, joinMe [7][24]time.Duration
+	for _, iv := range Intervals(history, from, to) {
+		for _, part := range splitByHour(iv.Start, iv.End, loc) {
+			d := part.end.Sub(part.start)
+			online[part.start.Weekday()][part.start.Hour()] += d
+			if iv.Status == "join me" {
+				joinMe[part.start.Weekday()][part.start.Hour()] += d
+			}
+		}
+	}
+
+	// 期間内に各曜日が何回あるかで割って割合にする
+	var weekdays [7]int
+	for d := startOfDay(from.In(loc)); d.Before(to); d = d.AddDate(0, 0, 1) {
+		weekdays[d.Weekday()]++
+	}
+
+	var h Heatmap
+	for wd := 0; wd < 7; wd++ {
+		if weekdays[wd] == 0 {
+			continue
+		}
+		total := time.Duration(weekdays[wd]) * time.Hour
+		for hour := 0; hour < 24; hour++ {
+			h.Online[wd][hour] = min(float64(online[wd][hour])/float64(total), 1)
+			h.JoinMe[wd][hour] = min(float64(joinMe[wd][hour])/float64(total), 1)
+		}
+	}
+	return h
+}
+
+const (
+	cellSize    = 20
+	cellGap     = 2
+	labelWidth  = 40 // 曜日ラベルの幅
+	headerSize  = 28 // パネルタイトルの高さ
+	hourLabelH  = 16 // 時間ラベルの高さ
+	imagePad    = 12
+	fontScale   = 2
+	panelHeight = headerSize + hourLabelH + 7*(cellSize+cellGap)
+)
+
+var (
+	background  = color.RGBA{0x2b, 0x2d, 0x31, 0xff} // Discordのダークテーマに合わせた背景色
+	emptyCell   = color.RGBA{0x3a, 0x3c, 0x42, 0xff}
+	textColor   = color.RGBA{0xdb, 0xde, 0xe1, 0xff}
+	onlineColor = color.RGBA{0x43, 0xb5, 0x81, 0xff}
+	joinMeColor = color.RGBA{0x42, 0x8b, 0xf5, 0xff}
+)
+
+// 月曜日から表示する
+var weekdayOrder = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+var weekdayLabels = map[time.Weekday]string{
+	time.Monday: "MON", time.Tuesday: "TUE", time.Wednesday: "WED", time.Thursday: "THU",
+	time.Friday: "FRI", time.Saturday: "SAT", time.Sunday: "SUN",
+}
+
+// Image はオンライン率と「だれでもおいで」率の2つのパネルを縦に並べたヒートマップ画像を返す。
+func (h Heatmap) Image() image.Image {
+	width := imagePad*2 + labelWidth + 24*(cellSize+cellGap)
+	height := imagePad*2 + panelHeight*2 + imagePad
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+
+	drawPanel(img, image.Pt(imagePad, imagePad), "ONLINE", h.Online, onlineColor)
+	drawPanel(img, image.Pt(imagePad, imagePad+panelHeight+imagePad), "JOIN ME", h.JoinMe, joinMeColor)
+	return img
+}
+
+// EncodePNG はヒートマップをPNGとして書き出す。
+func (h Heatmap) EncodePNG(w io.Writer) error {
+	return png.Encode(w, h.Image())
+}
+
+func drawPanel(img *image.RGBA, origin image.Point, title string, values [7][24]float64, c color.RGBA) {
+	drawText(img, origin.X, origin.Y+4, title, textColor)
+
+	gridX := origin.X + labelWidth
+	gridY := origin.Y + headerSize + hourLabelH
+
+	// 3時間ごとに時刻を表示する
+	for hour := 0; hour < 24; hour += 3 {
+		drawText(img, gridX+hour*(cellSize+cellGap), origin.Y+headerSize, itoa(hour), textColor)
+	}
+
+	for row, wd := range weekdayOrder {
+		y := gridY + row*(cellSize+cellGap)
+		drawText(img, origin.X, y+(cellSize-5*fontScale)/2, weekdayLabels[wd], textColor)
+
+		for hour := 0; hour < 24; hour++ {
+			x := gridX + hour*(cellSize+cellGap)
+			cell := image.Rect(x, y, x+cellSize, y+cellSize)
+			draw.Draw(img, cell, &image.Uniform{blend(emptyCell, c, values[wd][hour])}, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// blend は割合 t に応じて from から to に近づけた色を返す。
+func blend(from, to color.RGBA, t float64) color.RGBA {
+	if t <= 0 {
+		return from
+	}
+	// 低い割合でも違いが分かるように、最低でも25%は色を付ける
+	t = 0.25 + 0.75*t
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*t) }
+	return color.RGBA{mix(from.R, to.R), mix(from.G, to.G), mix(from.B, to.B), 0xff}
+}
+
+func itoa(n int) string {
+	if n < 10 {
+		return string(rune('0' + n))
+	}
+	return string(rune('0'+n/10)) + string(rune('0'+n%10))
+}
+
+// glyphs は外部のフォントに依存せずにラベルを描画するための 3x5 のビットマップフォント
+var glyphs = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", "..#", "..#"},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'A': {".#.", "#.#", "###", "#.#", "#.#"},
+	'D': {"##.", "#.#", "#.#", "#.#", "##."},
+	'E': {"###", "#..", "##.", "#..", "###"},
+	'F': {"###", "#..", "##.", "#..", "#.."},
+	'H': {"#.#", "#.#", "###", "#.#", "#.#"},
+	'I': {"###", ".#.", ".#.", ".#.", "###"},
+	'J': {"..#", "..#", "..#", "#.#", "###"},
+	'L': {"#..", "#..", "#..", "#..", "###"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+	'N': {"##.", "#.#", "#.#", "#.#", "#.#"},
+	'O': {"###", "#.#", "#.#", "#.#", "###"},
+	'R': {"##.", "#.#", "##.", "#.#", "#.#"},
+	'S': {"###", "#..", "###", "..#", "###"},
+	'T': {"###", ".#.", ".#.", ".#.", ".#."},
+	'U': {"#.#", "#.#", "#.#", "#.#", "###"},
+	'W': {"#.#", "#.#", "###", "###", "#.#"},
+}
+
+func drawText(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range s {
+		g, ok := glyphs[r]
+		if ok {
+			for gy, line := range g {
+				for gx, px := range line {
+					if px != '#' {
+						continue
+					}
+					dot := image.Rect(x+gx*fontScale, y+gy*fontScale, x+(gx+1)*fontScale, y+(gy+1)*fontScale)
+					draw.Draw(img, dot, &image.Uniform{c}, image.Point{}, draw.Src)
+				}
+			}
+		}
+		// 文字幅3ドット + 字間1ドット（空白も同じ幅）
+		x += 4 * fontScale
+	}
+}
@@ -0,0 +1,49 @@
+package stats
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+)
+
+func TestNewHeatmap(t *testing.T) {
+	history := []firestore.Presence{
+		// 月曜 21:00〜21:30 オンライン、21:30〜22:00 だれでもおいで
+		{State: "online", Status: "active", ObservedAt: at(0, 21, 0)},
+		{State: "online", Status: "join me", ObservedAt: at(0, 21, 30)},
+		{State: "offline", Status: "offline", ObservedAt: at(0, 22, 0)},
+	}
+
+	// 2週間分の期間で集計するため、月曜の21時台は2回ある
+	h := NewHeatmap(history, at(0, 0, 0), at(14, 0, 0), jst)
+
+	if got := h.Online[1][21]; got != 0.5 {
+		t.Errorf("Online[Mon][21] = %v, want 0.5", got)
+	}
+	if got := h.JoinMe[1][21]; got != 0.25 {
+		t.Errorf("JoinMe[Mon][21] = %v, want 0.25", got)
+	}
+	if got := h.Online[1][22]; got != 0 {
+		t.Errorf("Online[Mon][22] = %v, want 0", got)
+	}
+}
+
+func TestHeatmapEncodePNG(t *testing.T) {
+	var h Heatmap
+	h.Online[1][21] = 1
+
+	var buf bytes.Buffer
+	if err := h.EncodePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() == 0 || img.Bounds().Dy() == 0 {
+		t.Fatalf("empty image: %v", img.Bounds())
+	}
+}
@@ -0,0 +1,267 @@
+package stats
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+)
+
+// Interval はフレンドが同じステータス・同じワールドでオンラインだった期間
+type Interval struct {
+	Start   time.Time
+	End     time.Time
+	Status  string
+	WorldID string
+}
+
+// Intervals はプレゼンスの履歴から [from, to) の範囲でオンラインだった期間を返す。
+// history は観測時刻の昇順に並んでいる必要がある。
+// 最後の履歴がオンラインの場合は to までオンラインだったとみなす。
+func Intervals(history []firestore.Presence, from, to time.Time) []Interval {
+	var intervals []Interval
+	for i, p := range history {
+		if p.State != "online" {
+			continue
+		}
+
+		start := p.ObservedAt
+		end := to
+		if i+1 < len(history) {
+			end = history[i+1].ObservedAt
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !start.Before(end) {
+			continue
+		}
+
+		intervals = append(intervals, Interval{Start: start, End: end, Status: p.Status, WorldID: p.WorldID})
+	}
+	return intervals
+}
+
+// WorldStat はワールドごとの滞在時間と訪問回数
+type WorldStat struct {
+	WorldID  string
+	Visits   int
+	Duration time.Duration
+}
+
+// Window はよくオンラインになっている時間帯 [StartHour, EndHour)
+// 日をまたぐ場合、EndHour は24より大きくなる
+type Window struct {
+	StartHour int
+	EndHour   int
+}
+
+type Summary struct {
+	From  time.Time
+	To    time.Time
+	Total time.Duration
+	// 1日あたりの平均オンライン時間
+	DailyAverage time.Duration
+	// 曜日ごとの1日あたりの平均オンライン時間（time.Weekday でアクセスする）
+	ByWeekday [7]time.Duration
+	// 時間帯（0〜23時）ごとの合計オンライン時間
+	ByHour [24]time.Duration
+	// 滞在時間の長い順のワールド
+	Worlds []WorldStat
+	// よくオンラインになっている時間帯
+	Windows []Window
+}
+
+// Summarize は [from, to) の期間のプレゼンスの履歴を集計する。
+// 曜日や時間帯は loc のタイムゾーンで集計する。
+func Summarize(history []firestore.Presence, from, to time.Time, loc *time.Location) Summary {
+	s := Summary{From: from, To: to}
+
+	worlds := make(map[string]*WorldStat)
+	prevWorld := ""
+	var prevEnd time.Time
+	for _, iv := range Intervals(history, from, to) {
+		d := iv.End.Sub(iv.Start)
+		s.Total += d
+
+		for _, part := range splitByHour(iv.Start, iv.End, loc) {
+			s.ByWeekday[part.start.Weekday()] += part.end.Sub(part.start)
+			s.ByHour[part.start.Hour()] += part.end.Sub(part.start)
+		}
+
+		if iv.WorldID == "" {
+			prevWorld = ""
+			continue
+		}
+		w, ok := worlds[iv.WorldID]
+		if !ok {
+			w = &WorldStat{WorldID: iv.WorldID}
+			worlds[iv.WorldID] = w
+		}
+		w.Duration += d
+		// ステータスだけが変わった場合は同じ訪問とみなす
+		if iv.WorldID != prevWorld || !iv.Start.Equal(prevEnd) {
+			w.Visits++
+		}
+		prevWorld = iv.WorldID
+		prevEnd = iv.End
+	}
+
+	// 期間内の日数・曜日ごとの日数で割って平均を求める
+	days := 0
+	var weekdays [7]int
+	for d := startOfDay(from.In(loc)); d.Before(to); d = d.AddDate(0, 0, 1) {
+		days++
+		weekdays[d.Weekday()]++
+	}
+	if days > 0 {
+		s.DailyAverage = s.Total / time.Duration(days)
+	}
+	for i := range s.ByWeekday {
+		if weekdays[i] > 0 {
+			s.ByWeekday[i] /= time.Duration(weekdays[i])
+		}
+	}
+
+	for _, w := range worlds {
+		s.Worlds = append(s.Worlds, *w)
+	}
+	sort.Slice(s.Worlds, func(i, j int) bool {
+		if s.Worlds[i].Duration != s.Worlds[j].Duration {
+			return s.Worlds[i].Duration > s.Worlds[j].Duration
+		}
+		return s.Worlds[i].WorldID < s.Worlds[j].WorldID
+	})
+
+	s.Windows = windows(s.ByHour)
+	return s
+}
+
+// windows は合計オンライン時間が最も長い時間帯の半分以上の時間帯をまとめて返す。
+func windows(byHour [24]time.Duration) []Window {
+	var max time.Duration
+	for _, d := range byHour {
+		if d > max {
+			max = d
+		}
+	}
+	if max == 0 {
+		return nil
+	}
+
+	var ws []Window
+	for h := 0; h < 24; h++ {
+		if byHour[h]*2 < max {
+			continue
+		}
+		if len(ws) > 0 && ws[len(ws)-1].EndHour == h {
+			ws[len(ws)-1].EndHour = h + 1
+			continue
+		}
+		ws = append(ws, Window{StartHour: h, EndHour: h + 1})
+	}
+
+	// 23時台と0時台がどちらも含まれる場合は日をまたぐ1つの時間帯にまとめる
+	if len(ws) > 1 && ws[0].StartHour == 0 && ws[len(ws)-1].EndHour == 24 {
+		ws[len(ws)-1].EndHour = 24 + ws[0].EndHour
+		ws = ws[1:]
+	}
+	return ws
+}
+
+type span struct {
+	start time.Time
+	end   time.Time
+}
+
+// splitByHour は [start, end) を loc のタイムゾーンで1時間ごとの区間に分割する。
+func splitByHour(start, end time.Time, loc *time.Location) []span {
+	var spans []span
+	start = start.In(loc)
+	end = end.In(loc)
+	for start.Before(end) {
+		next := time.Date(start.Year(), start.Month(), start.Day(), start.Hour()+1, 0, 0, 0, loc)
+		if next.After(end) {
+			next = end
+		}
+		spans = append(spans, span{start: start, end: next})
+		start = next
+	}
+	return spans
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Session はフレンドがオンラインになってからオフラインになるまでの一続きの期間
+type Session struct {
+	TargetVRCUserID string
+	DisplayName     string
+	Start           time.Time
+	End             time.Time
+	// 最も長く設定されていたステータス
+	Status string
+	// 訪れたワールド（訪れた順、重複なし）
+	WorldIDs []string
+	// 期間の終わりの時点でまだオンラインの場合は true
+	Ongoing bool
+}
+
+// Sessions は1人のフレンドのプレゼンスの履歴から [from, to) の範囲のセッションを返す。
+// history は観測時刻の昇順に並んでいる必要がある。
+func Sessions(history []firestore.Presence, from, to time.Time) []Session {
+	var sessions []Session
+	var cur *Session
+	statusTime := map[string]time.Duration{}
+
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		var longest time.Duration
+		for status, d := range statusTime {
+			if d > longest || (d == longest && status < cur.Status) {
+				cur.Status = status
+				longest = d
+			}
+		}
+		sessions = append(sessions, *cur)
+		cur = nil
+		statusTime = map[string]time.Duration{}
+	}
+
+	for _, iv := range Intervals(history, from, to) {
+		// 前の期間と連続していなければ新しいセッションとする
+		if cur != nil && !iv.Start.Equal(cur.End) {
+			flush()
+		}
+		if cur == nil {
+			cur = &Session{Start: iv.Start}
+		}
+		cur.End = iv.End
+		statusTime[iv.Status] += iv.End.Sub(iv.Start)
+		if iv.WorldID != "" && !slices.Contains(cur.WorldIDs, iv.WorldID) {
+			cur.WorldIDs = append(cur.WorldIDs, iv.WorldID)
+		}
+	}
+	flush()
+
+	// 対象のフレンドと表示名は最新の履歴のものを使う
+	if len(history) > 0 {
+		last := history[len(history)-1]
+		for i := range sessions {
+			sessions[i].TargetVRCUserID = last.TargetVRCUserID
+			sessions[i].DisplayName = last.DisplayName
+		}
+	}
+	// 最後の履歴がオンラインであれば、最後のセッションは to まで続いている
+	if n := len(sessions); n > 0 && sessions[n-1].End.Equal(to) && history[len(history)-1].State == "online" {
+		sessions[n-1].Ongoing = true
+	}
+	return sessions
+}
@@ -0,0 +1,135 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/firestore"
+)
+
+var jst = time.FixedZone("JST", 9*60*60)
+
+func at(day, hour, min int) time.Time {
+	// 2025/1/6 は月曜日
+	return time.Date(2025, 1, 6+day, hour, min, 0, 0, jst)
+}
+
+func TestIntervals(t *testing.T) {
+	history := []firestore.Presence{
+		{State: "online", Status: "active", WorldID: "wrld_a", ObservedAt: at(0, 20, 0)},
+		{State: "online", Status: "join me", WorldID: "wrld_a", ObservedAt: at(0, 21, 0)},
+		{State: "offline", Status: "offline", ObservedAt: at(0, 22, 30)},
+		{State: "online", Status: "active", WorldID: "wrld_b", ObservedAt: at(1, 23, 0)},
+	}
+
+	got := Intervals(history, at(0, 0, 0), at(2, 0, 0))
+	want := []Interval{
+		{Start: at(0, 20, 0), End: at(0, 21, 0), Status: "active", WorldID: "wrld_a"},
+		{Start: at(0, 21, 0), End: at(0, 22, 30), Status: "join me", WorldID: "wrld_a"},
+		{Start: at(1, 23, 0), End: at(2, 0, 0), Status: "active", WorldID: "wrld_b"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("len = %d, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || !got[i].End.Equal(want[i].End) ||
+			got[i].Status != want[i].Status || got[i].WorldID != want[i].WorldID {
+			t.Errorf("interval[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	history := []firestore.Presence{
+		// 月曜 21:00〜23:00 wrld_a
+		{State: "online", Status: "active", WorldID: "wrld_a", ObservedAt: at(0, 21, 0)},
+		{State: "offline", Status: "offline", ObservedAt: at(0, 23, 0)},
+		// 火曜 21:30〜22:30 wrld_b、22:30〜23:00 wrld_a
+		{State: "online", Status: "join me", WorldID: "wrld_b", ObservedAt: at(1, 21, 30)},
+		{State: "online", Status: "join me", WorldID: "wrld_a", ObservedAt: at(1, 22, 30)},
+		{State: "offline", Status: "offline", ObservedAt: at(1, 23, 0)},
+	}
+
+	s := Summarize(history, at(0, 0, 0), at(7, 0, 0), jst)
+
+	if s.Total != 210*time.Minute {
+		t.Errorf("Total = %v, want 3h30m", s.Total)
+	}
+	if s.DailyAverage != 30*time.Minute {
+		t.Errorf("DailyAverage = %v", s.DailyAverage)
+	}
+	if s.ByWeekday[time.Monday] != 2*time.Hour || s.ByWeekday[time.Tuesday] != 90*time.Minute {
+		t.Errorf("ByWeekday = %v", s.ByWeekday)
+	}
+	if s.ByHour[21] != 90*time.Minute || s.ByHour[22] != 2*time.Hour {
+		t.Errorf("ByHour = %v", s.ByHour)
+	}
+
+	if len(s.Worlds) != 2 || s.Worlds[0].WorldID != "wrld_a" || s.Worlds[0].Visits != 2 || s.Worlds[0].Duration != 150*time.Minute {
+		t.Errorf("Worlds = %+v", s.Worlds)
+	}
+
+	if len(s.Windows) != 1 || s.Windows[0] != (Window{StartHour: 21, EndHour: 23}) {
+		t.Errorf("Windows = %+v", s.Windows)
+	}
+}
+
+func TestSummarizeOnlineBeforeFrom(t *testing.T) {
+	// 期間の開始前（日曜 23:00 JST）からオンラインで、月曜 1:00 JST にオフラインになった
+	history := []firestore.Presence{
+		{State: "online", Status: "active", WorldID: "wrld_a", ObservedAt: at(-1, 23, 0)},
+		{State: "offline", Status: "offline", ObservedAt: at(0, 1, 0)},
+	}
+
+	s := Summarize(history, at(0, 0, 0), at(7, 0, 0), jst)
+	if s.Total != time.Hour || s.ByHour[0] != time.Hour {
+		t.Errorf("Total = %v, ByHour[0] = %v, want 1h", s.Total, s.ByHour[0])
+	}
+
+	// UTCでは日曜 15:00〜16:00 になる
+	s = Summarize(history, at(0, 0, 0), at(7, 0, 0), time.UTC)
+	if s.ByHour[15] != time.Hour || s.ByWeekday[time.Sunday] == 0 {
+		t.Errorf("ByHour[15] = %v, ByWeekday = %v", s.ByHour[15], s.ByWeekday)
+	}
+}
+
+func TestWindowsAcrossMidnight(t *testing.T) {
+	var byHour [24]time.Duration
+	byHour[23] = time.Hour
+	byHour[0] = time.Hour
+	byHour[12] = 10 * time.Minute
+
+	ws := windows(byHour)
+	if len(ws) != 1 || ws[0] != (Window{StartHour: 23, EndHour: 25}) {
+		t.Fatalf("windows = %+v", ws)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	history := []firestore.Presence{
+		{TargetVRCUserID: "usr_1", DisplayName: "Alice", State: "online", Status: "active", WorldID: "wrld_a", ObservedAt: at(0, 20, 0)},
+		{TargetVRCUserID: "usr_1", DisplayName: "Alice", State: "online", Status: "join me", WorldID: "wrld_b", ObservedAt: at(0, 20, 30)},
+		{TargetVRCUserID: "usr_1", DisplayName: "Alice", State: "offline", Status: "offline", ObservedAt: at(0, 22, 0)},
+		{TargetVRCUserID: "usr_1", DisplayName: "Alice", State: "online", Status: "active", WorldID: "wrld_a", ObservedAt: at(1, 23, 0)},
+	}
+
+	got := Sessions(history, at(0, 0, 0), at(2, 0, 0))
+	if len(got) != 2 {
+		t.Fatalf("len = %d, want 2: %+v", len(got), got)
+	}
+
+	s := got[0]
+	if !s.Start.Equal(at(0, 20, 0)) || !s.End.Equal(at(0, 22, 0)) || s.Status != "join me" || s.Ongoing {
+		t.Errorf("session[0] = %+v", s)
+	}
+	if len(s.WorldIDs) != 2 || s.WorldIDs[0] != "wrld_a" || s.WorldIDs[1] != "wrld_b" {
+		t.Errorf("session[0].WorldIDs = %v", s.WorldIDs)
+	}
+	if s.DisplayName != "Alice" || s.TargetVRCUserID != "usr_1" {
+		t.Errorf("session[0] target = %s %s", s.TargetVRCUserID, s.DisplayName)
+	}
+
+	if !got[1].Ongoing || !got[1].End.Equal(at(2, 0, 0)) {
+		t.Errorf("session[1] = %+v", got[1])
+	}
+}
@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cloud Loggingがログとトレースを関連付けるために参照するフィールド
+// https://cloud.google.com/logging/docs/structured-logging
+const (
+	logKeyTrace        = "logging.googleapis.com/trace"
+	logKeySpanID       = "logging.googleapis.com/spanId"
+	logKeyTraceSampled = "logging.googleapis.com/trace_sampled"
+)
+
+// LogHandler はログにトレースコンテキストを付与する slog.Handler。
+// slog.InfoContext などでスパンを含むコンテキストを渡した場合のみ付与される。
+type LogHandler struct {
+	slog.Handler
+	projectID string
+}
+
+// NewLogHandler は h が出力するログにトレースIDとスパンIDを付与する。
+func NewLogHandler(h slog.Handler, projectID string) *LogHandler {
+	return &LogHandler{Handler: h, projectID: projectID}
+}
+
+func (h *LogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String(logKeyTrace, "projects/"+h.projectID+"/traces/"+sc.TraceID().String()),
+			slog.String(logKeySpanID, sc.SpanID().String()),
+			slog.Bool(logKeyTraceSampled, sc.IsSampled()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithAttrs(attrs), projectID: h.projectID}
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithGroup(name), projectID: h.projectID}
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil), "my-project"))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		attrs map[string]any
+	}{
+		{
+			name: "with span",
+			ctx:  ctx,
+			attrs: map[string]any{
+				logKeyTrace:        "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+				logKeySpanID:       "00f067aa0ba902b7",
+				logKeyTraceSampled: true,
+			},
+		},
+		{
+			name: "without span",
+			ctx:  context.Background(),
+			attrs: map[string]any{
+				logKeyTrace:        nil,
+				logKeySpanID:       nil,
+				logKeyTraceSampled: nil,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			logger.With("k", "v").InfoContext(tt.ctx, "hello")
+
+			var got map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got["k"] != "v" {
+				t.Errorf("k = %v, want v", got["k"])
+			}
+			for key, want := range tt.attrs {
+				if got[key] != want {
+					t.Errorf("%s = %v, want %v", key, got[key], want)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package vrc
 import (
 	"net/http"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
 type VRC struct {
@@ -10,6 +12,8 @@ type VRC struct {
 	BaseURL   string
 	UserAgent string
 	Cookies   []*http.Cookie
+	// Limiter が設定されている場合、VRChat APIの呼び出し回数を制限する
+	Limiter *rate.Limiter
 }
 
 type UserInfo struct {
@@ -56,3 +60,36 @@ type UserInfo struct {
 	UserIcon                       string        `json:"userIcon"`
 	WorldID                        string        `json:"worldId"`
 }
+
+type Friend struct {
+	Bio                            string    `json:"bio"`
+	CurrentAvatarImageURL          string    `json:"currentAvatarImageUrl"`
+	CurrentAvatarThumbnailImageURL string    `json:"currentAvatarThumbnailImageUrl"`
+	DeveloperType                  string    `json:"developerType"`
+	DisplayName                    string    `json:"displayName"`
+	FriendKey                      string    `json:"friendKey"`
+	ID                             string    `json:"id"`
+	ImageURL                       string    `json:"imageUrl"`
+	IsFriend                       bool      `json:"isFriend"`
+	LastActivity                   time.Time `json:"last_activity"`
+	LastLogin                      time.Time `json:"last_login"`
+	LastPlatform                   string    `json:"last_platform"`
+	Location                       string    `json:"location"`
+	Platform                       string    `json:"platform"`
+	ProfilePicOverride             string    `json:"profilePicOverride"`
+	Status                         string    `json:"status"`
+	StatusDescription              string    `json:"statusDescription"`
+	Tags                           []string  `json:"tags"`
+	UserIcon                       string    `json:"userIcon"`
+}
+
+type World struct {
+	AuthorID          string `json:"authorId"`
+	AuthorName        string `json:"authorName"`
+	Capacity          int    `json:"capacity"`
+	Description       string `json:"description"`
+	ID                string `json:"id"`
+	ImageURL          string `json:"imageUrl"`
+	Name              string `json:"name"`
+	ThumbnailImageURL string `json:"thumbnailImageUrl"`
+}
@@ -0,0 +1,129 @@
+package vrc
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidUserRef       = errors.New("invalid VRChat user reference")
+	ErrFriendNotFound       = errors.New("friend not found")
+	ErrAmbiguousDisplayName = errors.New("display name matches multiple friends")
+)
+
+var (
+	// usr_xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx 形式のユーザID
+	userIDPattern = regexp.MustCompile(`^usr_[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	// 古いアカウントに割り当てられている10文字の英数字のユーザID
+	legacyUserIDPattern = regexp.MustCompile(`^[0-9A-Za-z]{10}$`)
+)
+
+// UserRef はスラッシュコマンドなどで指定されたVRChatユーザの参照
+// ID と DisplayName のどちらか一方のみが設定される
+type UserRef struct {
+	ID          string
+	DisplayName string
+}
+
+// ParseUserRef はユーザページのURL、ユーザID、表示名のいずれかを解析する。
+// 例:
+//   - https://vrchat.com/home/user/usr_xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+//   - www.vrchat.com/home/user/usr_xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx/?foo=bar
+//   - usr_xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+//   - 表示名
+func ParseUserRef(s string) (UserRef, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return UserRef{}, ErrInvalidUserRef
+	}
+
+	if isVRChatURL(s) {
+		id, err := parseUserURL(s)
+		if err != nil {
+			return UserRef{}, err
+		}
+		return UserRef{ID: id}, nil
+	}
+
+	if hasUserIDPrefix(s) {
+		id := strings.ToLower(s)
+		if !userIDPattern.MatchString(id) {
+			return UserRef{}, ErrInvalidUserRef
+		}
+		return UserRef{ID: id}, nil
+	}
+
+	return UserRef{DisplayName: s}, nil
+}
+
+// hasUserIDPrefix は大文字小文字を区別せずに usr_ で始まるかどうかを返す。
+func hasUserIDPrefix(s string) bool {
+	return len(s) >= 4 && strings.EqualFold(s[:4], "usr_")
+}
+
+func isVRChatURL(s string) bool {
+	s = strings.ToLower(s)
+	s = strings.TrimPrefix(s, "https://")
+	s = strings.TrimPrefix(s, "http://")
+	s = strings.TrimPrefix(s, "www.")
+	return strings.HasPrefix(s, "vrchat.com/")
+}
+
+func parseUserURL(s string) (string, error) {
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", ErrInvalidUserRef
+	}
+
+	// /home/user/usr_xxx/ → [home user usr_xxx]
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) != 3 || segments[0] != "home" || segments[1] != "user" {
+		return "", ErrInvalidUserRef
+	}
+
+	id := segments[2]
+	if hasUserIDPrefix(id) {
+		id = strings.ToLower(id)
+		if !userIDPattern.MatchString(id) {
+			return "", ErrInvalidUserRef
+		}
+		return id, nil
+	}
+	if !legacyUserIDPattern.MatchString(id) {
+		return "", ErrInvalidUserRef
+	}
+	return id, nil
+}
+
+// FindFriend はフレンド一覧から参照に一致するフレンドを探す。
+// 表示名は大文字小文字を区別せずに完全一致で比較する。
+func FindFriend(friends []Friend, ref UserRef) (Friend, error) {
+	if ref.ID != "" {
+		for _, f := range friends {
+			if f.ID == ref.ID {
+				return f, nil
+			}
+		}
+		return Friend{}, ErrFriendNotFound
+	}
+
+	var found []Friend
+	for _, f := range friends {
+		if strings.EqualFold(f.DisplayName, ref.DisplayName) {
+			found = append(found, f)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Friend{}, ErrFriendNotFound
+	case 1:
+		return found[0], nil
+	default:
+		return Friend{}, ErrAmbiguousDisplayName
+	}
+}
@@ -0,0 +1,72 @@
+package vrc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseUserRef(t *testing.T) {
+	const id = "usr_33a8da12-14f4-4225-8711-320471ceb60b"
+
+	tests := []struct {
+		input string
+		want  UserRef
+		err   error
+	}{
+		{input: "https://vrchat.com/home/user/" + id, want: UserRef{ID: id}},
+		{input: "https://www.vrchat.com/home/user/" + id, want: UserRef{ID: id}},
+		{input: "https://vrchat.com/home/user/" + id + "/", want: UserRef{ID: id}},
+		{input: "https://vrchat.com/home/user/" + id + "?tab=info", want: UserRef{ID: id}},
+		{input: "vrchat.com/home/user/" + id, want: UserRef{ID: id}},
+		{input: "https://vrchat.com/home/user/8JoV9XEdpo", want: UserRef{ID: "8JoV9XEdpo"}},
+		{input: "  " + id + "  ", want: UserRef{ID: id}},
+		{input: strings.ToUpper(id), want: UserRef{ID: id}},
+		{input: "Usr_33a8da12-14f4-4225-8711-320471ceb60b", want: UserRef{ID: id}},
+		{input: "https://vrchat.com/home/user/" + strings.ToUpper(id), want: UserRef{ID: id}},
+		{input: "USR_33a8da12", err: ErrInvalidUserRef},
+		{input: "テストユーザ", want: UserRef{DisplayName: "テストユーザ"}},
+		{input: "", err: ErrInvalidUserRef},
+		{input: "https://vrchat.com/home/user/", err: ErrInvalidUserRef},
+		{input: "https://vrchat.com/home/world/wrld_xxx", err: ErrInvalidUserRef},
+		{input: "https://vrchat.com/home/user/usr_invalid", err: ErrInvalidUserRef},
+		{input: "usr_33a8da12", err: ErrInvalidUserRef},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseUserRef(tt.input)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseUserRef(%q) error = %v, want %v", tt.input, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseUserRef(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFindFriend(t *testing.T) {
+	friends := []Friend{
+		{ID: "usr_1", DisplayName: "Alice"},
+		{ID: "usr_2", DisplayName: "Bob"},
+		{ID: "usr_3", DisplayName: "bob"},
+	}
+
+	f, err := FindFriend(friends, UserRef{DisplayName: "alice"})
+	if err != nil || f.ID != "usr_1" {
+		t.Fatalf("FindFriend by display name = %+v, %v", f, err)
+	}
+
+	f, err = FindFriend(friends, UserRef{ID: "usr_2"})
+	if err != nil || f.DisplayName != "Bob" {
+		t.Fatalf("FindFriend by ID = %+v, %v", f, err)
+	}
+
+	if _, err := FindFriend(friends, UserRef{DisplayName: "BOB"}); !errors.Is(err, ErrAmbiguousDisplayName) {
+		t.Fatalf("expected ErrAmbiguousDisplayName, got %v", err)
+	}
+
+	if _, err := FindFriend(friends, UserRef{ID: "usr_4"}); !errors.Is(err, ErrFriendNotFound) {
+		t.Fatalf("expected ErrFriendNotFound, got %v", err)
+	}
+}
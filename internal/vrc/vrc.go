@@ -1,30 +1,48 @@
 package vrc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/aopontann/vrc-join-notify/internal/metrics"
+	"github.com/aopontann/vrc-join-notify/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	// ErrLoginFailed はユーザ名・パスワードが誤っているなどの理由でログインできなかった場合のエラー
+	ErrLoginFailed = errors.New("vrc: login failed")
+	// ErrTwoFactorFailed は2段階認証のコードが誤っているか、有効期限が切れている場合のエラー
+	ErrTwoFactorFailed = errors.New("vrc: two-factor authentication failed")
 )
 
-func NewVRC() *VRC {
+// NewVRC はVRChat APIのクライアントを作成する。
+// VRChat APIはUser-Agentにアプリケーション名と連絡先を含めることを求めている。
+func NewVRC(userAgent string) *VRC {
 	return &VRC{
 		Client:    http.Client{},
 		BaseURL:   "https://api.vrchat.cloud/api/1",
-		UserAgent: os.Getenv("USER_AGENT"),
+		UserAgent: userAgent,
 		Cookies:   nil,
 	}
 }
 
 // VerifyAuthToken は現在提供されている認証トークンが有効かどうかを確認する。
-func (v *VRC) VerifyAuthToken(token string) (bool, error) {
+func (v *VRC) VerifyAuthToken(ctx context.Context, token string) (bool, error) {
 	path := "/auth"
-	req, err := http.NewRequest("GET", v.BaseURL+path, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", v.BaseURL+path, nil)
 	if err != nil {
-		slog.Error("Failed to create request", "error", err)
+		slog.ErrorContext(ctx, "Failed to create request", "error", err)
 		return false, err
 	}
 	req.Header.Add("user-agent", v.UserAgent)
@@ -33,9 +51,9 @@ func (v *VRC) VerifyAuthToken(token string) (bool, error) {
 	req.Header.Add("Cookie", "auth="+token)
 
 	// リクエスト実行
-	resp, err := v.Client.Do(req)
+	resp, err := v.do(req, "auth")
 	if err != nil {
-		slog.Error("Failed to execute request", "error", err)
+		slog.ErrorContext(ctx, "Failed to execute request", "error", err)
 		return false, err
 	}
 	defer resp.Body.Close()
@@ -43,11 +61,11 @@ func (v *VRC) VerifyAuthToken(token string) (bool, error) {
 	return resp.StatusCode == http.StatusOK, nil
 }
 
-func (v *VRC) Login(username, password string) (string, error) {
+func (v *VRC) Login(ctx context.Context, username, password string) (string, error) {
 	path := "/auth/user"
-	req, err := http.NewRequest("GET", v.BaseURL+path, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", v.BaseURL+path, nil)
 	if err != nil {
-		slog.Error("Failed to create request", "error", err)
+		slog.ErrorContext(ctx, "Failed to create request", "error", err)
 		return "", err
 	}
 
@@ -55,85 +73,332 @@ func (v *VRC) Login(username, password string) (string, error) {
 	req.SetBasicAuth(username, password)
 	req.Header.Add("user-agent", v.UserAgent)
 	// リクエスト実行
-	resp, err := v.Client.Do(req)
+	resp, err := v.do(req, "auth_user")
 	if err != nil {
-		slog.Error("Failed to execute request", "error", err)
+		slog.ErrorContext(ctx, "Failed to execute request", "error", err)
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	for _, cookie := range resp.Cookies() {
-		fmt.Println(cookie)
-		slog.Info("Received cookie", "name", cookie.Name, "value", cookie.Value)
+		slog.InfoContext(ctx, "Received cookie", "name", cookie.Name)
 		if cookie.Name == "auth" {
-			slog.Info("Found auth cookie", "value", cookie.Value)
+			slog.InfoContext(ctx, "Found auth cookie", "name", cookie.Name)
 			return cookie.Value, nil
 		}
 	}
 
-	slog.Info("No auth cookie found in response")
-	return "", nil
+	// ユーザ名・パスワードが誤っている場合は auth クッキーが返らない
+	slog.InfoContext(ctx, "No auth cookie found in response", "status", resp.StatusCode)
+	return "", fmt.Errorf("%w: status code %d", ErrLoginFailed, resp.StatusCode)
 }
 
-func (v *VRC) Verify2FA(code string, auth string) (string, error) {
+func (v *VRC) Verify2FA(ctx context.Context, code string, auth string) (string, error) {
 	path := "/auth/twofactorauth/emailotp/verify"
 	bodyStr := `{"code":"` + code + `"}`
 	body := strings.NewReader(bodyStr)
-	req, _ := http.NewRequest("POST", v.BaseURL+path, body)
+	req, _ := http.NewRequestWithContext(ctx, "POST", v.BaseURL+path, body)
 	req.Header.Add("user-agent", v.UserAgent)
 	req.Header.Add("Cookie", "auth="+auth)
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := v.Client.Do(req)
+	resp, err := v.do(req, "2fa_emailotp_verify")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to execute request", "error", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "Failed to verify 2FA", "status", resp.StatusCode)
+		return "", fmt.Errorf("%w: status code %d", ErrTwoFactorFailed, resp.StatusCode)
+	}
+
+	for _, cookie := range resp.Cookies() {
+		slog.InfoContext(ctx, "Received cookie", "name", cookie.Name)
+		if cookie.Name == "twoFactorAuth" {
+			slog.InfoContext(ctx, "Found auth cookie", "name", cookie.Name)
+			return cookie.Value, nil
+		}
+	}
+
+	slog.InfoContext(ctx, "No twoFactorAuth cookie found in response")
+	return "", ErrTwoFactorFailed
+}
+
+// VerifyTOTP は認証アプリのワンタイムパスワードで2段階認証を行い、twoFactorAuth クッキーの値を返す。
+func (v *VRC) VerifyTOTP(ctx context.Context, code string, auth string) (string, error) {
+	path := "/auth/twofactorauth/totp/verify"
+	body, err := json.Marshal(map[string]string{"code": code})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", v.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create request", "error", err)
+		return "", err
+	}
+	req.Header.Add("user-agent", v.UserAgent)
+	req.Header.Add("Cookie", "auth="+auth)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := v.do(req, "2fa_totp_verify")
 	if err != nil {
-		slog.Error("Failed to execute request", "error", err)
+		slog.ErrorContext(ctx, "Failed to execute request", "error", err)
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		slog.Error("Failed to verify 2FA", "status", resp.StatusCode)
-		return "", fmt.Errorf("failed to verify 2FA, status code: %d", resp.StatusCode)
+		slog.ErrorContext(ctx, "Failed to verify TOTP", "status", resp.StatusCode)
+		return "", fmt.Errorf("%w: status code %d", ErrTwoFactorFailed, resp.StatusCode)
 	}
 
 	for _, cookie := range resp.Cookies() {
-		slog.Info("Received cookie", "name", cookie.Name, "value", cookie.Value)
 		if cookie.Name == "twoFactorAuth" {
-			slog.Info("Found auth cookie", "value", cookie.Value)
 			return cookie.Value, nil
 		}
 	}
+	return "", ErrTwoFactorFailed
+}
 
-	slog.Info("No twoFactorAuth cookie found in response")
-	return "", nil
+// RequiredTwoFactorAuth はログイン直後のセッションで必要な2段階認証の方法（emailOtp、totp、otp）を返す。
+// 2段階認証が不要な場合、または完了している場合は空のスライスを返す。
+func (v *VRC) RequiredTwoFactorAuth(ctx context.Context, auth string) ([]string, error) {
+	path := "/auth/user"
+	req, err := http.NewRequestWithContext(ctx, "GET", v.BaseURL+path, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create request", "error", err)
+		return nil, err
+	}
+	req.Header.Add("user-agent", v.UserAgent)
+	req.Header.Add("Cookie", "auth="+auth)
+
+	resp, err := v.do(req, "auth_user")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to execute request", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get current user, status code: %d", resp.StatusCode)
+	}
+
+	var body struct {
+		RequiresTwoFactorAuth []string `json:"requiresTwoFactorAuth"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		slog.ErrorContext(ctx, "Failed to unmarshal current user", "error", err)
+		return nil, err
+	}
+	return body.RequiresTwoFactorAuth, nil
 }
 
-func (v *VRC) GetUserInfo(userID string, auth string, twoFactorAuth string) (UserInfo, error) {
+func (v *VRC) GetUserInfo(ctx context.Context, userID string, auth string, twoFactorAuth string) (UserInfo, error) {
 	path := "/users/" + userID
-	req, _ := http.NewRequest("GET", v.BaseURL+path, nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", v.BaseURL+path, nil)
 	req.Header.Add("user-agent", v.UserAgent)
 	req.Header.Add("Cookie", "auth="+auth+";twoFactorAuth="+twoFactorAuth)
 
-	resp, err := v.Client.Do(req)
+	resp, err := v.do(req, "users")
 	if err != nil {
-		slog.Error("Failed to execute request", "error", err)
+		slog.ErrorContext(ctx, "Failed to execute request", "error", err)
 		return UserInfo{}, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Println(err)
+		slog.ErrorContext(ctx, "Failed to read response body", "error", err)
 		return UserInfo{}, err
 	}
 
-	fmt.Println(string(body))
-
 	var userInfo UserInfo
 	if err := json.Unmarshal(body, &userInfo); err != nil {
-		slog.Error("Failed to unmarshal user info", "error", err)
+		slog.ErrorContext(ctx, "Failed to unmarshal user info", "error", err)
 		return UserInfo{}, err
 	}
 
 	return userInfo, nil
 }
+
+// Logout は認証トークンを無効化し、VRChatのセッションを終了する。
+func (v *VRC) Logout(ctx context.Context, auth string, twoFactorAuth string) error {
+	path := "/logout"
+	req, err := http.NewRequestWithContext(ctx, "PUT", v.BaseURL+path, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create request", "error", err)
+		return err
+	}
+	req.Header.Add("user-agent", v.UserAgent)
+	req.Header.Add("Cookie", "auth="+auth+";twoFactorAuth="+twoFactorAuth)
+
+	resp, err := v.do(req, "logout")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to execute request", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// トークンが既に無効な場合も、セッションは終了しているため成功とみなす
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		slog.ErrorContext(ctx, "Failed to logout", "status", resp.StatusCode)
+		return fmt.Errorf("failed to logout, status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetFriends はオンライン・オフラインを含む全てのフレンドを取得する。
+func (v *VRC) GetFriends(ctx context.Context, auth string, twoFactorAuth string) ([]Friend, error) {
+	var friends []Friend
+	for _, offline := range []bool{false, true} {
+		fs, err := v.getFriends(ctx, auth, twoFactorAuth, offline)
+		if err != nil {
+			return nil, err
+		}
+		friends = append(friends, fs...)
+	}
+	return friends, nil
+}
+
+// getFriends は一度に取得できる件数に上限があるため、ページングしながらフレンドを取得する。
+func (v *VRC) getFriends(ctx context.Context, auth string, twoFactorAuth string, offline bool) ([]Friend, error) {
+	const pageSize = 100
+
+	var friends []Friend
+	for offset := 0; ; offset += pageSize {
+		path := fmt.Sprintf("/auth/user/friends?offset=%d&n=%d&offline=%t", offset, pageSize, offline)
+		req, err := http.NewRequestWithContext(ctx, "GET", v.BaseURL+path, nil)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to create request", "error", err)
+			return nil, err
+		}
+		req.Header.Add("user-agent", v.UserAgent)
+		req.Header.Add("Cookie", "auth="+auth+";twoFactorAuth="+twoFactorAuth)
+
+		resp, err := v.do(req, "friends")
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to execute request", "error", err)
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			slog.ErrorContext(ctx, "Failed to get friends", "status", resp.StatusCode)
+			return nil, fmt.Errorf("failed to get friends, status code: %d", resp.StatusCode)
+		}
+
+		var page []Friend
+		if err := json.Unmarshal(body, &page); err != nil {
+			slog.ErrorContext(ctx, "Failed to unmarshal friends", "error", err)
+			return nil, err
+		}
+		friends = append(friends, page...)
+
+		if len(page) < pageSize {
+			return friends, nil
+		}
+	}
+}
+
+func (v *VRC) GetWorld(ctx context.Context, worldID string, auth string, twoFactorAuth string) (World, error) {
+	path := "/worlds/" + worldID
+	req, err := http.NewRequestWithContext(ctx, "GET", v.BaseURL+path, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create request", "error", err)
+		return World{}, err
+	}
+	req.Header.Add("user-agent", v.UserAgent)
+	req.Header.Add("Cookie", "auth="+auth+";twoFactorAuth="+twoFactorAuth)
+
+	resp, err := v.do(req, "worlds")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to execute request", "error", err)
+		return World{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "Failed to get world", "status", resp.StatusCode)
+		return World{}, fmt.Errorf("failed to get world, status code: %d", resp.StatusCode)
+	}
+
+	var world World
+	if err := json.NewDecoder(resp.Body).Decode(&world); err != nil {
+		slog.ErrorContext(ctx, "Failed to unmarshal world", "error", err)
+		return World{}, err
+	}
+	return world, nil
+}
+
+// WorldIDFromLocation はロケーション（wrld_xxx:12345~private(usr_xxx) など）からワールドIDを取り出す。
+// offline、private、traveling などインスタンスを特定できない場合は空文字を返す。
+func WorldIDFromLocation(location string) string {
+	if !strings.HasPrefix(location, "wrld_") {
+		return ""
+	}
+	worldID, _, _ := strings.Cut(location, ":")
+	return worldID
+}
+
+// InstanceTypeFromLocation はロケーションからインスタンスの種類（public、friends+、friends、invite+、invite、group）を返す。
+// インスタンスを特定できない場合は空文字を返す。
+func InstanceTypeFromLocation(location string) string {
+	if WorldIDFromLocation(location) == "" {
+		return ""
+	}
+	switch {
+	case strings.Contains(location, "~hidden("):
+		return "friends+"
+	case strings.Contains(location, "~friends("):
+		return "friends"
+	case strings.Contains(location, "~private(") && strings.Contains(location, "~canRequestInvite"):
+		return "invite+"
+	case strings.Contains(location, "~private("):
+		return "invite"
+	case strings.Contains(location, "~group("):
+		return "group"
+	}
+	return "public"
+}
+
+// do はリクエストを実行し、エンドポイントごとの呼び出し回数と応答時間を記録する。
+func (v *VRC) do(req *http.Request, endpoint string) (*http.Response, error) {
+	// VRChat APIへはトレースコンテキストを伝播せず、呼び出し側のスパンのみを記録する
+	_, span := tracing.Start(req.Context(), "vrc."+endpoint,
+		attribute.String("http.request.method", req.Method),
+		attribute.String("vrc.endpoint", endpoint),
+	)
+
+	// 呼び出し回数の上限に達している場合は待機する
+	if v.Limiter != nil {
+		if err := v.Limiter.Wait(req.Context()); err != nil {
+			tracing.End(span, err)
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	resp, err := v.Client.Do(req)
+	metrics.VRCRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metrics.VRCRequests.WithLabelValues(endpoint, "error").Inc()
+		tracing.End(span, err)
+		return nil, err
+	}
+	metrics.VRCRequests.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	span.End()
+	return resp, nil
+}
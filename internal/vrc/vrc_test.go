@@ -1,6 +1,7 @@
 package vrc
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -8,19 +9,29 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// live は .env.dev を読み込めた場合に true になり、VRChat API を呼び出すテストを実行する
+var live bool
+
 func TestMain(m *testing.M) {
-	if err := godotenv.Load("../../.env.dev"); err != nil {
-		panic(err)
-	}
+	live = godotenv.Load("../../.env.dev") == nil
 	m.Run()
 }
 
+// requireLive は .env.dev がない場合（CIなど）に VRChat API を呼び出すテストをスキップする。
+func requireLive(t *testing.T) {
+	t.Helper()
+	if !live {
+		t.Skip("../../.env.dev not found")
+	}
+}
+
 func TestGetVRCUserInfo(t *testing.T) {
-	vrc := NewVRC()
+	requireLive(t)
+	vrc := NewVRC(os.Getenv("USER_AGENT"))
 	auth := os.Getenv("VRC_TOKEN")
 	twoFactorAuth := os.Getenv("VRC_TOKEN_2FA")
 	userID := os.Getenv("VRC_USER_ID")
-	userInfo, err := vrc.GetUserInfo(userID, auth, twoFactorAuth)
+	userInfo, err := vrc.GetUserInfo(context.Background(), userID, auth, twoFactorAuth)
 	if err != nil {
 		t.Fatalf("Failed to get user info: %v", err)
 	}
@@ -28,9 +39,10 @@ func TestGetVRCUserInfo(t *testing.T) {
 }
 
 func TestVerifyAuthToken(t *testing.T) {
+	requireLive(t)
 	auth := ""
-	vrc := NewVRC()
-	ok, err := vrc.VerifyAuthToken(auth)
+	vrc := NewVRC(os.Getenv("USER_AGENT"))
+	ok, err := vrc.VerifyAuthToken(context.Background(), auth)
 	if err != nil {
 		t.Fatalf("Failed to verify auth token: %v", err)
 	}
@@ -41,9 +53,10 @@ func TestVerifyAuthToken(t *testing.T) {
 }
 
 func TestLogin(t *testing.T) {
+	requireLive(t)
 	username := ""
 	passward := ""
-	auth, err := NewVRC().Login(username, passward)
+	auth, err := NewVRC(os.Getenv("USER_AGENT")).Login(context.Background(), username, passward)
 	if err != nil {
 		t.Fatalf("Failed to login: %v", err)
 	}
@@ -51,10 +64,11 @@ func TestLogin(t *testing.T) {
 }
 
 func TestVerify2FA(t *testing.T) {
+	requireLive(t)
 	code := ""
 	auth := ""
-	vrc := NewVRC()
-	ok, err := vrc.Verify2FA(code, auth)
+	vrc := NewVRC(os.Getenv("USER_AGENT"))
+	ok, err := vrc.Verify2FA(context.Background(), code, auth)
 	if err != nil {
 		t.Fatalf("Failed to verify 2FA: %v", err)
 	}
@@ -1,41 +1,28 @@
 package common
 
 import (
-	"log/slog"
-	"os"
+	"context"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
-	"github.com/aopontann/vrc-join-notify/internal/firestore"
+	"github.com/aopontann/vrc-join-notify/internal/app"
 	"github.com/aopontann/vrc-join-notify/internal/handler"
 )
 
 func init() {
-	db, err := firestore.NewDB()
+	a, err := app.New(context.Background())
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
-
-	// Cloud Logging用のログ設定
-	ops := slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelDebug,
-		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
-			if a.Key == slog.LevelKey {
-				a.Key = "severity"
-				level := a.Value.Any().(slog.Level)
-				if level == slog.LevelWarn {
-					a.Value = slog.StringValue("WARNING")
-				}
-			}
-
-			return a
-		},
+	if err := a.Config.ValidateInteractionEndpoint(); err != nil {
+		panic(err)
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &ops))
-	slog.SetDefault(logger)
+	// インスタンスの停止時にFirestoreの接続などを解放する
+	a.CloseOnSignal()
 
-	functions.HTTP("bot", handler.DiscordBotHandler(db))
-	functions.HTTP("notify", handler.NotifyHandler(db))
+	// リクエストヘッダのトレースコンテキストを引き継ぐ
+	functions.HTTP("bot", otelhttp.NewHandler(handler.DiscordBotHandler(a.DB, a.Discord, a.VRC, a.Config.Settings(), a.Config.Discord.OwnerIDs), "bot").ServeHTTP)
+	functions.HTTP("notify", otelhttp.NewHandler(handler.NotifyHandler(a.DB, a.Discord.Session, a.VRC, a.Config.Settings(), handler.PollOptions{LockTTL: a.Config.Poll.LockTTL.Duration, Shard: a.Config.Poll.Shard}), "notify").ServeHTTP)
+	functions.HTTP("digest", otelhttp.NewHandler(handler.DigestHandler(a.DB, a.Discord.Session, a.VRC), "digest").ServeHTTP)
 }